@@ -0,0 +1,65 @@
+// Command reindex rebuilds the Elasticsearch products index from Postgres
+// without downtime: it fills a new versioned index, checks its document
+// count, swaps the products alias over to it and deletes the old versions.
+// It reads the same DB_*, ES_URL and EMBEDDINGS_* environment variables as
+// the web app, and must use the same embedding model.
+package main
+
+import (
+	"DemoApp/internal/embeddings"
+	"DemoApp/internal/repository"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	esURL := os.Getenv("ES_URL")
+	if esURL == "" {
+		log.Fatal("ES_URL not set")
+	}
+
+	dsn := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable",
+		os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_NAME"))
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		log.Fatalf("Database connection failed: %v", err)
+	}
+
+	dims := 0
+	if v := os.Getenv("EMBEDDINGS_DIMENSIONS"); v != "" {
+		if dims, err = strconv.Atoi(v); err != nil {
+			log.Fatalf("Invalid EMBEDDINGS_DIMENSIONS %q", v)
+		}
+	}
+	embedder, err := embeddings.New(embeddings.Config{
+		URL:        os.Getenv("EMBEDDINGS_URL"),
+		Model:      os.Getenv("EMBEDDINGS_MODEL"),
+		Dimensions: dims,
+	})
+	if err != nil {
+		log.Fatalf("Embeddings configuration invalid: %v", err)
+	}
+
+	es, err := repository.NewElasticsearchRepository([]string{esURL}, embedder)
+	if err != nil {
+		log.Fatalf("Elasticsearch initialization failed: %v", err)
+	}
+
+	repo := repository.NewPostgresRepository(db)
+	repo.SetElasticsearch(es)
+
+	n, err := repo.RebuildSearchIndex()
+	if err != nil {
+		log.Fatalf("Reindex failed: %v", err)
+	}
+	log.Printf("Reindexed %d products", n)
+}
@@ -1,21 +1,33 @@
 package main
 
 import (
+	"DemoApp/internal/embeddings"
+	"DemoApp/internal/entitlements"
+	"DemoApp/internal/gql"
 	"DemoApp/internal/handlers"
+	"DemoApp/internal/identity"
+	"DemoApp/internal/loginguard"
+	"DemoApp/internal/mail"
+	"DemoApp/internal/models"
+	"DemoApp/internal/outbox"
+	"DemoApp/internal/passkeys"
 	"DemoApp/internal/repository"
+	"DemoApp/internal/sessionstore"
 	"DemoApp/internal/storage"
+	"DemoApp/internal/webhooks"
 	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/sessions"
 	_ "github.com/lib/pq"
-	"github.com/rbcervilla/redisstore/v9"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -32,6 +44,11 @@ func main() {
 	minioUseSSL := os.Getenv("MINIO_USE_SSL") == "true"
 	readerBrowserURL := getEnvDefault("READER_BROWSER_URL", "http://localhost:8081")
 	chatbotBrowserURL := getEnvDefault("CHATBOT_BROWSER_URL", "http://localhost:5000")
+	apiToken := os.Getenv("API_TOKEN") // Shared service token for Reader/Chatbot; empty disables the check
+	grpcPort := getEnvDefault("GRPC_PORT", "9090")
+	publicURL := strings.TrimRight(getEnvDefault("PUBLIC_URL", "http://localhost:8080"), "/")
+	trustProxy := os.Getenv("TRUST_PROXY") == "true" // Take client IPs from X-Forwarded-For
+	proxyHops, _ := strconv.Atoi(getEnvDefault("TRUST_PROXY_HOPS", "1"))
 
 	dsn := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable",
 		dbUser, dbPassword, dbHost, dbName)
@@ -42,6 +59,30 @@ func main() {
 	}
 	defer db.Close()
 
+	// Session cookies are signed (and optionally encrypted) with
+	// SESSION_AUTH_KEYS / SESSION_ENCRYPTION_KEYS, newest first so old keys
+	// keep validating during a rotation
+	sessionKeys, err := sessionstore.ParseKeys(os.Getenv("SESSION_AUTH_KEYS"), os.Getenv("SESSION_ENCRYPTION_KEYS"))
+	if err != nil {
+		if os.Getenv("SESSION_AUTH_KEYS") != "" {
+			log.Fatalf("Invalid session keys: %v", err)
+		}
+		log.Println("Warning: SESSION_AUTH_KEYS not set, using random session keys; cookie sessions will not survive a restart or work across replicas")
+		if sessionKeys, err = sessionstore.RandomKeys(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Secure cookies by default whenever the site is served over HTTPS
+	cookieSecure := getEnvDefault("SESSION_COOKIE_SECURE", fmt.Sprint(strings.HasPrefix(publicURL, "https://"))) == "true"
+	sameSite, err := sessionstore.ParseSameSite(os.Getenv("SESSION_COOKIE_SAMESITE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	sessionOptions, err := sessionstore.Options(cookieSecure, sameSite)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Initialize session store (Redis if available, fallback to cookie store)
 	var store sessions.Store
 	var redisClient *redis.Client
@@ -61,15 +102,15 @@ func main() {
 		if err != nil {
 			log.Printf("Warning: Redis connection failed: %v", err)
 			log.Println("Falling back to cookie-based sessions and no caching")
-			store = sessions.NewCookieStore([]byte("something-very-secret"))
+			store = sessionstore.NewCookieStore(sessionKeys, sessionOptions)
 			redisClient = nil
 		} else {
 			log.Println("Redis connected successfully")
-			redisStore, err := redisstore.NewRedisStore(ctx, redisClient)
+			redisStore, err := sessionstore.NewRedisStore(ctx, redisClient, sessionOptions)
 			if err != nil {
 				log.Printf("Warning: Redis store initialization failed: %v", err)
 				log.Println("Falling back to cookie-based sessions")
-				store = sessions.NewCookieStore([]byte("something-very-secret"))
+				store = sessionstore.NewCookieStore(sessionKeys, sessionOptions)
 			} else {
 				store = redisStore
 				log.Println("Using Redis for session storage and caching")
@@ -77,27 +118,7 @@ func main() {
 		}
 	} else {
 		log.Println("REDIS_URL not set, using cookie-based sessions and no caching")
-		store = sessions.NewCookieStore([]byte("something-very-secret"))
-	}
-
-	// Configure session options for development (allow HTTP, not just HTTPS)
-	// Note: Options() method is only available on specific store implementations
-	if cookieStore, ok := store.(*sessions.CookieStore); ok {
-		cookieStore.Options = &sessions.Options{
-			Path:     "/",
-			MaxAge:   86400 * 30, // 30 days
-			HttpOnly: true,
-			Secure:   false, // Set to true in production with HTTPS
-			SameSite: http.SameSiteLaxMode,
-		}
-	} else if redisStore, ok := store.(*redisstore.RedisStore); ok {
-		redisStore.Options(sessions.Options{
-			Path:     "/",
-			MaxAge:   86400 * 30, // 30 days
-			HttpOnly: true,
-			Secure:   false, // Set to true in production with HTTPS
-			SameSite: http.SameSiteLaxMode,
-		})
+		store = sessionstore.NewCookieStore(sessionKeys, sessionOptions)
 	}
 
 	repo := repository.NewPostgresRepository(db)
@@ -111,10 +132,11 @@ func main() {
 	// Initialize Elasticsearch if URL is provided
 	if esURL != "" {
 		log.Println("Initializing Elasticsearch...")
+		embedder := newEmbedder()
 		var es *repository.ElasticsearchRepository
 		err := retryWithBackoff("Elasticsearch", 10, 2*time.Second, func() error {
 			var initErr error
-			es, initErr = repository.NewElasticsearchRepository([]string{esURL})
+			es, initErr = repository.NewElasticsearchRepository([]string{esURL}, embedder)
 			return initErr
 		})
 
@@ -125,19 +147,18 @@ func main() {
 			repo.SetElasticsearch(es)
 			log.Println("Elasticsearch initialized successfully")
 
-			// Index all products on startup
+			// Push the admin-managed synonyms and index all products on startup
 			go func() {
+				if err := repo.SearchRules().SyncSynonyms(); err != nil {
+					log.Printf("Error pushing synonyms to Elasticsearch: %v", err)
+				}
 				log.Println("Indexing products to Elasticsearch...")
-				products, err := repo.Products().ListProducts()
+				n, err := repo.ReindexProducts()
 				if err != nil {
-					log.Printf("Error listing products for indexing: %v", err)
-					return
-				}
-				if err := es.IndexProducts(products); err != nil {
 					log.Printf("Error indexing products: %v", err)
 					return
 				}
-				log.Printf("Successfully indexed %d products", len(products))
+				log.Printf("Successfully indexed %d products", n)
 			}()
 		}
 	} else {
@@ -168,12 +189,79 @@ func main() {
 		log.Println("MINIO_ENDPOINT not set, MinIO storage disabled")
 	}
 
+	// Entitlement events reach WatchEntitlements streams on every replica via
+	// Redis, or only this process when Redis is unavailable
+	var entitlementBroker entitlements.Broker
+	if redisClient != nil {
+		entitlementBroker = entitlements.NewRedisBroker(redisClient)
+	} else {
+		entitlementBroker = entitlements.NewMemoryBroker()
+	}
+
+	// Outbound webhooks are queued in Postgres and delivered in the background
+	webhookDispatcher := webhooks.NewDispatcher(repo.Webhooks())
+	go webhookDispatcher.Run(context.Background())
+
+	// Failed logins are counted in Redis so limits hold across replicas,
+	// or per process when Redis is unavailable
+	var loginStore loginguard.Store
+	if redisClient != nil {
+		loginStore = loginguard.NewRedisStore(redisClient)
+	} else {
+		loginStore = loginguard.NewMemoryStore()
+	}
+	loginGuard := loginguard.New(loginStore, loginguard.DefaultPolicy)
+	loginGuard.TrustProxy = trustProxy
+	loginGuard.ProxyHops = proxyHops
+
 	h := &handlers.Handlers{
 		Repo:              repo,
 		Store:             store,
 		ReaderBrowserURL:  readerBrowserURL,
 		ChatbotBrowserURL: chatbotBrowserURL,
+		Entitlements:      entitlementBroker,
+		Webhooks:          webhookDispatcher,
+		LoginGuard:        loginGuard,
+		Mailer:            newMailer(),
+		PublicURL:         publicURL,
+	}
+
+	// Passkeys are bound to PUBLIC_URL's host, so sign-in only works when the
+	// site is reached through that URL
+	if wa, err := passkeys.NewWebAuthn(publicURL); err != nil {
+		log.Printf("Passkeys disabled: %v", err)
+	} else {
+		h.Passkeys = wa
+	}
+	h.IdentityProviders = newIdentityProviders(context.Background(), publicURL)
+
+	// Domain events are written to the outbox in the same transaction as
+	// order, review and product changes, then published at-least-once to
+	// in-process handlers and, when Redis is available, a Redis stream
+	inProcessSink := outbox.NewInProcessSink()
+	h.RegisterEventHandlers(inProcessSink)
+	inProcessSink.Subscribe(models.EventProductStockChanged, func(_ context.Context, event models.OutboxEvent) error {
+		var payload models.ProductEvent
+		if err := event.Decode(&payload); err != nil {
+			return err
+		}
+		return repo.RefreshProduct(payload.ProductID)
+	})
+	// Reviews change a product's average rating, which the rating facet filters on
+	for _, eventType := range []string{models.EventReviewCreated, models.EventReviewUpdated, models.EventReviewDeleted} {
+		inProcessSink.Subscribe(eventType, func(_ context.Context, event models.OutboxEvent) error {
+			var payload models.ReviewEvent
+			if err := event.Decode(&payload); err != nil {
+				return err
+			}
+			return repo.RefreshProduct(payload.ProductID)
+		})
+	}
+	outboxSinks := []outbox.Sink{inProcessSink}
+	if redisClient != nil {
+		outboxSinks = append(outboxSinks, outbox.NewRedisStreamSink(redisClient, "bookstore:events", 10000))
 	}
+	go outbox.NewDispatcher(repo.Outbox(), outboxSinks...).Run(context.Background())
 
 	mux := http.NewServeMux()
 
@@ -212,8 +300,24 @@ func main() {
 		h.LoginPage(w, r, "")
 	})
 	mux.HandleFunc("/login/process", h.Login)
+	mux.HandleFunc("/login/2fa", h.LoginTwoFactorPage)
+	mux.HandleFunc("/login/2fa/process", h.LoginTwoFactor)
+	if h.Passkeys != nil {
+		mux.HandleFunc("/login/passkey/begin", h.BeginPasskeyLogin)
+		mux.HandleFunc("/login/passkey/finish", h.FinishPasskeyLogin)
+	}
+	mux.HandleFunc("GET /login/oauth/{provider}", h.OAuthLogin)
+	mux.HandleFunc("GET /login/oauth/{provider}/callback", h.OAuthCallback)
 	mux.HandleFunc("/logout", h.Logout)
+	mux.HandleFunc("/account/unlock", h.UnlockAccount)
+	mux.HandleFunc("/account/verify", h.VerifyEmail)
+	mux.HandleFunc("/account/verify/resend", h.ResendVerification)
+	mux.HandleFunc("/password/forgot", h.ForgotPasswordPage)
+	mux.HandleFunc("/password/forgot/process", h.RequestPasswordReset)
+	mux.HandleFunc("/password/reset", h.ResetPasswordPage)
+	mux.HandleFunc("/password/reset/process", h.ResetPassword)
 	mux.HandleFunc("/orders", h.MyOrders)
+	mux.HandleFunc("/orders/{id}/cancel", h.CancelOrder)
 
 	// Profile routes
 	mux.HandleFunc("/profile", h.ProfilePage)
@@ -221,11 +325,38 @@ func main() {
 	mux.HandleFunc("/profile/update", h.UpdateProfile)
 	mux.HandleFunc("/profile/password", h.ProfilePasswordPage)
 	mux.HandleFunc("/profile/password/update", h.UpdatePassword)
+	mux.HandleFunc("/profile/sessions/{id}/revoke", h.RevokeSession)
+	mux.HandleFunc("/profile/sessions/revoke-all", h.SignOutEverywhere)
+	mux.HandleFunc("/profile/export", h.ExportAccount)
+	mux.HandleFunc("/profile/delete", h.DeleteAccountPage)
+	mux.HandleFunc("/profile/delete/process", h.DeleteAccount)
+	mux.HandleFunc("/profile/2fa", h.TwoFactorPage)
+	mux.HandleFunc("/profile/2fa/enable", h.EnableTwoFactor)
+	mux.HandleFunc("/profile/2fa/disable", h.DisableTwoFactor)
+	mux.HandleFunc("/profile/2fa/recovery-codes", h.RegenerateRecoveryCodes)
+	if h.Passkeys != nil {
+		mux.HandleFunc("/profile/passkeys", h.PasskeysPage)
+		mux.HandleFunc("/profile/passkeys/register/begin", h.BeginPasskeyRegistration)
+		mux.HandleFunc("/profile/passkeys/register/finish", h.FinishPasskeyRegistration)
+		mux.HandleFunc("/profile/passkeys/{id}/delete", h.DeletePasskey)
+	}
 
 	// Review routes
 	mux.HandleFunc("/products/{id}/review", h.SubmitReview)
 	mux.HandleFunc("/reviews/{id}/delete", h.DeleteReview)
 
+	// Admin routes
+	mux.HandleFunc("/admin/search", h.RequireAdmin(h.AdminSearchAnalytics))
+	mux.HandleFunc("/admin/search/rules", h.RequireAdmin(h.AdminSearchRules))
+	mux.HandleFunc("/admin/search/synonyms", h.RequireAdmin(h.AdminCreateSynonymSet))
+	mux.HandleFunc("/admin/search/synonyms/{id}/delete", h.RequireAdmin(h.AdminDeleteSynonymSet))
+	mux.HandleFunc("/admin/search/promotions", h.RequireAdmin(h.AdminCreatePromotion))
+	mux.HandleFunc("/admin/search/promotions/{id}/delete", h.RequireAdmin(h.AdminDeletePromotion))
+	mux.HandleFunc("/admin/webhooks", h.RequireAdmin(h.AdminWebhooks))
+	mux.HandleFunc("/admin/webhooks/{id}/toggle", h.RequireAdmin(h.AdminToggleWebhook))
+	mux.HandleFunc("/admin/webhooks/{id}/delete", h.RequireAdmin(h.AdminDeleteWebhook))
+	mux.HandleFunc("/admin/webhooks/deliveries/{id}/retry", h.RequireAdmin(h.AdminRetryDelivery))
+
 	// Image routes (MinIO)
 	if imageHandlers != nil {
 		mux.HandleFunc("/images/", imageHandlers.ServeImage)
@@ -233,25 +364,36 @@ func main() {
 	}
 
 	// API routes for service-to-service communication (Reader app, Chatbot app)
-	mux.HandleFunc("/api/auth", h.APIAuth)
-	mux.HandleFunc("/api/purchases/", func(w http.ResponseWriter, r *http.Request) {
-		// Route to appropriate handler based on path segments
-		// /api/purchases/{user_id} -> GetUserPurchases
-		// /api/purchases/{user_id}/{sku} -> VerifyPurchase
-		path := r.URL.Path[len("/api/purchases/"):]
-		parts := strings.Split(path, "/")
-		if len(parts) >= 2 && parts[1] != "" {
-			h.VerifyPurchase(w, r)
-		} else {
-			h.GetUserPurchases(w, r)
+	for _, route := range h.APIRoutes(apiToken) {
+		mux.Handle(route.Pattern, route.Handler)
+	}
+	mux.HandleFunc("/api/openapi.json", h.OpenAPISpec)
+	mux.HandleFunc("/api/docs", h.APIDocs)
+
+	// GraphQL endpoint (Chatbot app fetches products, reviews and purchases in one
+	// request), behind the API token since it exposes any user's orders
+	graphqlHandler, err := gql.NewHandler(repo, apiToken)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux.Handle("/graphql", graphqlHandler)
+
+	// gRPC Entitlements service for the Reader app, sharing the order repository
+	// and API token with /api/purchases
+	grpcServer := entitlements.NewGRPCServer(repo.Orders(), entitlementBroker, apiToken)
+	go func() {
+		lis, err := net.Listen("tcp", ":"+grpcPort)
+		if err != nil {
+			log.Fatalf("gRPC: failed to listen on :%s: %v", grpcPort, err)
 		}
-	})
-	mux.HandleFunc("/api/products", h.APIProducts)
-	mux.HandleFunc("/api/products/", h.APIProducts)
-	mux.HandleFunc("/api/categories", h.APICategories)
+		log.Printf("Starting gRPC server on :%s", grpcPort)
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatalf("gRPC: server stopped: %v", err)
+		}
+	}()
 
 	log.Println("Starting server on :8080")
-	err = http.ListenAndServe(":8080", mux)
+	err = http.ListenAndServe(":8080", h.TrackSessions(h.VerifyCSRF(mux)))
 	log.Fatal(err)
 }
 
@@ -283,6 +425,107 @@ func retryWithBackoff(operation string, maxRetries int, initialDelay time.Durati
 	return fmt.Errorf("%s: failed after %d attempts: %w", operation, maxRetries, err)
 }
 
+// newMailer picks how email is delivered: an SMTP relay when SMTP_HOST is
+// set, .eml files in MAIL_DIR for local development, otherwise the log
+func newMailer() mail.Mailer {
+	from := getEnvDefault("MAIL_FROM", "Bookstore <no-reply@localhost>")
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		addr := net.JoinHostPort(host, getEnvDefault("SMTP_PORT", "587"))
+		log.Printf("Sending email via SMTP relay %s", addr)
+		return &mail.SMTPMailer{
+			Addr:     addr,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	}
+	if dir := os.Getenv("MAIL_DIR"); dir != "" {
+		log.Printf("Writing outgoing email to %s", dir)
+		return &mail.FileMailer{Dir: dir, From: from}
+	}
+	log.Println("SMTP_HOST not set, outgoing email will be logged")
+	return mail.LogMailer{}
+}
+
+// newEmbedder picks the model that embeds product descriptions for hybrid
+// search: a model server at EMBEDDINGS_URL with EMBEDDINGS_MODEL and
+// EMBEDDINGS_DIMENSIONS, otherwise the built-in hashing embedder. It returns
+// nil, disabling semantic search, if the settings are invalid.
+func newEmbedder() embeddings.Embedder {
+	cfg := embeddings.Config{URL: os.Getenv("EMBEDDINGS_URL"), Model: os.Getenv("EMBEDDINGS_MODEL")}
+	if dims := os.Getenv("EMBEDDINGS_DIMENSIONS"); dims != "" {
+		n, err := strconv.Atoi(dims)
+		if err != nil {
+			log.Printf("Warning: invalid EMBEDDINGS_DIMENSIONS %q, semantic search disabled", dims)
+			return nil
+		}
+		cfg.Dimensions = n
+	}
+	embedder, err := embeddings.New(cfg)
+	if err != nil {
+		log.Printf("Warning: %v, semantic search disabled", err)
+		return nil
+	}
+	if cfg.URL != "" {
+		log.Printf("Embedding products with model %q at %s", cfg.Model, cfg.URL)
+	} else {
+		log.Println("EMBEDDINGS_URL not set, embedding products with the built-in hashing embedder")
+	}
+	return embedder
+}
+
+// newIdentityProviders configures social login from OAUTH_PROVIDERS, a
+// comma-separated list of names. Each name reads OAUTH_<NAME>_CLIENT_ID and
+// _CLIENT_SECRET plus either _ISSUER for OpenID Connect discovery or
+// _AUTH_URL, _TOKEN_URL and _USERINFO_URL for plain OAuth2. _DISPLAY_NAME
+// and _SCOPES are optional. A provider that fails to configure is skipped.
+func newIdentityProviders(ctx context.Context, publicURL string) []identity.Provider {
+	var providers []identity.Provider
+	for _, name := range strings.Split(os.Getenv("OAUTH_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OAUTH_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		displayName := getEnvDefault(prefix+"DISPLAY_NAME", strings.ToUpper(name[:1])+name[1:])
+		redirectURL := publicURL + "/login/oauth/" + name + "/callback"
+		scopes := strings.Fields(strings.ReplaceAll(os.Getenv(prefix+"SCOPES"), ",", " "))
+
+		var provider identity.Provider
+		var err error
+		if issuer := os.Getenv(prefix + "ISSUER"); issuer != "" {
+			provider, err = identity.NewOIDC(ctx, identity.OIDCConfig{
+				Name:         name,
+				DisplayName:  displayName,
+				Issuer:       issuer,
+				ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+				ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+				RedirectURL:  redirectURL,
+				Scopes:       scopes,
+			})
+		} else {
+			provider, err = identity.NewOAuth2(identity.OAuth2Config{
+				Name:         name,
+				DisplayName:  displayName,
+				ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+				ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+				RedirectURL:  redirectURL,
+				AuthURL:      os.Getenv(prefix + "AUTH_URL"),
+				TokenURL:     os.Getenv(prefix + "TOKEN_URL"),
+				UserInfoURL:  os.Getenv(prefix + "USERINFO_URL"),
+				Scopes:       scopes,
+			})
+		}
+		if err != nil {
+			log.Printf("Warning: sign-in with %s disabled: %v", name, err)
+			continue
+		}
+		log.Printf("Sign-in with %s enabled", displayName)
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
 // getEnvDefault returns the environment variable value or a default if not set
 func getEnvDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -0,0 +1,40 @@
+// Package apiauth checks the shared service token presented by the Reader and
+// Chatbot apps. The same check guards the HTTP purchase endpoints and the gRPC
+// Entitlements service.
+package apiauth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>" value
+func BearerToken(header string) string {
+	const prefix = "Bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(prefix):])
+}
+
+// Valid reports whether presented matches the expected token.
+// An empty expected token disables the check.
+func Valid(expected, presented string) bool {
+	if expected == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(presented)) == 1
+}
+
+// Require wraps next so requests without the expected bearer token get 401
+func Require(expected string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Valid(expected, BearerToken(r.Header.Get("Authorization"))) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,53 @@
+// Package embeddings turns text into vectors whose closeness reflects
+// similar meaning, for semantic search over product descriptions.
+package embeddings
+
+import (
+	"context"
+	"errors"
+	"math"
+)
+
+// Embedder computes one vector of Dimensions() values for each text
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	Dimensions() int
+}
+
+// Config selects an embedder. With a URL, texts are embedded by the model
+// server there; otherwise a HashEmbedder is used.
+type Config struct {
+	URL        string // OpenAI-compatible embeddings endpoint, e.g. http://ollama:11434/v1/embeddings
+	Model      string
+	Dimensions int // Length of the model's vectors; 0 for the HashEmbedder's default
+}
+
+// New returns the embedder cfg describes
+func New(cfg Config) (Embedder, error) {
+	if cfg.Dimensions < 0 {
+		return nil, errors.New("embeddings: dimensions cannot be negative")
+	}
+	if cfg.URL != "" {
+		if cfg.Dimensions == 0 {
+			return nil, errors.New("embeddings: a model server needs its vectors' dimensions")
+		}
+		return &HTTPEmbedder{URL: cfg.URL, Model: cfg.Model, Dims: cfg.Dimensions}, nil
+	}
+	return &HashEmbedder{Dims: cfg.Dimensions}, nil
+}
+
+// normalize scales v to unit length in place, so cosine similarity is a
+// dot product. A zero vector is left as it is.
+func normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	scale := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= scale
+	}
+}
@@ -0,0 +1,89 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// TestHashEmbedder checks vectors are deterministic unit vectors and that
+// texts sharing word stems are closer than unrelated ones
+func TestHashEmbedder(t *testing.T) {
+	e := &HashEmbedder{}
+	vectors, err := e.Embed(context.Background(), []string{
+		"books about obsession and revenge",
+		"A captain's obsessive quest for revenge against the white whale that obsessed him",
+		"A comedy of manners about marriage in the English countryside",
+		"books about obsession and revenge",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors[0]) != defaultHashDimensions {
+		t.Fatalf("got %d dimensions, want %d", len(vectors[0]), defaultHashDimensions)
+	}
+	if d := dot(vectors[0], vectors[0]); d < 0.999 || d > 1.001 {
+		t.Errorf("vector length squared is %f, want 1", d)
+	}
+	if dot(vectors[0], vectors[3]) < 0.999 {
+		t.Error("the same text should embed the same way")
+	}
+	if related, unrelated := dot(vectors[0], vectors[1]), dot(vectors[0], vectors[2]); related <= unrelated {
+		t.Errorf("related text similarity %f should exceed unrelated %f", related, unrelated)
+	}
+}
+
+// TestHTTPEmbedder checks vectors are matched to texts by index and that
+// vectors of the wrong length are rejected
+func TestHTTPEmbedder(t *testing.T) {
+	var request struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}
+	dims := 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		embedding := make([]float32, dims)
+		embedding[0] = 3
+		w.Write([]byte(`{"data": [{"index": 1, "embedding": [0, 2]}, {"index": 0, "embedding": ` + mustJSON(t, embedding) + `}]}`))
+	}))
+	defer srv.Close()
+
+	e := &HTTPEmbedder{URL: srv.URL, Model: "nomic-embed-text", Dims: 2}
+	vectors, err := e.Embed(context.Background(), []string{"first", "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Model != "nomic-embed-text" || len(request.Input) != 2 {
+		t.Errorf("unexpected request %+v", request)
+	}
+	if vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Errorf("vectors should be normalized and in text order, got %v", vectors)
+	}
+
+	dims = 3
+	if _, err := e.Embed(context.Background(), []string{"first", "second"}); err == nil {
+		t.Error("expected an error for vectors of the wrong length")
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
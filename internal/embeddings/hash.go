@@ -0,0 +1,90 @@
+package embeddings
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// defaultHashDimensions is the HashEmbedder's vector length when unset
+const defaultHashDimensions = 256
+
+// stopWords carry no meaning of their own, so they are left out of vectors
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "has": true, "he": true, "her": true, "his": true, "in": true, "is": true,
+	"it": true, "its": true, "of": true, "on": true, "or": true, "she": true, "that": true, "the": true,
+	"their": true, "this": true, "to": true, "was": true, "who": true, "with": true, "about": true, "books": true,
+	"book": true,
+}
+
+// suffixes are stripped from words so "obsessed" and "obsession" share a
+// stem, longest first
+var suffixes = []string{"ations", "ation", "ions", "ness", "ing", "ion", "ies", "ed", "es", "ly", "s"}
+
+// HashEmbedder is a deterministic embedder that needs no model: each word
+// stem and its character trigrams are hashed into a fixed number of
+// dimensions. Texts sharing words and word parts come out close, but
+// synonyms do not, so it suits tests and development rather than real
+// semantic search.
+type HashEmbedder struct {
+	Dims int // 0 uses defaultHashDimensions
+}
+
+func (e *HashEmbedder) Dimensions() int {
+	if e.Dims > 0 {
+		return e.Dims
+	}
+	return defaultHashDimensions
+}
+
+func (e *HashEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *HashEmbedder) embed(text string) []float32 {
+	v := make([]float32, e.Dimensions())
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if stopWords[w] {
+			continue
+		}
+		stem := stem(w)
+		e.add(v, "w:"+stem, 1)
+		padded := []rune("^" + stem + "$")
+		for i := 0; i+3 <= len(padded); i++ {
+			e.add(v, "t:"+string(padded[i:i+3]), 0.3)
+		}
+	}
+	normalize(v)
+	return v
+}
+
+// add hashes feature to a dimension and a sign, so unrelated features
+// sharing a dimension tend to cancel out rather than add up
+func (e *HashEmbedder) add(v []float32, feature string, weight float32) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	v[sum%uint64(len(v))] += weight
+}
+
+// stem strips a common suffix from word, keeping at least four letters
+func stem(word string) string {
+	for _, s := range suffixes {
+		if base, ok := strings.CutSuffix(word, s); ok && len([]rune(base)) >= 4 {
+			return base
+		}
+	}
+	return word
+}
@@ -0,0 +1,83 @@
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPEmbedder embeds texts with a model server speaking the OpenAI
+// embeddings API, which local servers such as Ollama, llama.cpp and
+// text-embeddings-inference provide
+type HTTPEmbedder struct {
+	URL    string
+	Model  string
+	Dims   int
+	Client *http.Client // nil uses a client with a 30 second timeout
+}
+
+var defaultClient = &http.Client{Timeout: 30 * time.Second}
+
+func (e *HTTPEmbedder) Dimensions() int {
+	return e.Dims
+}
+
+func (e *HTTPEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(map[string]interface{}{"model": e.Model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := e.Client
+	if client == nil {
+		client = defaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return nil, fmt.Errorf("embeddings request failed: %s: %s", res.Status, body)
+	}
+
+	var body struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("error parsing embeddings response: %w", err)
+	}
+	if len(body.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings response has %d vectors for %d texts", len(body.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range body.Data {
+		if d.Index < 0 || d.Index >= len(texts) || vectors[d.Index] != nil {
+			return nil, fmt.Errorf("embeddings response has an unexpected index %d", d.Index)
+		}
+		if len(d.Embedding) != e.Dims {
+			return nil, fmt.Errorf("model returned %d dimensions, configured for %d", len(d.Embedding), e.Dims)
+		}
+		normalize(d.Embedding)
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
@@ -0,0 +1,45 @@
+package entitlements
+
+import (
+	"DemoApp/internal/apiauth"
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authorize applies the same bearer token check as the HTTP API
+func authorize(ctx context.Context, token string) error {
+	presented := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			presented = apiauth.BearerToken(values[0])
+		}
+	}
+	if !apiauth.Valid(token, presented) {
+		return status.Error(codes.Unauthenticated, "invalid or missing API token")
+	}
+	return nil
+}
+
+// UnaryAuthInterceptor rejects unary calls without the API token
+func UnaryAuthInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := authorize(ctx, token); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthInterceptor rejects streaming calls without the API token
+func StreamAuthInterceptor(token string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authorize(ss.Context(), token); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,146 @@
+package entitlements
+
+import (
+	"DemoApp/internal/models"
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Event is a change to a user's entitlements
+type Event struct {
+	Type       string    `json:"type"` // EventGranted or EventRevoked
+	UserID     int       `json:"user_id"`
+	SKU        string    `json:"sku"`
+	OrderID    int       `json:"order_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+const (
+	EventGranted = "granted"
+	EventRevoked = "revoked"
+)
+
+// Broker fans entitlement events out to WatchEntitlements streams
+type Broker interface {
+	Publish(ctx context.Context, event Event) error
+	// Subscribe returns a channel of events and a function to stop receiving them
+	Subscribe(ctx context.Context) (<-chan Event, func())
+}
+
+// subscriberBuffer is how many events a slow stream may fall behind before
+// further events are dropped for it
+const subscriberBuffer = 64
+
+// MemoryBroker delivers events to subscribers in the same process
+type MemoryBroker struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subs: make(map[chan Event]struct{})}
+}
+
+func (b *MemoryBroker) Publish(_ context.Context, event Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Entitlements: subscriber buffer full, dropping event for user %d", event.UserID)
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(_ context.Context) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// redisChannel is the Redis pub/sub channel entitlement events are sent on
+const redisChannel = "entitlements:events"
+
+// RedisBroker delivers events across app replicas via Redis pub/sub
+type RedisBroker struct {
+	client *redis.Client
+}
+
+func NewRedisBroker(client *redis.Client) *RedisBroker {
+	return &RedisBroker{client: client}
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, redisChannel, data).Err()
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context) (<-chan Event, func()) {
+	pubsub := b.client.Subscribe(ctx, redisChannel)
+	ch := make(chan Event, subscriberBuffer)
+
+	go func() {
+		defer close(ch)
+		for msg := range pubsub.Channel() {
+			var event Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Printf("Entitlements: invalid event payload: %v", err)
+				continue
+			}
+			select {
+			case ch <- event:
+			default:
+				log.Printf("Entitlements: subscriber buffer full, dropping event for user %d", event.UserID)
+			}
+		}
+	}()
+
+	return ch, func() {
+		if err := pubsub.Close(); err != nil {
+			log.Printf("Entitlements: error closing Redis subscription: %v", err)
+		}
+	}
+}
+
+// PublishOrder publishes a grant for every book with a SKU in the order
+func PublishOrder(ctx context.Context, b Broker, order *models.Order) {
+	if order == nil || order.UserID == nil {
+		return
+	}
+	for _, item := range order.Items {
+		if item.Product.SKU == nil {
+			continue
+		}
+		event := Event{
+			Type:       EventGranted,
+			UserID:     *order.UserID,
+			SKU:        *item.Product.SKU,
+			OrderID:    order.ID,
+			OccurredAt: order.CreatedAt,
+		}
+		if err := b.Publish(ctx, event); err != nil {
+			log.Printf("Entitlements: error publishing grant for order %d: %v", order.ID, err)
+		}
+	}
+}
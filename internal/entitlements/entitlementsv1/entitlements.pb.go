@@ -0,0 +1,578 @@
+// Entitlements service for the Reader app.
+//
+// Mirrors GET /api/purchases/{user_id} and GET /api/purchases/{user_id}/{sku}
+// with typed messages, and adds a stream of entitlement changes so the Reader
+// does not have to poll. Calls must carry "authorization: Bearer <API_TOKEN>"
+// metadata when the Bookstore is configured with API_TOKEN.
+//
+// Regenerate the Go code with: ./scripts/generate-proto.sh
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: entitlements/v1/entitlements.proto
+
+package entitlementsv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type EntitlementEvent_Type int32
+
+const (
+	EntitlementEvent_TYPE_UNSPECIFIED EntitlementEvent_Type = 0
+	EntitlementEvent_TYPE_GRANTED     EntitlementEvent_Type = 1
+	EntitlementEvent_TYPE_REVOKED     EntitlementEvent_Type = 2
+)
+
+// Enum value maps for EntitlementEvent_Type.
+var (
+	EntitlementEvent_Type_name = map[int32]string{
+		0: "TYPE_UNSPECIFIED",
+		1: "TYPE_GRANTED",
+		2: "TYPE_REVOKED",
+	}
+	EntitlementEvent_Type_value = map[string]int32{
+		"TYPE_UNSPECIFIED": 0,
+		"TYPE_GRANTED":     1,
+		"TYPE_REVOKED":     2,
+	}
+)
+
+func (x EntitlementEvent_Type) Enum() *EntitlementEvent_Type {
+	p := new(EntitlementEvent_Type)
+	*p = x
+	return p
+}
+
+func (x EntitlementEvent_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (EntitlementEvent_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_entitlements_v1_entitlements_proto_enumTypes[0].Descriptor()
+}
+
+func (EntitlementEvent_Type) Type() protoreflect.EnumType {
+	return &file_entitlements_v1_entitlements_proto_enumTypes[0]
+}
+
+func (x EntitlementEvent_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use EntitlementEvent_Type.Descriptor instead.
+func (EntitlementEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return file_entitlements_v1_entitlements_proto_rawDescGZIP(), []int{6, 0}
+}
+
+type VerifyPurchaseRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId int64                  `protobuf:"varint,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// Product SKU, e.g. "BOOK-1342"
+	Sku           string `protobuf:"bytes,2,opt,name=sku,proto3" json:"sku,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VerifyPurchaseRequest) Reset() {
+	*x = VerifyPurchaseRequest{}
+	mi := &file_entitlements_v1_entitlements_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyPurchaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyPurchaseRequest) ProtoMessage() {}
+
+func (x *VerifyPurchaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_entitlements_v1_entitlements_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyPurchaseRequest.ProtoReflect.Descriptor instead.
+func (*VerifyPurchaseRequest) Descriptor() ([]byte, []int) {
+	return file_entitlements_v1_entitlements_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *VerifyPurchaseRequest) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *VerifyPurchaseRequest) GetSku() string {
+	if x != nil {
+		return x.Sku
+	}
+	return ""
+}
+
+type VerifyPurchaseResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Owned         bool                   `protobuf:"varint,1,opt,name=owned,proto3" json:"owned,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VerifyPurchaseResponse) Reset() {
+	*x = VerifyPurchaseResponse{}
+	mi := &file_entitlements_v1_entitlements_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyPurchaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyPurchaseResponse) ProtoMessage() {}
+
+func (x *VerifyPurchaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_entitlements_v1_entitlements_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyPurchaseResponse.ProtoReflect.Descriptor instead.
+func (*VerifyPurchaseResponse) Descriptor() ([]byte, []int) {
+	return file_entitlements_v1_entitlements_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *VerifyPurchaseResponse) GetOwned() bool {
+	if x != nil {
+		return x.Owned
+	}
+	return false
+}
+
+type ListPurchasesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        int64                  `protobuf:"varint,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPurchasesRequest) Reset() {
+	*x = ListPurchasesRequest{}
+	mi := &file_entitlements_v1_entitlements_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPurchasesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPurchasesRequest) ProtoMessage() {}
+
+func (x *ListPurchasesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_entitlements_v1_entitlements_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPurchasesRequest.ProtoReflect.Descriptor instead.
+func (*ListPurchasesRequest) Descriptor() ([]byte, []int) {
+	return file_entitlements_v1_entitlements_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListPurchasesRequest) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+type ListPurchasesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Purchases     []*Purchase            `protobuf:"bytes,1,rep,name=purchases,proto3" json:"purchases,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPurchasesResponse) Reset() {
+	*x = ListPurchasesResponse{}
+	mi := &file_entitlements_v1_entitlements_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPurchasesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPurchasesResponse) ProtoMessage() {}
+
+func (x *ListPurchasesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_entitlements_v1_entitlements_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPurchasesResponse.ProtoReflect.Descriptor instead.
+func (*ListPurchasesResponse) Descriptor() ([]byte, []int) {
+	return file_entitlements_v1_entitlements_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListPurchasesResponse) GetPurchases() []*Purchase {
+	if x != nil {
+		return x.Purchases
+	}
+	return nil
+}
+
+type Purchase struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Sku         string                 `protobuf:"bytes,1,opt,name=sku,proto3" json:"sku,omitempty"`
+	GutenbergId int64                  `protobuf:"varint,2,opt,name=gutenberg_id,json=gutenbergId,proto3" json:"gutenberg_id,omitempty"`
+	Title       string                 `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	Author      string                 `protobuf:"bytes,4,opt,name=author,proto3" json:"author,omitempty"`
+	CoverUrl    string                 `protobuf:"bytes,5,opt,name=cover_url,json=coverUrl,proto3" json:"cover_url,omitempty"`
+	// Time of the user's first purchase of this book
+	PurchasedAt   *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=purchased_at,json=purchasedAt,proto3" json:"purchased_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Purchase) Reset() {
+	*x = Purchase{}
+	mi := &file_entitlements_v1_entitlements_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Purchase) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Purchase) ProtoMessage() {}
+
+func (x *Purchase) ProtoReflect() protoreflect.Message {
+	mi := &file_entitlements_v1_entitlements_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Purchase.ProtoReflect.Descriptor instead.
+func (*Purchase) Descriptor() ([]byte, []int) {
+	return file_entitlements_v1_entitlements_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Purchase) GetSku() string {
+	if x != nil {
+		return x.Sku
+	}
+	return ""
+}
+
+func (x *Purchase) GetGutenbergId() int64 {
+	if x != nil {
+		return x.GutenbergId
+	}
+	return 0
+}
+
+func (x *Purchase) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Purchase) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+func (x *Purchase) GetCoverUrl() string {
+	if x != nil {
+		return x.CoverUrl
+	}
+	return ""
+}
+
+func (x *Purchase) GetPurchasedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.PurchasedAt
+	}
+	return nil
+}
+
+type WatchEntitlementsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        int64                  `protobuf:"varint,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEntitlementsRequest) Reset() {
+	*x = WatchEntitlementsRequest{}
+	mi := &file_entitlements_v1_entitlements_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEntitlementsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEntitlementsRequest) ProtoMessage() {}
+
+func (x *WatchEntitlementsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_entitlements_v1_entitlements_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEntitlementsRequest.ProtoReflect.Descriptor instead.
+func (*WatchEntitlementsRequest) Descriptor() ([]byte, []int) {
+	return file_entitlements_v1_entitlements_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *WatchEntitlementsRequest) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+type EntitlementEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          EntitlementEvent_Type  `protobuf:"varint,1,opt,name=type,proto3,enum=bookstore.entitlements.v1.EntitlementEvent_Type" json:"type,omitempty"`
+	UserId        int64                  `protobuf:"varint,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Sku           string                 `protobuf:"bytes,3,opt,name=sku,proto3" json:"sku,omitempty"`
+	OrderId       int64                  `protobuf:"varint,4,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	OccurredAt    *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=occurred_at,json=occurredAt,proto3" json:"occurred_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EntitlementEvent) Reset() {
+	*x = EntitlementEvent{}
+	mi := &file_entitlements_v1_entitlements_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EntitlementEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EntitlementEvent) ProtoMessage() {}
+
+func (x *EntitlementEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_entitlements_v1_entitlements_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EntitlementEvent.ProtoReflect.Descriptor instead.
+func (*EntitlementEvent) Descriptor() ([]byte, []int) {
+	return file_entitlements_v1_entitlements_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *EntitlementEvent) GetType() EntitlementEvent_Type {
+	if x != nil {
+		return x.Type
+	}
+	return EntitlementEvent_TYPE_UNSPECIFIED
+}
+
+func (x *EntitlementEvent) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *EntitlementEvent) GetSku() string {
+	if x != nil {
+		return x.Sku
+	}
+	return ""
+}
+
+func (x *EntitlementEvent) GetOrderId() int64 {
+	if x != nil {
+		return x.OrderId
+	}
+	return 0
+}
+
+func (x *EntitlementEvent) GetOccurredAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.OccurredAt
+	}
+	return nil
+}
+
+var File_entitlements_v1_entitlements_proto protoreflect.FileDescriptor
+
+const file_entitlements_v1_entitlements_proto_rawDesc = "" +
+	"\n" +
+	"\"entitlements/v1/entitlements.proto\x12\x19bookstore.entitlements.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"B\n" +
+	"\x15VerifyPurchaseRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\x03R\x06userId\x12\x10\n" +
+	"\x03sku\x18\x02 \x01(\tR\x03sku\".\n" +
+	"\x16VerifyPurchaseResponse\x12\x14\n" +
+	"\x05owned\x18\x01 \x01(\bR\x05owned\"/\n" +
+	"\x14ListPurchasesRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\x03R\x06userId\"Z\n" +
+	"\x15ListPurchasesResponse\x12A\n" +
+	"\tpurchases\x18\x01 \x03(\v2#.bookstore.entitlements.v1.PurchaseR\tpurchases\"\xc9\x01\n" +
+	"\bPurchase\x12\x10\n" +
+	"\x03sku\x18\x01 \x01(\tR\x03sku\x12!\n" +
+	"\fgutenberg_id\x18\x02 \x01(\x03R\vgutenbergId\x12\x14\n" +
+	"\x05title\x18\x03 \x01(\tR\x05title\x12\x16\n" +
+	"\x06author\x18\x04 \x01(\tR\x06author\x12\x1b\n" +
+	"\tcover_url\x18\x05 \x01(\tR\bcoverUrl\x12=\n" +
+	"\fpurchased_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\vpurchasedAt\"3\n" +
+	"\x18WatchEntitlementsRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\x03R\x06userId\"\x9d\x02\n" +
+	"\x10EntitlementEvent\x12D\n" +
+	"\x04type\x18\x01 \x01(\x0e20.bookstore.entitlements.v1.EntitlementEvent.TypeR\x04type\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\x03R\x06userId\x12\x10\n" +
+	"\x03sku\x18\x03 \x01(\tR\x03sku\x12\x19\n" +
+	"\border_id\x18\x04 \x01(\x03R\aorderId\x12;\n" +
+	"\voccurred_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"occurredAt\"@\n" +
+	"\x04Type\x12\x14\n" +
+	"\x10TYPE_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fTYPE_GRANTED\x10\x01\x12\x10\n" +
+	"\fTYPE_REVOKED\x10\x022\xf2\x02\n" +
+	"\fEntitlements\x12u\n" +
+	"\x0eVerifyPurchase\x120.bookstore.entitlements.v1.VerifyPurchaseRequest\x1a1.bookstore.entitlements.v1.VerifyPurchaseResponse\x12r\n" +
+	"\rListPurchases\x12/.bookstore.entitlements.v1.ListPurchasesRequest\x1a0.bookstore.entitlements.v1.ListPurchasesResponse\x12w\n" +
+	"\x11WatchEntitlements\x123.bookstore.entitlements.v1.WatchEntitlementsRequest\x1a+.bookstore.entitlements.v1.EntitlementEvent0\x01B=Z;DemoApp/internal/entitlements/entitlementsv1;entitlementsv1b\x06proto3"
+
+var (
+	file_entitlements_v1_entitlements_proto_rawDescOnce sync.Once
+	file_entitlements_v1_entitlements_proto_rawDescData []byte
+)
+
+func file_entitlements_v1_entitlements_proto_rawDescGZIP() []byte {
+	file_entitlements_v1_entitlements_proto_rawDescOnce.Do(func() {
+		file_entitlements_v1_entitlements_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_entitlements_v1_entitlements_proto_rawDesc), len(file_entitlements_v1_entitlements_proto_rawDesc)))
+	})
+	return file_entitlements_v1_entitlements_proto_rawDescData
+}
+
+var file_entitlements_v1_entitlements_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_entitlements_v1_entitlements_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_entitlements_v1_entitlements_proto_goTypes = []any{
+	(EntitlementEvent_Type)(0),       // 0: bookstore.entitlements.v1.EntitlementEvent.Type
+	(*VerifyPurchaseRequest)(nil),    // 1: bookstore.entitlements.v1.VerifyPurchaseRequest
+	(*VerifyPurchaseResponse)(nil),   // 2: bookstore.entitlements.v1.VerifyPurchaseResponse
+	(*ListPurchasesRequest)(nil),     // 3: bookstore.entitlements.v1.ListPurchasesRequest
+	(*ListPurchasesResponse)(nil),    // 4: bookstore.entitlements.v1.ListPurchasesResponse
+	(*Purchase)(nil),                 // 5: bookstore.entitlements.v1.Purchase
+	(*WatchEntitlementsRequest)(nil), // 6: bookstore.entitlements.v1.WatchEntitlementsRequest
+	(*EntitlementEvent)(nil),         // 7: bookstore.entitlements.v1.EntitlementEvent
+	(*timestamppb.Timestamp)(nil),    // 8: google.protobuf.Timestamp
+}
+var file_entitlements_v1_entitlements_proto_depIdxs = []int32{
+	5, // 0: bookstore.entitlements.v1.ListPurchasesResponse.purchases:type_name -> bookstore.entitlements.v1.Purchase
+	8, // 1: bookstore.entitlements.v1.Purchase.purchased_at:type_name -> google.protobuf.Timestamp
+	0, // 2: bookstore.entitlements.v1.EntitlementEvent.type:type_name -> bookstore.entitlements.v1.EntitlementEvent.Type
+	8, // 3: bookstore.entitlements.v1.EntitlementEvent.occurred_at:type_name -> google.protobuf.Timestamp
+	1, // 4: bookstore.entitlements.v1.Entitlements.VerifyPurchase:input_type -> bookstore.entitlements.v1.VerifyPurchaseRequest
+	3, // 5: bookstore.entitlements.v1.Entitlements.ListPurchases:input_type -> bookstore.entitlements.v1.ListPurchasesRequest
+	6, // 6: bookstore.entitlements.v1.Entitlements.WatchEntitlements:input_type -> bookstore.entitlements.v1.WatchEntitlementsRequest
+	2, // 7: bookstore.entitlements.v1.Entitlements.VerifyPurchase:output_type -> bookstore.entitlements.v1.VerifyPurchaseResponse
+	4, // 8: bookstore.entitlements.v1.Entitlements.ListPurchases:output_type -> bookstore.entitlements.v1.ListPurchasesResponse
+	7, // 9: bookstore.entitlements.v1.Entitlements.WatchEntitlements:output_type -> bookstore.entitlements.v1.EntitlementEvent
+	7, // [7:10] is the sub-list for method output_type
+	4, // [4:7] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_entitlements_v1_entitlements_proto_init() }
+func file_entitlements_v1_entitlements_proto_init() {
+	if File_entitlements_v1_entitlements_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_entitlements_v1_entitlements_proto_rawDesc), len(file_entitlements_v1_entitlements_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_entitlements_v1_entitlements_proto_goTypes,
+		DependencyIndexes: file_entitlements_v1_entitlements_proto_depIdxs,
+		EnumInfos:         file_entitlements_v1_entitlements_proto_enumTypes,
+		MessageInfos:      file_entitlements_v1_entitlements_proto_msgTypes,
+	}.Build()
+	File_entitlements_v1_entitlements_proto = out.File
+	file_entitlements_v1_entitlements_proto_goTypes = nil
+	file_entitlements_v1_entitlements_proto_depIdxs = nil
+}
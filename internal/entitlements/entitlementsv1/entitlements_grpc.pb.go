@@ -0,0 +1,218 @@
+// Entitlements service for the Reader app.
+//
+// Mirrors GET /api/purchases/{user_id} and GET /api/purchases/{user_id}/{sku}
+// with typed messages, and adds a stream of entitlement changes so the Reader
+// does not have to poll. Calls must carry "authorization: Bearer <API_TOKEN>"
+// metadata when the Bookstore is configured with API_TOKEN.
+//
+// Regenerate the Go code with: ./scripts/generate-proto.sh
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: entitlements/v1/entitlements.proto
+
+package entitlementsv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Entitlements_VerifyPurchase_FullMethodName    = "/bookstore.entitlements.v1.Entitlements/VerifyPurchase"
+	Entitlements_ListPurchases_FullMethodName     = "/bookstore.entitlements.v1.Entitlements/ListPurchases"
+	Entitlements_WatchEntitlements_FullMethodName = "/bookstore.entitlements.v1.Entitlements/WatchEntitlements"
+)
+
+// EntitlementsClient is the client API for Entitlements service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EntitlementsClient interface {
+	// VerifyPurchase reports whether a user owns a book.
+	VerifyPurchase(ctx context.Context, in *VerifyPurchaseRequest, opts ...grpc.CallOption) (*VerifyPurchaseResponse, error)
+	// ListPurchases returns every distinct book a user has purchased.
+	ListPurchases(ctx context.Context, in *ListPurchasesRequest, opts ...grpc.CallOption) (*ListPurchasesResponse, error)
+	// WatchEntitlements streams entitlement changes as orders are placed.
+	// Set user_id to receive only that user's changes, or 0 for all users.
+	WatchEntitlements(ctx context.Context, in *WatchEntitlementsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EntitlementEvent], error)
+}
+
+type entitlementsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEntitlementsClient(cc grpc.ClientConnInterface) EntitlementsClient {
+	return &entitlementsClient{cc}
+}
+
+func (c *entitlementsClient) VerifyPurchase(ctx context.Context, in *VerifyPurchaseRequest, opts ...grpc.CallOption) (*VerifyPurchaseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VerifyPurchaseResponse)
+	err := c.cc.Invoke(ctx, Entitlements_VerifyPurchase_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *entitlementsClient) ListPurchases(ctx context.Context, in *ListPurchasesRequest, opts ...grpc.CallOption) (*ListPurchasesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListPurchasesResponse)
+	err := c.cc.Invoke(ctx, Entitlements_ListPurchases_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *entitlementsClient) WatchEntitlements(ctx context.Context, in *WatchEntitlementsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EntitlementEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Entitlements_ServiceDesc.Streams[0], Entitlements_WatchEntitlements_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchEntitlementsRequest, EntitlementEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Entitlements_WatchEntitlementsClient = grpc.ServerStreamingClient[EntitlementEvent]
+
+// EntitlementsServer is the server API for Entitlements service.
+// All implementations must embed UnimplementedEntitlementsServer
+// for forward compatibility.
+type EntitlementsServer interface {
+	// VerifyPurchase reports whether a user owns a book.
+	VerifyPurchase(context.Context, *VerifyPurchaseRequest) (*VerifyPurchaseResponse, error)
+	// ListPurchases returns every distinct book a user has purchased.
+	ListPurchases(context.Context, *ListPurchasesRequest) (*ListPurchasesResponse, error)
+	// WatchEntitlements streams entitlement changes as orders are placed.
+	// Set user_id to receive only that user's changes, or 0 for all users.
+	WatchEntitlements(*WatchEntitlementsRequest, grpc.ServerStreamingServer[EntitlementEvent]) error
+	mustEmbedUnimplementedEntitlementsServer()
+}
+
+// UnimplementedEntitlementsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEntitlementsServer struct{}
+
+func (UnimplementedEntitlementsServer) VerifyPurchase(context.Context, *VerifyPurchaseRequest) (*VerifyPurchaseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VerifyPurchase not implemented")
+}
+func (UnimplementedEntitlementsServer) ListPurchases(context.Context, *ListPurchasesRequest) (*ListPurchasesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPurchases not implemented")
+}
+func (UnimplementedEntitlementsServer) WatchEntitlements(*WatchEntitlementsRequest, grpc.ServerStreamingServer[EntitlementEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEntitlements not implemented")
+}
+func (UnimplementedEntitlementsServer) mustEmbedUnimplementedEntitlementsServer() {}
+func (UnimplementedEntitlementsServer) testEmbeddedByValue()                      {}
+
+// UnsafeEntitlementsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EntitlementsServer will
+// result in compilation errors.
+type UnsafeEntitlementsServer interface {
+	mustEmbedUnimplementedEntitlementsServer()
+}
+
+func RegisterEntitlementsServer(s grpc.ServiceRegistrar, srv EntitlementsServer) {
+	// If the following call pancis, it indicates UnimplementedEntitlementsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Entitlements_ServiceDesc, srv)
+}
+
+func _Entitlements_VerifyPurchase_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyPurchaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EntitlementsServer).VerifyPurchase(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Entitlements_VerifyPurchase_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EntitlementsServer).VerifyPurchase(ctx, req.(*VerifyPurchaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Entitlements_ListPurchases_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPurchasesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EntitlementsServer).ListPurchases(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Entitlements_ListPurchases_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EntitlementsServer).ListPurchases(ctx, req.(*ListPurchasesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Entitlements_WatchEntitlements_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEntitlementsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EntitlementsServer).WatchEntitlements(m, &grpc.GenericServerStream[WatchEntitlementsRequest, EntitlementEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Entitlements_WatchEntitlementsServer = grpc.ServerStreamingServer[EntitlementEvent]
+
+// Entitlements_ServiceDesc is the grpc.ServiceDesc for Entitlements service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Entitlements_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "bookstore.entitlements.v1.Entitlements",
+	HandlerType: (*EntitlementsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "VerifyPurchase",
+			Handler:    _Entitlements_VerifyPurchase_Handler,
+		},
+		{
+			MethodName: "ListPurchases",
+			Handler:    _Entitlements_ListPurchases_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEntitlements",
+			Handler:       _Entitlements_WatchEntitlements_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "entitlements/v1/entitlements.proto",
+}
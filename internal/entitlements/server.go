@@ -0,0 +1,123 @@
+// Package entitlements serves the gRPC Entitlements service used by the Reader
+// app to check book ownership and follow new purchases as they happen.
+package entitlements
+
+import (
+	pb "DemoApp/internal/entitlements/entitlementsv1"
+	"DemoApp/internal/repository"
+	"context"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Server implements pb.EntitlementsServer on top of the OrderRepository
+// shared with the HTTP API
+type Server struct {
+	pb.UnimplementedEntitlementsServer
+	orders repository.OrderRepository
+	broker Broker
+}
+
+func NewServer(orders repository.OrderRepository, broker Broker) *Server {
+	return &Server{orders: orders, broker: broker}
+}
+
+// NewGRPCServer returns a grpc.Server with the Entitlements service registered
+// and API token auth applied to every call
+func NewGRPCServer(orders repository.OrderRepository, broker Broker, apiToken string) *grpc.Server {
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryAuthInterceptor(apiToken)),
+		grpc.StreamInterceptor(StreamAuthInterceptor(apiToken)),
+	)
+	pb.RegisterEntitlementsServer(s, NewServer(orders, broker))
+	return s
+}
+
+func (s *Server) VerifyPurchase(_ context.Context, req *pb.VerifyPurchaseRequest) (*pb.VerifyPurchaseResponse, error) {
+	if req.GetUserId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id required")
+	}
+	if req.GetSku() == "" {
+		return nil, status.Error(codes.InvalidArgument, "sku required")
+	}
+
+	owned, err := s.orders.VerifyPurchase(int(req.GetUserId()), req.GetSku())
+	if err != nil {
+		log.Printf("gRPC: error verifying purchase for user %d, sku %s: %v", req.GetUserId(), req.GetSku(), err)
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+	return &pb.VerifyPurchaseResponse{Owned: owned}, nil
+}
+
+func (s *Server) ListPurchases(_ context.Context, req *pb.ListPurchasesRequest) (*pb.ListPurchasesResponse, error) {
+	if req.GetUserId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id required")
+	}
+
+	purchases, err := s.orders.GetUserPurchases(int(req.GetUserId()))
+	if err != nil {
+		log.Printf("gRPC: error fetching purchases for user %d: %v", req.GetUserId(), err)
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+
+	resp := &pb.ListPurchasesResponse{Purchases: make([]*pb.Purchase, 0, len(purchases))}
+	for _, p := range purchases {
+		purchase := &pb.Purchase{
+			Sku:         p.SKU,
+			GutenbergId: int64(p.GutenbergID),
+			Title:       p.Title,
+			Author:      p.Author,
+			CoverUrl:    p.CoverURL,
+		}
+		if t, err := time.Parse(time.RFC3339, p.PurchasedAt); err == nil {
+			purchase.PurchasedAt = timestamppb.New(t)
+		}
+		resp.Purchases = append(resp.Purchases, purchase)
+	}
+	return resp, nil
+}
+
+func (s *Server) WatchEntitlements(req *pb.WatchEntitlementsRequest, stream pb.Entitlements_WatchEntitlementsServer) error {
+	ctx := stream.Context()
+	events, unsubscribe := s.broker.Subscribe(ctx)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return status.Error(codes.Unavailable, "entitlement events unavailable")
+			}
+			if req.GetUserId() != 0 && int64(event.UserID) != req.GetUserId() {
+				continue
+			}
+			if err := stream.Send(toProto(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func toProto(e Event) *pb.EntitlementEvent {
+	eventType := pb.EntitlementEvent_TYPE_UNSPECIFIED
+	switch e.Type {
+	case EventGranted:
+		eventType = pb.EntitlementEvent_TYPE_GRANTED
+	case EventRevoked:
+		eventType = pb.EntitlementEvent_TYPE_REVOKED
+	}
+	return &pb.EntitlementEvent{
+		Type:       eventType,
+		UserId:     int64(e.UserID),
+		Sku:        e.SKU,
+		OrderId:    int64(e.OrderID),
+		OccurredAt: timestamppb.New(e.OccurredAt),
+	}
+}
@@ -0,0 +1,139 @@
+package entitlements
+
+import (
+	pb "DemoApp/internal/entitlements/entitlementsv1"
+	"DemoApp/internal/models"
+	"DemoApp/internal/repository"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const testToken = "test-token"
+
+// fakeOrders owns BOOK-1342 for user 1
+type fakeOrders struct {
+	repository.OrderRepository
+}
+
+func (fakeOrders) VerifyPurchase(userID int, sku string) (bool, error) {
+	return userID == 1 && sku == "BOOK-1342", nil
+}
+
+func (fakeOrders) GetUserPurchases(userID int) ([]models.PurchasedBook, error) {
+	if userID != 1 {
+		return nil, nil
+	}
+	return []models.PurchasedBook{{
+		SKU: "BOOK-1342", GutenbergID: 1342, Title: "Pride and Prejudice",
+		Author: "Jane Austen", PurchasedAt: "2026-01-02T03:04:05Z",
+	}}, nil
+}
+
+func startServer(t *testing.T, broker Broker) pb.EntitlementsClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := NewGRPCServer(fakeOrders{}, broker, testToken)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewEntitlementsClient(conn)
+}
+
+func authed(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+testToken)
+}
+
+func TestVerifyAndListPurchases(t *testing.T) {
+	client := startServer(t, NewMemoryBroker())
+	ctx := authed(context.Background())
+
+	resp, err := client.VerifyPurchase(ctx, &pb.VerifyPurchaseRequest{UserId: 1, Sku: "BOOK-1342"})
+	if err != nil || !resp.GetOwned() {
+		t.Fatalf("expected owned, got %v, %v", resp, err)
+	}
+	resp, err = client.VerifyPurchase(ctx, &pb.VerifyPurchaseRequest{UserId: 2, Sku: "BOOK-1342"})
+	if err != nil || resp.GetOwned() {
+		t.Fatalf("expected not owned, got %v, %v", resp, err)
+	}
+
+	list, err := client.ListPurchases(ctx, &pb.ListPurchasesRequest{UserId: 1})
+	if err != nil {
+		t.Fatalf("ListPurchases failed: %v", err)
+	}
+	if len(list.GetPurchases()) != 1 || list.GetPurchases()[0].GetGutenbergId() != 1342 {
+		t.Fatalf("unexpected purchases: %v", list.GetPurchases())
+	}
+	if got := list.GetPurchases()[0].GetPurchasedAt().AsTime(); !got.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected purchased_at: %v", got)
+	}
+}
+
+func TestRejectsMissingToken(t *testing.T) {
+	client := startServer(t, NewMemoryBroker())
+
+	_, err := client.VerifyPurchase(context.Background(), &pb.VerifyPurchaseRequest{UserId: 1, Sku: "BOOK-1342"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated, got %v", err)
+	}
+
+	stream, err := client.WatchEntitlements(context.Background(), &pb.WatchEntitlementsRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated on stream, got %v", err)
+	}
+}
+
+func TestWatchEntitlementsFiltersByUser(t *testing.T) {
+	broker := NewMemoryBroker()
+	client := startServer(t, broker)
+
+	ctx, cancel := context.WithTimeout(authed(context.Background()), 5*time.Second)
+	defer cancel()
+	stream, err := client.WatchEntitlements(ctx, &pb.WatchEntitlementsRequest{UserId: 1})
+	if err != nil {
+		t.Fatalf("WatchEntitlements failed: %v", err)
+	}
+
+	// Wait for the server side subscription before publishing
+	for {
+		broker.mu.Lock()
+		n := len(broker.subs)
+		broker.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	sku, other := "BOOK-84", "BOOK-11"
+	user1, user2 := 1, 2
+	PublishOrder(ctx, broker, &models.Order{ID: 9, UserID: &user2, Items: []models.OrderItem{{Product: models.Product{SKU: &other}}}})
+	PublishOrder(ctx, broker, &models.Order{ID: 10, UserID: &user1, Items: []models.OrderItem{{Product: models.Product{SKU: &sku}}}})
+
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	if event.GetType() != pb.EntitlementEvent_TYPE_GRANTED || event.GetSku() != sku || event.GetOrderId() != 10 {
+		t.Errorf("unexpected event: %v", event)
+	}
+}
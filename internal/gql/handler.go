@@ -0,0 +1,41 @@
+// Package gql exposes products, reviews and orders over GraphQL so clients
+// like the Chatbot can fetch related data in a single round trip.
+package gql
+
+import (
+	"DemoApp/internal/apiauth"
+	"DemoApp/internal/repository"
+	_ "embed"
+	"fmt"
+	"net/http"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+)
+
+//go:embed schema.graphql
+var schemaSDL string
+
+// NewHandler parses the schema and returns an http.Handler serving POST /graphql.
+// Each request gets its own set of batch loaders backed by repo. Orders and
+// purchases are exposed for any user, so requests need the same service
+// token as /api/purchases.
+func NewHandler(repo repository.Repository, apiToken string) (http.Handler, error) {
+	schema, err := graphql.ParseSchema(schemaSDL, &Resolver{repo: repo},
+		graphql.MaxDepth(8),
+		graphql.MaxQueryLength(8192),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing GraphQL schema: %w", err)
+	}
+
+	relayHandler := &relay.Handler{Schema: schema}
+	return apiauth.Require(apiToken, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ctx := withLoaders(r.Context(), newLoaders(repo))
+		relayHandler.ServeHTTP(w, r.WithContext(ctx))
+	})), nil
+}
@@ -0,0 +1,274 @@
+package gql
+
+import (
+	"DemoApp/internal/models"
+	"DemoApp/internal/repository"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingRepo records how many times each batch method is called so the
+// test can assert that nested fields are resolved without N+1 queries.
+type countingRepo struct {
+	mu    sync.Mutex
+	calls map[string]int
+
+	products   []models.Product
+	categories []models.Category
+	reviews    map[int][]models.ReviewWithUser
+	orders     []models.Order
+}
+
+func (c *countingRepo) record(method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls[method]++
+}
+
+func (c *countingRepo) count(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[method]
+}
+
+func (c *countingRepo) Products() repository.ProductRepository                     { return &countingProducts{c: c} }
+func (c *countingRepo) Orders() repository.OrderRepository                         { return &countingOrders{c: c} }
+func (c *countingRepo) Cart() repository.CartRepository                            { return nil }
+func (c *countingRepo) Users() repository.UserRepository                           { return nil }
+func (c *countingRepo) Reviews() repository.ReviewRepository                       { return &countingReviews{c: c} }
+func (c *countingRepo) Webhooks() repository.WebhookRepository                     { return nil }
+func (c *countingRepo) Outbox() repository.OutboxRepository                        { return nil }
+func (c *countingRepo) Audit() repository.AuditRepository                          { return nil }
+func (c *countingRepo) PasswordResets() repository.PasswordResetRepository         { return nil }
+func (c *countingRepo) EmailVerifications() repository.EmailVerificationRepository { return nil }
+func (c *countingRepo) TwoFactor() repository.TwoFactorRepository                  { return nil }
+func (c *countingRepo) Passkeys() repository.PasskeyRepository                     { return nil }
+func (c *countingRepo) Sessions() repository.SessionRepository                     { return nil }
+func (c *countingRepo) Identities() repository.IdentityRepository                  { return nil }
+func (c *countingRepo) SearchRules() repository.SearchRulesRepository              { return nil }
+func (c *countingRepo) SearchAnalytics() repository.SearchAnalyticsRepository      { return nil }
+
+type countingProducts struct {
+	repository.ProductRepository
+	c *countingRepo
+}
+
+func (p *countingProducts) ListProducts() ([]models.Product, error) {
+	p.c.record("ListProducts")
+	return p.c.products, nil
+}
+
+func (p *countingProducts) GetProductsByIDs(ids []int) ([]models.Product, error) {
+	p.c.record("GetProductsByIDs")
+	var out []models.Product
+	for _, prod := range p.c.products {
+		for _, id := range ids {
+			if prod.ID == id {
+				out = append(out, prod)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (p *countingProducts) ListCategories() ([]models.Category, error) {
+	p.c.record("ListCategories")
+	return p.c.categories, nil
+}
+
+type countingReviews struct {
+	repository.ReviewRepository
+	c *countingRepo
+}
+
+func (r *countingReviews) GetReviewsByProductIDs(ids []int) (map[int][]models.ReviewWithUser, error) {
+	r.c.record("GetReviewsByProductIDs")
+	out := make(map[int][]models.ReviewWithUser)
+	for _, id := range ids {
+		out[id] = r.c.reviews[id]
+	}
+	return out, nil
+}
+
+func (r *countingReviews) GetProductRatings(ids []int) (map[int]*models.ProductRating, error) {
+	r.c.record("GetProductRatings")
+	out := make(map[int]*models.ProductRating)
+	for _, id := range ids {
+		rating := &models.ProductRating{ProductID: id, RatingCounts: map[int]int{}}
+		for _, rw := range r.c.reviews[id] {
+			rating.RatingCounts[rw.Rating]++
+			rating.TotalReviews++
+			rating.AverageRating += float64(rw.Rating)
+		}
+		if rating.TotalReviews > 0 {
+			rating.AverageRating /= float64(rating.TotalReviews)
+		}
+		out[id] = rating
+	}
+	return out, nil
+}
+
+type countingOrders struct {
+	repository.OrderRepository
+	c *countingRepo
+}
+
+func (o *countingOrders) GetOrdersByUserID(userID int) ([]models.Order, error) {
+	o.c.record("GetOrdersByUserID")
+	return o.c.orders, nil
+}
+
+func newCountingRepo() *countingRepo {
+	fiction := 1
+	repo := &countingRepo{
+		calls:      make(map[string]int),
+		categories: []models.Category{{ID: 1, Name: "Fiction"}},
+		reviews:    make(map[int][]models.ReviewWithUser),
+	}
+	for id := 1; id <= 10; id++ {
+		repo.products = append(repo.products, models.Product{ID: id, Name: "Book", Price: 9.99, CategoryID: &fiction, Status: "active"})
+		repo.reviews[id] = []models.ReviewWithUser{
+			{Review: models.Review{ID: id * 10, ProductID: id, Rating: 4, CreatedAt: time.Now()}, UserName: "Jane D."},
+			{Review: models.Review{ID: id*10 + 1, ProductID: id, Rating: 5, CreatedAt: time.Now()}, UserName: "John S."},
+		}
+	}
+	repo.orders = []models.Order{
+		{ID: 1, Status: "pending", Items: []models.OrderItem{{ProductID: 1, Quantity: 1}, {ProductID: 2, Quantity: 2}}},
+		{ID: 2, Status: "pending", Items: []models.OrderItem{{ProductID: 3, Quantity: 1}}},
+	}
+	return repo
+}
+
+// testToken is the service token the test handlers require
+const testToken = "test-token"
+
+func execQuery(t *testing.T, h http.Handler, query string) map[string]interface{} {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"query": query})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data   map[string]interface{}   `json:"data"`
+		Errors []map[string]interface{} `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if len(resp.Errors) > 0 {
+		t.Fatalf("unexpected GraphQL errors: %v", resp.Errors)
+	}
+	return resp.Data
+}
+
+// TestProductsBatchNestedFields verifies reviews, ratings and categories for a
+// list of products are each loaded with a single batch call
+func TestProductsBatchNestedFields(t *testing.T) {
+	repo := newCountingRepo()
+	h, err := NewHandler(repo, testToken)
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+
+	data := execQuery(t, h, `{
+		products(limit: 10) {
+			id
+			category { name }
+			rating { averageRating totalReviews }
+			reviews(limit: 1) { userName rating }
+		}
+	}`)
+
+	products := data["products"].([]interface{})
+	if len(products) != 10 {
+		t.Fatalf("expected 10 products, got %d", len(products))
+	}
+	first := products[0].(map[string]interface{})
+	if reviews := first["reviews"].([]interface{}); len(reviews) != 1 {
+		t.Errorf("expected reviews limit of 1, got %d", len(reviews))
+	}
+	if avg := first["rating"].(map[string]interface{})["averageRating"].(float64); avg != 4.5 {
+		t.Errorf("expected average rating 4.5, got %v", avg)
+	}
+
+	for _, method := range []string{"GetReviewsByProductIDs", "GetProductRatings", "ListCategories"} {
+		if n := repo.count(method); n != 1 {
+			t.Errorf("expected 1 call to %s, got %d", method, n)
+		}
+	}
+}
+
+// TestOrdersBatchProducts verifies order item products across all orders are
+// fetched in one batch, along with their nested reviews
+func TestOrdersBatchProducts(t *testing.T) {
+	repo := newCountingRepo()
+	h, err := NewHandler(repo, testToken)
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+
+	data := execQuery(t, h, `{
+		orders(userId: 7) {
+			id
+			items { quantity product { id reviews { rating } } }
+		}
+	}`)
+
+	if orders := data["orders"].([]interface{}); len(orders) != 2 {
+		t.Fatalf("expected 2 orders, got %d", len(orders))
+	}
+	for _, method := range []string{"GetProductsByIDs", "GetReviewsByProductIDs"} {
+		if n := repo.count(method); n != 1 {
+			t.Errorf("expected 1 call to %s, got %d", method, n)
+		}
+	}
+}
+
+// TestGraphQLRejectsGet verifies only POST is accepted
+func TestGraphQLRejectsGet(t *testing.T) {
+	h, err := NewHandler(newCountingRepo(), testToken)
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/graphql", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
+
+// TestGraphQLRequiresToken verifies another user's orders cannot be read
+// without the service token
+func TestGraphQLRequiresToken(t *testing.T) {
+	h, err := NewHandler(newCountingRepo(), testToken)
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+
+	for _, auth := range []string{"", "Bearer wrong-token"} {
+		body := `{"query": "{ orders(userId: 1) { id } }"}`
+		req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected 401, got %d", auth, rec.Code)
+		}
+	}
+}
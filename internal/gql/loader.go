@@ -0,0 +1,129 @@
+package gql
+
+import (
+	"DemoApp/internal/models"
+	"DemoApp/internal/repository"
+	"context"
+	"sync"
+)
+
+// loader batches lookups by key for the lifetime of one GraphQL request.
+//
+// Resolvers that produce lists Prime the keys their children will need; the
+// first Load then fetches every pending key in a single call and caches the
+// results, so a list of N products costs one query per field instead of N.
+type loader[K comparable, V any] struct {
+	mu      sync.Mutex
+	fetch   func(keys []K) (map[K]V, error)
+	pending map[K]struct{}
+	cache   map[K]V
+	loaded  map[K]bool
+}
+
+func newLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{
+		fetch:   fetch,
+		pending: make(map[K]struct{}),
+		cache:   make(map[K]V),
+		loaded:  make(map[K]bool),
+	}
+}
+
+// Prime registers keys to be fetched with the next batch
+func (l *loader[K, V]) Prime(keys ...K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, k := range keys {
+		if !l.loaded[k] {
+			l.pending[k] = struct{}{}
+		}
+	}
+}
+
+// Load returns the value for key, fetching it together with all primed keys
+// if it has not been loaded yet. ok is false if the fetch returned no value.
+func (l *loader[K, V]) Load(key K) (value V, ok bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.loaded[key] {
+		value, ok = l.cache[key]
+		return value, ok, nil
+	}
+
+	l.pending[key] = struct{}{}
+	keys := make([]K, 0, len(l.pending))
+	for k := range l.pending {
+		keys = append(keys, k)
+	}
+
+	results, err := l.fetch(keys)
+	if err != nil {
+		return value, false, err
+	}
+
+	l.pending = make(map[K]struct{})
+	for _, k := range keys {
+		l.loaded[k] = true
+		if v, found := results[k]; found {
+			l.cache[k] = v
+		}
+	}
+
+	value, ok = l.cache[key]
+	return value, ok, nil
+}
+
+// loaders holds the per-request batch loaders
+type loaders struct {
+	products   *loader[int, models.Product]
+	categories *loader[int, models.Category]
+	reviews    *loader[int, []models.ReviewWithUser]
+	ratings    *loader[int, *models.ProductRating]
+}
+
+func newLoaders(repo repository.Repository) *loaders {
+	l := &loaders{
+		reviews: newLoader(repo.Reviews().GetReviewsByProductIDs),
+		ratings: newLoader(repo.Reviews().GetProductRatings),
+	}
+	l.products = newLoader(func(ids []int) (map[int]models.Product, error) {
+		products, err := repo.Products().GetProductsByIDs(ids)
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[int]models.Product, len(products))
+		for _, p := range products {
+			byID[p.ID] = p
+			// Products loaded in a batch will usually have their own fields
+			// resolved next, so queue those lookups into the same batches
+			l.reviews.Prime(p.ID)
+			l.ratings.Prime(p.ID)
+		}
+		return byID, nil
+	})
+	// Categories are few and cached in Redis, so one batch fetches them all
+	l.categories = newLoader(func(_ []int) (map[int]models.Category, error) {
+		categories, err := repo.Products().ListCategories()
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[int]models.Category, len(categories))
+		for _, c := range categories {
+			byID[c.ID] = c
+		}
+		return byID, nil
+	})
+	return l
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	l, _ := ctx.Value(loadersKey{}).(*loaders)
+	return l
+}
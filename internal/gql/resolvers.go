@@ -0,0 +1,321 @@
+package gql
+
+import (
+	"DemoApp/internal/models"
+	"DemoApp/internal/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// errInternal is returned to clients instead of raw repository errors
+var errInternal = errors.New("internal server error")
+
+// Resolver is the root resolver for the Query type
+type Resolver struct {
+	repo repository.Repository
+}
+
+// Product resolves a single product by ID
+func (r *Resolver) Product(ctx context.Context, args struct{ ID graphql.ID }) (*productResolver, error) {
+	id, err := strconv.Atoi(string(args.ID))
+	if err != nil {
+		return nil, errors.New("invalid product id")
+	}
+
+	product, err := r.repo.Products().GetProductByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("GraphQL: error fetching product %d: %v", id, err)
+		return nil, errInternal
+	}
+
+	return newProductResolver(*product, loadersFrom(ctx)), nil
+}
+
+// Products resolves active products, optionally filtered by query and category name
+func (r *Resolver) Products(ctx context.Context, args struct {
+	Query    *string
+	Category *string
+	Limit    int32
+}) ([]*productResolver, error) {
+	query := ""
+	if args.Query != nil {
+		query = *args.Query
+	}
+
+	categoryID := 0
+	if args.Category != nil && *args.Category != "" {
+		categories, err := r.repo.Products().ListCategories()
+		if err != nil {
+			log.Printf("GraphQL: error fetching categories: %v", err)
+			return nil, errInternal
+		}
+		for _, c := range categories {
+			if strings.EqualFold(c.Name, *args.Category) {
+				categoryID = c.ID
+				break
+			}
+		}
+		if categoryID == 0 {
+			return []*productResolver{}, nil
+		}
+	}
+
+	var products []models.Product
+	var err error
+	if query != "" || categoryID > 0 {
+		products, err = r.repo.Products().SearchProducts(query, categoryID)
+	} else {
+		products, err = r.repo.Products().ListProducts()
+	}
+	if err != nil {
+		log.Printf("GraphQL: error fetching products: %v", err)
+		return nil, errInternal
+	}
+
+	if args.Limit >= 0 && int(args.Limit) < len(products) {
+		products = products[:args.Limit]
+	}
+
+	return newProductResolvers(products, loadersFrom(ctx)), nil
+}
+
+// Categories resolves all product categories
+func (r *Resolver) Categories() ([]*categoryResolver, error) {
+	categories, err := r.repo.Products().ListCategories()
+	if err != nil {
+		log.Printf("GraphQL: error fetching categories: %v", err)
+		return nil, errInternal
+	}
+
+	resolvers := make([]*categoryResolver, 0, len(categories))
+	for _, c := range categories {
+		resolvers = append(resolvers, &categoryResolver{c})
+	}
+	return resolvers, nil
+}
+
+// Purchases resolves the distinct books a user has purchased
+func (r *Resolver) Purchases(args struct{ UserID int32 }) ([]*purchaseResolver, error) {
+	purchases, err := r.repo.Orders().GetUserPurchases(int(args.UserID))
+	if err != nil {
+		log.Printf("GraphQL: error fetching purchases for user %d: %v", args.UserID, err)
+		return nil, errInternal
+	}
+
+	resolvers := make([]*purchaseResolver, 0, len(purchases))
+	for _, p := range purchases {
+		resolvers = append(resolvers, &purchaseResolver{p})
+	}
+	return resolvers, nil
+}
+
+// Orders resolves a user's orders, newest first
+func (r *Resolver) Orders(ctx context.Context, args struct{ UserID int32 }) ([]*orderResolver, error) {
+	orders, err := r.repo.Orders().GetOrdersByUserID(int(args.UserID))
+	if err != nil {
+		log.Printf("GraphQL: error fetching orders for user %d: %v", args.UserID, err)
+		return nil, errInternal
+	}
+
+	l := loadersFrom(ctx)
+	resolvers := make([]*orderResolver, 0, len(orders))
+	for _, o := range orders {
+		for _, item := range o.Items {
+			l.products.Prime(item.ProductID)
+		}
+		resolvers = append(resolvers, &orderResolver{order: o, loaders: l})
+	}
+	return resolvers, nil
+}
+
+// --- Product ---
+
+type productResolver struct {
+	p       models.Product
+	loaders *loaders
+}
+
+// newProductResolver wraps a product and primes the loaders for its child fields
+func newProductResolver(p models.Product, l *loaders) *productResolver {
+	l.reviews.Prime(p.ID)
+	l.ratings.Prime(p.ID)
+	if p.CategoryID != nil {
+		l.categories.Prime(*p.CategoryID)
+	}
+	return &productResolver{p: p, loaders: l}
+}
+
+func newProductResolvers(products []models.Product, l *loaders) []*productResolver {
+	resolvers := make([]*productResolver, 0, len(products))
+	for _, p := range products {
+		resolvers = append(resolvers, newProductResolver(p, l))
+	}
+	return resolvers
+}
+
+func (r *productResolver) ID() graphql.ID         { return graphql.ID(strconv.Itoa(r.p.ID)) }
+func (r *productResolver) Name() string           { return r.p.Name }
+func (r *productResolver) Description() string    { return r.p.Description }
+func (r *productResolver) Price() float64         { return r.p.Price }
+func (r *productResolver) SKU() *string           { return r.p.SKU }
+func (r *productResolver) StockQuantity() int32   { return int32(r.p.StockQuantity) }
+func (r *productResolver) ImageURL() *string      { return r.p.ImageURL }
+func (r *productResolver) Author() *string        { return r.p.Author }
+func (r *productResolver) PopularityScore() int32 { return int32(r.p.PopularityScore) }
+
+func (r *productResolver) Category() (*categoryResolver, error) {
+	if r.p.CategoryID == nil {
+		return nil, nil
+	}
+	c, ok, err := r.loaders.categories.Load(*r.p.CategoryID)
+	if err != nil {
+		log.Printf("GraphQL: error loading category %d: %v", *r.p.CategoryID, err)
+		return nil, errInternal
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &categoryResolver{c}, nil
+}
+
+func (r *productResolver) Rating() (*ratingResolver, error) {
+	rating, ok, err := r.loaders.ratings.Load(r.p.ID)
+	if err != nil {
+		log.Printf("GraphQL: error loading rating for product %d: %v", r.p.ID, err)
+		return nil, errInternal
+	}
+	if !ok || rating == nil {
+		rating = &models.ProductRating{ProductID: r.p.ID, RatingCounts: map[int]int{}}
+	}
+	return &ratingResolver{rating}, nil
+}
+
+func (r *productResolver) Reviews(args struct{ Limit *int32 }) ([]*reviewResolver, error) {
+	reviews, _, err := r.loaders.reviews.Load(r.p.ID)
+	if err != nil {
+		log.Printf("GraphQL: error loading reviews for product %d: %v", r.p.ID, err)
+		return nil, errInternal
+	}
+	if args.Limit != nil && *args.Limit >= 0 && int(*args.Limit) < len(reviews) {
+		reviews = reviews[:*args.Limit]
+	}
+
+	resolvers := make([]*reviewResolver, 0, len(reviews))
+	for _, rw := range reviews {
+		resolvers = append(resolvers, &reviewResolver{rw})
+	}
+	return resolvers, nil
+}
+
+// --- Category ---
+
+type categoryResolver struct {
+	c models.Category
+}
+
+func (r *categoryResolver) ID() graphql.ID       { return graphql.ID(strconv.Itoa(r.c.ID)) }
+func (r *categoryResolver) Name() string         { return r.c.Name }
+func (r *categoryResolver) Description() *string { return r.c.Description }
+
+// --- Rating ---
+
+type ratingResolver struct {
+	rating *models.ProductRating
+}
+
+func (r *ratingResolver) AverageRating() float64 { return r.rating.AverageRating }
+func (r *ratingResolver) TotalReviews() int32    { return int32(r.rating.TotalReviews) }
+
+// Counts returns one entry per star level, 5 down to 1
+func (r *ratingResolver) Counts() []*ratingCountResolver {
+	counts := make([]*ratingCountResolver, 0, 5)
+	for stars := 5; stars >= 1; stars-- {
+		counts = append(counts, &ratingCountResolver{stars: stars, count: r.rating.RatingCounts[stars]})
+	}
+	return counts
+}
+
+type ratingCountResolver struct {
+	stars int
+	count int
+}
+
+func (r *ratingCountResolver) Stars() int32 { return int32(r.stars) }
+func (r *ratingCountResolver) Count() int32 { return int32(r.count) }
+
+// --- Review ---
+
+type reviewResolver struct {
+	rw models.ReviewWithUser
+}
+
+func (r *reviewResolver) ID() graphql.ID    { return graphql.ID(strconv.Itoa(r.rw.ID)) }
+func (r *reviewResolver) Rating() int32     { return int32(r.rw.Rating) }
+func (r *reviewResolver) Title() string     { return r.rw.Title }
+func (r *reviewResolver) Comment() string   { return r.rw.Comment }
+func (r *reviewResolver) UserName() string  { return r.rw.UserName }
+func (r *reviewResolver) CreatedAt() string { return r.rw.CreatedAt.Format(time.RFC3339) }
+func (r *reviewResolver) UpdatedAt() string { return r.rw.UpdatedAt.Format(time.RFC3339) }
+
+// --- Purchase ---
+
+type purchaseResolver struct {
+	p models.PurchasedBook
+}
+
+func (r *purchaseResolver) SKU() string         { return r.p.SKU }
+func (r *purchaseResolver) GutenbergID() int32  { return int32(r.p.GutenbergID) }
+func (r *purchaseResolver) Title() string       { return r.p.Title }
+func (r *purchaseResolver) Author() string      { return r.p.Author }
+func (r *purchaseResolver) CoverURL() string    { return r.p.CoverURL }
+func (r *purchaseResolver) PurchasedAt() string { return r.p.PurchasedAt }
+
+// --- Order ---
+
+type orderResolver struct {
+	order   models.Order
+	loaders *loaders
+}
+
+func (r *orderResolver) ID() graphql.ID       { return graphql.ID(strconv.Itoa(r.order.ID)) }
+func (r *orderResolver) Status() string       { return r.order.Status }
+func (r *orderResolver) TotalAmount() float64 { return r.order.TotalAmount }
+func (r *orderResolver) CreatedAt() string    { return r.order.CreatedAt.Format(time.RFC3339) }
+
+func (r *orderResolver) Items() []*orderItemResolver {
+	items := make([]*orderItemResolver, 0, len(r.order.Items))
+	for _, item := range r.order.Items {
+		items = append(items, &orderItemResolver{item: item, loaders: r.loaders})
+	}
+	return items
+}
+
+type orderItemResolver struct {
+	item    models.OrderItem
+	loaders *loaders
+}
+
+func (r *orderItemResolver) Quantity() int32 { return int32(r.item.Quantity) }
+func (r *orderItemResolver) Price() float64  { return r.item.Price }
+
+func (r *orderItemResolver) Product() (*productResolver, error) {
+	p, ok, err := r.loaders.products.Load(r.item.ProductID)
+	if err != nil {
+		log.Printf("GraphQL: error loading product %d: %v", r.item.ProductID, err)
+		return nil, errInternal
+	}
+	if !ok {
+		return nil, nil
+	}
+	return newProductResolver(p, r.loaders), nil
+}
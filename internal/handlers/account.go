@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"DemoApp/internal/mail"
+	"DemoApp/internal/models"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// accountExport files are written in this order so the archive is stable
+var accountExportFiles = []string{"profile.json", "orders.json", "reviews.json", "cart.json", "searches.json"}
+
+type exportProfile struct {
+	ID              int                   `json:"id"`
+	Email           string                `json:"email"`
+	FullName        string                `json:"full_name"`
+	Role            string                `json:"role"`
+	EmailVerifiedAt *time.Time            `json:"email_verified_at"`
+	TwoFactor       bool                  `json:"two_factor_enabled"`
+	CreatedAt       time.Time             `json:"created_at"`
+	LinkedAccounts  []exportLinkedAccount `json:"linked_accounts"`
+	Passkeys        []exportPasskey       `json:"passkeys"`
+	Sessions        []exportSession       `json:"sessions"`
+}
+
+type exportLinkedAccount struct {
+	Provider    string     `json:"provider"`
+	Email       *string    `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+type exportPasskey struct {
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type exportSession struct {
+	Device     string    `json:"device"`
+	IP         string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+type exportOrder struct {
+	ID           int               `json:"id"`
+	Status       string            `json:"status"`
+	Total        float64           `json:"total"`
+	ShippingInfo json.RawMessage   `json:"shipping_info"`
+	CreatedAt    time.Time         `json:"created_at"`
+	Items        []exportOrderItem `json:"items"`
+}
+
+type exportOrderItem struct {
+	ProductID int     `json:"product_id"`
+	Title     string  `json:"title"`
+	Quantity  int     `json:"quantity"`
+	Price     float64 `json:"price"`
+}
+
+type exportCartItem struct {
+	ProductID int     `json:"product_id"`
+	Title     string  `json:"title"`
+	Quantity  int     `json:"quantity"`
+	Price     float64 `json:"price"`
+}
+
+type exportSearch struct {
+	Query          string               `json:"query"`
+	CorrectedQuery string               `json:"corrected_query,omitempty"`
+	Filters        models.SearchFilters `json:"filters"`
+	ResultCount    int                  `json:"result_count"`
+	CreatedAt      time.Time            `json:"created_at"`
+}
+
+// collectAccountData gathers everything stored about userID, keyed by the
+// file it is exported as
+func (h *Handlers) collectAccountData(userID int) (map[string]interface{}, error) {
+	user, err := h.Repo.Users().GetUserByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching user: %w", err)
+	}
+	profile := exportProfile{
+		ID:              user.ID,
+		Email:           user.Email,
+		Role:            user.Role,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		TwoFactor:       user.TwoFactorEnabled,
+		CreatedAt:       user.CreatedAt,
+	}
+	if user.FullName != nil {
+		profile.FullName = *user.FullName
+	}
+
+	identities, err := h.Repo.Identities().ListIdentities(userID)
+	if err != nil {
+		return nil, fmt.Errorf("listing linked accounts: %w", err)
+	}
+	for _, id := range identities {
+		profile.LinkedAccounts = append(profile.LinkedAccounts, exportLinkedAccount{
+			Provider: id.Provider, Email: id.Email, CreatedAt: id.CreatedAt, LastLoginAt: id.LastLoginAt,
+		})
+	}
+	passkeys, err := h.Repo.Passkeys().ListPasskeys(userID)
+	if err != nil {
+		return nil, fmt.Errorf("listing passkeys: %w", err)
+	}
+	for _, p := range passkeys {
+		profile.Passkeys = append(profile.Passkeys, exportPasskey{Name: p.Name, CreatedAt: p.CreatedAt, LastUsedAt: p.LastUsedAt})
+	}
+	sessions, err := h.Repo.Sessions().ListSessions(userID)
+	if err != nil {
+		return nil, fmt.Errorf("listing sessions: %w", err)
+	}
+	for _, s := range sessions {
+		profile.Sessions = append(profile.Sessions, exportSession{Device: s.Device(), IP: s.IP, CreatedAt: s.CreatedAt, LastSeenAt: s.LastSeenAt})
+	}
+
+	orders, err := h.Repo.Orders().GetOrdersByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("listing orders: %w", err)
+	}
+	exportedOrders := make([]exportOrder, 0, len(orders))
+	for _, o := range orders {
+		order := exportOrder{ID: o.ID, Status: o.Status, Total: o.TotalAmount, CreatedAt: o.CreatedAt, Items: []exportOrderItem{}}
+		if o.ShippingInfo != nil {
+			order.ShippingInfo = json.RawMessage(*o.ShippingInfo)
+		}
+		for _, item := range o.Items {
+			order.Items = append(order.Items, exportOrderItem{
+				ProductID: item.ProductID, Title: item.Product.Name, Quantity: item.Quantity, Price: item.Price,
+			})
+		}
+		exportedOrders = append(exportedOrders, order)
+	}
+
+	reviews, err := h.Repo.Reviews().GetReviewsByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("listing reviews: %w", err)
+	}
+	if reviews == nil {
+		reviews = []models.Review{}
+	}
+
+	cartItems, _, err := h.Repo.Cart().GetCartItems(userID, "")
+	if err != nil {
+		return nil, fmt.Errorf("listing cart: %w", err)
+	}
+	cart := make([]exportCartItem, 0, len(cartItems))
+	for _, item := range cartItems {
+		cart = append(cart, exportCartItem{
+			ProductID: item.ProductID, Title: item.Product.Name, Quantity: item.Quantity, Price: item.Product.Price,
+		})
+	}
+
+	searchEvents, err := h.Repo.SearchAnalytics().ListUserSearches(userID)
+	if err != nil {
+		return nil, fmt.Errorf("listing searches: %w", err)
+	}
+	searches := make([]exportSearch, 0, len(searchEvents))
+	for _, e := range searchEvents {
+		searches = append(searches, exportSearch{
+			Query: e.Query, CorrectedQuery: e.CorrectedQuery, Filters: e.Filters, ResultCount: e.ResultCount, CreatedAt: e.CreatedAt,
+		})
+	}
+
+	return map[string]interface{}{
+		"profile.json":  profile,
+		"orders.json":   exportedOrders,
+		"reviews.json":  reviews,
+		"cart.json":     cart,
+		"searches.json": searches,
+	}, nil
+}
+
+// writeAccountExport zips data as one indented JSON file per entry
+func writeAccountExport(data map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range accountExportFiles {
+		f, err := zw.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportAccount downloads a ZIP of the user's profile, orders, reviews, cart
+// and search history as JSON files
+// POST /profile/export
+func (h *Handlers) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.GetUserID(r)
+	if !authenticated {
+		http.Redirect(w, r, "/login?next=/profile", http.StatusFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/profile", http.StatusFound)
+		return
+	}
+
+	data, err := h.collectAccountData(userID)
+	if err != nil {
+		log.Printf("Error exporting data for user %d: %v", userID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	archive, err := writeAccountExport(data)
+	if err != nil {
+		log.Printf("Error writing export for user %d: %v", userID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(models.AuditEntry{UserID: &userID, Event: models.AuditAccountExported, IP: h.clientIP(r)})
+
+	filename := fmt.Sprintf("bookstore-data-%s.zip", time.Now().UTC().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := w.Write(archive); err != nil {
+		log.Printf("Error sending export: %v", err)
+	}
+}
+
+// DeleteAccountPage asks the user to confirm erasing their account
+func (h *Handlers) DeleteAccountPage(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.GetUserID(r)
+	if !authenticated {
+		http.Redirect(w, r, "/login?next=/profile/delete", http.StatusFound)
+		return
+	}
+
+	user, err := h.Repo.Users().GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error fetching user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	data := ProfileViewData{
+		IsAuthenticated:   true,
+		ReaderBrowserURL:  h.ReaderBrowserURL,
+		ChatbotBrowserURL: h.ChatbotBrowserURL,
+		User:              user,
+		Error:             r.URL.Query().Get("error"),
+	}
+
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/profile-delete.html")
+	if err != nil {
+		log.Printf("Error parsing template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := ts.ExecuteTemplate(w, "profile-delete.html", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// DeleteAccount erases the account after the user proves it is theirs
+// again: their password, or their email address for accounts without one,
+// plus a two-factor code when enrolled. Orders are kept anonymized.
+func (h *Handlers) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.GetUserID(r)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/profile/delete", http.StatusFound)
+		return
+	}
+
+	user, err := h.Repo.Users().GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error fetching user: %v", err)
+		http.Redirect(w, r, "/profile/delete?error=Could+not+verify+user", http.StatusFound)
+		return
+	}
+	if user.IsAdmin() {
+		http.Redirect(w, r, "/profile/delete?error=Administrator+accounts+must+be+removed+by+another+administrator", http.StatusFound)
+		return
+	}
+
+	if user.HasPassword() {
+		if _, msg, ok := h.checkLogin(r, user.Email); !ok {
+			http.Redirect(w, r, "/profile/delete?error="+url.QueryEscape(msg), http.StatusFound)
+			return
+		}
+		if !user.CheckPassword(r.FormValue("password")) {
+			h.recordLoginFailure(r, user.Email, user)
+			http.Redirect(w, r, "/profile/delete?error=Password+is+incorrect", http.StatusFound)
+			return
+		}
+	} else if !strings.EqualFold(strings.TrimSpace(r.FormValue("confirm_email")), user.Email) {
+		http.Redirect(w, r, "/profile/delete?error=Type+your+email+address+to+confirm", http.StatusFound)
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		tf, err := h.Repo.TwoFactor().GetTwoFactor(userID)
+		if err != nil {
+			log.Printf("Error fetching two-factor settings: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if tf != nil {
+			_, ok, err := h.verifySecondFactor(tf, r.FormValue("code"))
+			if err != nil {
+				log.Printf("Error verifying two-factor code: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				http.Redirect(w, r, "/profile/delete?error=That+code+is+not+valid", http.StatusFound)
+				return
+			}
+		}
+	}
+
+	if err := h.Repo.Users().DeleteAccount(userID); err != nil {
+		log.Printf("Error deleting account %d: %v", userID, err)
+		http.Redirect(w, r, "/profile/delete?error=Could+not+delete+your+account.+Please+try+again", http.StatusFound)
+		return
+	}
+
+	// The user row is gone, so the entry records the former ID only
+	h.audit(models.AuditEntry{Event: models.AuditAccountDeleted, IP: h.clientIP(r), Details: map[string]interface{}{
+		"user_id": userID,
+	}})
+	go h.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Your Bookstore account has been deleted",
+		Body: "Your Bookstore account and its personal data have been deleted, and you have been signed out everywhere.\n\n" +
+			"Records of past orders are kept without your name or contact details, as required for our accounts.\n",
+	})
+
+	// Other devices are signed out by TrackSessions now their sessions are gone
+	session, _ := h.Store.Get(r, "cart-session")
+	if err := h.endSession(w, r, session); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+	http.Redirect(w, r, "/login?deleted=1", http.StatusFound)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+// TestWriteAccountExport checks the archive has one readable JSON file per
+// section, in a fixed order
+func TestWriteAccountExport(t *testing.T) {
+	data := map[string]interface{}{
+		"profile.json":  exportProfile{ID: 7, Email: "reader@example.com"},
+		"orders.json":   []exportOrder{{ID: 1, Status: "paid", Total: 12.29, ShippingInfo: json.RawMessage(`{"city":"Bath"}`), Items: []exportOrderItem{{ProductID: 1, Title: "Pride and Prejudice", Quantity: 1, Price: 12.29}}}},
+		"reviews.json":  []interface{}{},
+		"cart.json":     []exportCartItem{},
+		"searches.json": []exportSearch{{Query: "austen", ResultCount: 6}},
+	}
+	archive, err := writeAccountExport(data)
+	if err != nil {
+		t.Fatalf("writeAccountExport failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("export is not a zip: %v", err)
+	}
+	if len(zr.File) != len(accountExportFiles) {
+		t.Fatalf("expected %d files, got %d", len(accountExportFiles), len(zr.File))
+	}
+	for i, f := range zr.File {
+		if f.Name != accountExportFiles[i] {
+			t.Errorf("file %d is %s, want %s", i, f.Name, accountExportFiles[i])
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			t.Errorf("%s is not valid JSON: %v", f.Name, err)
+		}
+		if f.Name == "profile.json" {
+			if email, _ := v.(map[string]interface{})["email"].(string); email != "reader@example.com" {
+				t.Errorf("profile.json has email %q", email)
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// RequireAdmin wraps an admin handler so only signed-in users with the
+// 'admin' role and two-factor authentication turned on can reach it
+func (h *Handlers) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := h.GetUserID(r)
+		if !ok {
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.Path), http.StatusFound)
+			return
+		}
+
+		user, err := h.Repo.Users().GetUserByID(userID)
+		if err != nil {
+			log.Printf("Error fetching user %d for admin check: %v", userID, err)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if !user.IsAdmin() {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if !user.TwoFactorEnabled {
+			http.Redirect(w, r, "/profile/2fa?error="+url.QueryEscape("Administrators must turn on two-factor authentication to use admin pages."), http.StatusFound)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"DemoApp/internal/models"
+	"DemoApp/internal/webhooks"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// deliveryLogLimit is how many recent deliveries the admin page shows
+const deliveryLogLimit = 100
+
+type AdminWebhooksViewData struct {
+	IsAuthenticated   bool
+	ReaderBrowserURL  string
+	ChatbotBrowserURL string
+	Subscribers       []models.WebhookSubscriber
+	Deliveries        []models.WebhookDelivery
+	EventTypes        []string
+	NewSecret         string // Shown once after creating a subscriber
+	Error             string
+}
+
+// AdminWebhooks lists webhook subscribers and the delivery log
+// GET /admin/webhooks (POST registers a subscriber)
+func (h *Handlers) AdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		h.AdminCreateWebhook(w, r)
+		return
+	}
+	h.renderAdminWebhooks(w, r, "", "")
+}
+
+func (h *Handlers) renderAdminWebhooks(w http.ResponseWriter, r *http.Request, newSecret, errMsg string) {
+	subscribers, err := h.Repo.Webhooks().ListSubscribers()
+	if err != nil {
+		log.Printf("Error listing webhook subscribers: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	deliveries, err := h.Repo.Webhooks().ListDeliveries(deliveryLogLimit)
+	if err != nil {
+		log.Printf("Error listing webhook deliveries: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := AdminWebhooksViewData{
+		IsAuthenticated:   true,
+		ReaderBrowserURL:  h.ReaderBrowserURL,
+		ChatbotBrowserURL: h.ChatbotBrowserURL,
+		Subscribers:       subscribers,
+		Deliveries:        deliveries,
+		EventTypes:        webhooks.EventTypes,
+		NewSecret:         newSecret,
+		Error:             errMsg,
+	}
+
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/admin-webhooks.html")
+	if err != nil {
+		log.Printf("Error parsing template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := ts.ExecuteTemplate(w, "admin-webhooks.html", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// AdminCreateWebhook registers a subscriber and shows its signing secret once.
+// A secret is generated when none is given.
+// POST /admin/webhooks
+func (h *Handlers) AdminCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	endpoint := r.FormValue("url")
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		h.renderAdminWebhooks(w, r, "", "URL must be an absolute http(s) URL")
+		return
+	}
+
+	secret := r.FormValue("secret")
+	if secret == "" {
+		secret, err = webhooks.NewSecret()
+		if err != nil {
+			log.Printf("Error generating webhook secret: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var events []string
+	for _, e := range r.Form["events"] {
+		for _, known := range webhooks.EventTypes {
+			if e == known {
+				events = append(events, e)
+			}
+		}
+	}
+
+	if _, err := h.Repo.Webhooks().CreateSubscriber(endpoint, secret, events); err != nil {
+		log.Printf("Error creating webhook subscriber: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Render rather than redirect so the secret never lands in a URL
+	h.renderAdminWebhooks(w, r, secret, "")
+}
+
+// AdminToggleWebhook pauses or resumes a subscriber
+// POST /admin/webhooks/{id}/toggle
+func (h *Handlers) AdminToggleWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminPostID(w, r)
+	if !ok {
+		return
+	}
+	active := r.FormValue("active") == "true"
+	if err := h.Repo.Webhooks().SetSubscriberActive(id, active); err != nil {
+		log.Printf("Error updating webhook subscriber %d: %v", id, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// AdminDeleteWebhook removes a subscriber and its delivery log
+// POST /admin/webhooks/{id}/delete
+func (h *Handlers) AdminDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminPostID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Repo.Webhooks().DeleteSubscriber(id); err != nil {
+		log.Printf("Error deleting webhook subscriber %d: %v", id, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// AdminRetryDelivery queues a delivery to be sent again straight away
+// POST /admin/webhooks/deliveries/{id}/retry
+func (h *Handlers) AdminRetryDelivery(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminPostID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Repo.Webhooks().RetryDelivery(id); err != nil {
+		log.Printf("Error retrying webhook delivery %d: %v", id, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// adminPostID checks the request is a POST and parses the {id} path value
+func adminPostID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return 0, false
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"DemoApp/internal/models"
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -15,6 +17,8 @@ import (
 type AuthRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// Code is a TOTP or recovery code, required for accounts with two-factor authentication
+	Code string `json:"code,omitempty"`
 }
 
 // AuthResponse is the JSON response for successful API authentication
@@ -43,18 +47,52 @@ func (h *Handlers) APIAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Same throttling and lockout as the login form
+	if retryAfter, _, ok := h.checkLogin(r, req.Email); !ok {
+		w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+		http.Error(w, "Too many failed attempts", http.StatusTooManyRequests)
+		return
+	}
+
 	// Validate credentials
 	user, err := h.Repo.Users().GetUserByEmail(req.Email)
 	if err != nil || user == nil {
+		h.recordLoginFailure(r, req.Email, nil)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
 	if !user.CheckPassword(req.Password) {
+		h.recordLoginFailure(r, req.Email, user)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
+	if user.TwoFactorEnabled {
+		if req.Code == "" {
+			http.Error(w, "Two-factor code required", http.StatusUnauthorized)
+			return
+		}
+		tf, err := h.Repo.TwoFactor().GetTwoFactor(user.ID)
+		if err != nil {
+			log.Printf("Error fetching two-factor settings: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if tf != nil {
+			if _, ok, err := h.verifySecondFactor(tf, req.Code); err != nil {
+				log.Printf("Error verifying two-factor code: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			} else if !ok {
+				h.recordLoginFailure(r, req.Email, user)
+				http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+				return
+			}
+		}
+	}
+	h.recordLoginSuccess(r, req.Email)
+
 	// Return user info
 	response := AuthResponse{
 		UserID: user.ID,
@@ -85,15 +123,7 @@ type PurchaseItem struct {
 // GetUserPurchases returns all books purchased by a user
 // GET /api/purchases/{user_id}
 func (h *Handlers) GetUserPurchases(w http.ResponseWriter, r *http.Request) {
-	// Extract user_id from path: /api/purchases/{user_id}
-	path := strings.TrimPrefix(r.URL.Path, "/api/purchases/")
-	parts := strings.Split(path, "/")
-	if len(parts) == 0 || parts[0] == "" {
-		http.Error(w, "user_id required", http.StatusBadRequest)
-		return
-	}
-
-	userID, err := strconv.Atoi(parts[0])
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
 	if err != nil {
 		http.Error(w, "invalid user_id", http.StatusBadRequest)
 		return
@@ -127,25 +157,22 @@ func (h *Handlers) GetUserPurchases(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// VerifyPurchaseResponse is the JSON response when a user owns a book
+type VerifyPurchaseResponse struct {
+	Owned bool `json:"owned"`
+}
+
 // VerifyPurchase checks if a user owns a specific book
 // GET /api/purchases/{user_id}/{sku}
 // Returns 200 OK if owned, 404 Not Found if not owned
 func (h *Handlers) VerifyPurchase(w http.ResponseWriter, r *http.Request) {
-	// Extract user_id and sku from path: /api/purchases/{user_id}/{sku}
-	path := strings.TrimPrefix(r.URL.Path, "/api/purchases/")
-	parts := strings.Split(path, "/")
-	if len(parts) < 2 {
-		http.Error(w, "user_id and sku required", http.StatusBadRequest)
-		return
-	}
-
-	userID, err := strconv.Atoi(parts[0])
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
 	if err != nil {
 		http.Error(w, "invalid user_id", http.StatusBadRequest)
 		return
 	}
 
-	sku := parts[1]
+	sku := r.PathValue("sku")
 	if sku == "" {
 		http.Error(w, "sku required", http.StatusBadRequest)
 		return
@@ -164,50 +191,32 @@ func (h *Handlers) VerifyPurchase(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(`{"owned": true}`))
+	if err := json.NewEncoder(w).Encode(VerifyPurchaseResponse{Owned: true}); err != nil {
+		log.Printf("Error encoding verify purchase response: %v", err)
+	}
 }
 
 // APIProducts returns products as JSON for chatbot integration
 // GET /api/products - list all products
-// GET /api/products?category=Fiction - filter by category name
-// GET /api/products/search?q=shakespeare - search products
+// GET /api/products?category=Fiction&author=...&price=5-10&rating=4-up&in_stock=1 - filter by facets
 func (h *Handlers) APIProducts(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Check if this is a search request
-	if strings.HasPrefix(r.URL.Path, "/api/products/search") {
-		h.APISearchProducts(w, r)
+	filters, err := h.apiSearchFilters(r)
+	if err != nil {
+		log.Printf("Error fetching categories: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// Get category filter if provided
-	categoryName := r.URL.Query().Get("category")
-	var categoryID int
-
-	if categoryName != "" {
-		// Look up category by name
-		categories, err := h.Repo.Products().ListCategories()
-		if err != nil {
-			log.Printf("Error fetching categories: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-		for _, c := range categories {
-			if strings.EqualFold(c.Name, categoryName) {
-				categoryID = c.ID
-				break
-			}
-		}
-	}
-
-	var products interface{}
-	var err error
-
-	if categoryID > 0 {
-		products, err = h.Repo.Products().SearchProducts("", categoryID)
-	} else {
+	var products []models.Product
+	if filters.IsEmpty() {
 		products, err = h.Repo.Products().ListProducts()
+	} else {
+		var result *models.SearchResult
+		if result, err = h.searchAllProducts(r.Context(), "", filters, "name"); err == nil {
+			products = result.Products()
+		}
 	}
 
 	if err != nil {
@@ -221,8 +230,43 @@ func (h *Handlers) APIProducts(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// APISearchProducts searches products by query string
-// GET /api/products/search?q=shakespeare
+// apiSearchFilters reads facet filters from the query like parseSearchFilters,
+// except that categories are given by name (case-insensitive). Unknown
+// category names are ignored.
+func (h *Handlers) apiSearchFilters(r *http.Request) (models.SearchFilters, error) {
+	values := r.URL.Query()
+	names := values["category"]
+	values.Del("category")
+	filters := parseSearchFilters(values)
+	if len(names) == 0 {
+		return filters, nil
+	}
+
+	categories, err := h.Repo.Products().ListCategories()
+	if err != nil {
+		return filters, err
+	}
+	for _, name := range names {
+		for _, c := range categories {
+			if strings.EqualFold(c.Name, name) {
+				filters.CategoryIDs = append(filters.CategoryIDs, c.ID)
+				break
+			}
+		}
+	}
+	return filters, nil
+}
+
+// searchAllProducts returns the first page of the largest size a faceted
+// search allows, which covers the API's unpaginated responses
+func (h *Handlers) searchAllProducts(ctx context.Context, query string, filters models.SearchFilters, sortBy string) (*models.SearchResult, error) {
+	return h.Repo.Products().SearchProductsFaceted(ctx, query, filters, 1, 100, sortBy)
+}
+
+// APISearchProducts searches products by query string, returning each with
+// highlighted fragments showing what matched
+// GET /api/products/search?q=shakespeare, optionally with the facet filters of
+// /api/products and mode=hybrid to also match by meaning
 func (h *Handlers) APISearchProducts(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 	if query == "" {
@@ -230,7 +274,14 @@ func (h *Handlers) APISearchProducts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	products, err := h.Repo.Products().SearchProducts(query, 0)
+	filters, err := h.apiSearchFilters(r)
+	if err != nil {
+		log.Printf("Error fetching categories: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := h.searchAllProducts(r.Context(), query, filters, "")
 	if err != nil {
 		log.Printf("Error searching products: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -238,11 +289,62 @@ func (h *Handlers) APISearchProducts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(products); err != nil {
+	if err := json.NewEncoder(w).Encode(result.Hits); err != nil {
 		log.Printf("Error encoding search response: %v", err)
 	}
 }
 
+// APIProductFacets returns facet counts for a search, each facet counted
+// with every filter but its own
+// GET /api/products/facets?q=shakespeare&category=Fiction
+func (h *Handlers) APIProductFacets(w http.ResponseWriter, r *http.Request) {
+	filters, err := h.apiSearchFilters(r)
+	if err != nil {
+		log.Printf("Error fetching categories: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := h.Repo.Products().SearchProductsFaceted(r.Context(), r.URL.Query().Get("q"), filters, 1, 1, "")
+	if err != nil {
+		log.Printf("Error fetching facets: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result.Facets); err != nil {
+		log.Printf("Error encoding facets response: %v", err)
+	}
+}
+
+// APISuggestProducts returns titles, authors and categories completing a
+// partly typed query, for search-as-you-type
+// GET /api/products/suggest?q=shak&limit=5
+func (h *Handlers) APISuggestProducts(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "query parameter 'q' required", http.StatusBadRequest)
+		return
+	}
+	limit := suggestionLimit
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 20 {
+		limit = l
+	}
+
+	suggestions, err := h.Repo.Products().SuggestCompletions(query, limit)
+	if err != nil {
+		log.Printf("Error suggesting completions: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(suggestions); err != nil {
+		log.Printf("Error encoding suggestions response: %v", err)
+	}
+}
+
 // APICategories returns all categories as JSON
 // GET /api/categories
 func (h *Handlers) APICategories(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"DemoApp/internal/apiauth"
+	"net/http"
+)
+
+// APIRoute is one operation of the JSON API. Pattern is a ServeMux pattern
+// of method and path, with the path parameters named as in openapi.json.
+type APIRoute struct {
+	Pattern string
+	Handler http.Handler
+}
+
+// APIRoutes returns every operation of the JSON API, with the purchase
+// endpoints behind the service token. main mounts exactly these, and
+// openapi_test.go fails if any is missing from openapi.json or the spec
+// documents one that is not here.
+func (h *Handlers) APIRoutes(apiToken string) []APIRoute {
+	return []APIRoute{
+		{"POST /api/auth", http.HandlerFunc(h.APIAuth)},
+		{"GET /api/purchases/{user_id}", apiauth.Require(apiToken, http.HandlerFunc(h.GetUserPurchases))},
+		{"GET /api/purchases/{user_id}/{sku}", apiauth.Require(apiToken, http.HandlerFunc(h.VerifyPurchase))},
+		{"GET /api/products", http.HandlerFunc(h.APIProducts)},
+		{"GET /api/products/search", http.HandlerFunc(h.APISearchProducts)},
+		{"GET /api/products/facets", http.HandlerFunc(h.APIProductFacets)},
+		{"GET /api/products/suggest", http.HandlerFunc(h.APISuggestProducts)},
+		{"GET /api/categories", http.HandlerFunc(h.APICategories)},
+	}
+}
@@ -2,12 +2,15 @@ package handlers
 
 import (
 	"DemoApp/internal/models"
+	"DemoApp/internal/sessionstore"
 	"fmt"
-	"html/template"
 	"log"
 	"net/http"
+	"net/mail"
 	"strings"
 	"unicode"
+
+	"github.com/gorilla/sessions"
 )
 
 type LoginPageData struct {
@@ -15,7 +18,10 @@ type LoginPageData struct {
 	ReaderBrowserURL  string
 	ChatbotBrowserURL string
 	Error             string
+	Success           string
 	Next              string
+	PasskeysEnabled   bool
+	IdentityProviders []IdentityProviderLink
 }
 
 type SignupPageData struct {
@@ -25,6 +31,7 @@ type SignupPageData struct {
 	PasswordHelp      string
 	Error             string
 	Next              string
+	IdentityProviders []IdentityProviderLink
 }
 
 func (h *Handlers) SignupPage(w http.ResponseWriter, r *http.Request) {
@@ -33,9 +40,10 @@ func (h *Handlers) SignupPage(w http.ResponseWriter, r *http.Request) {
 		ReaderBrowserURL:  h.ReaderBrowserURL,
 		ChatbotBrowserURL: h.ChatbotBrowserURL,
 		PasswordHelp:      "Password must be at least 8 characters long and contain at least one letter and one number.",
-		Next:              r.URL.Query().Get("next"),
+		Next:              h.safeNext(r.URL.Query().Get("next")),
+		IdentityProviders: h.identityProviderLinks(),
 	}
-	ts, err := template.ParseFiles("./templates/base.html", "./templates/signup.html")
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/signup.html")
 	if err != nil {
 		log.Printf("Error parsing template: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -47,10 +55,10 @@ func (h *Handlers) SignupPage(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) Signup(w http.ResponseWriter, r *http.Request) {
-	email := r.FormValue("email")
+	email, err := normalizeEmail(r.FormValue("email"))
 	password := r.FormValue("password")
 
-	if !strings.Contains(email, "@") {
+	if err != nil {
 		http.Error(w, "Invalid email format", http.StatusBadRequest)
 		return
 	}
@@ -61,7 +69,7 @@ func (h *Handlers) Signup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var user models.User
-	err := user.SetPassword(password)
+	err = user.SetPassword(password)
 	if err != nil {
 		http.Error(w, "Internal Server Error", 500)
 		return
@@ -80,24 +88,20 @@ func (h *Handlers) Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, _ := h.Store.Get(r, "cart-session")
-
-	if sessionID, ok := session.Values["id"].(string); ok && sessionID != "" {
-		err := h.Repo.Cart().MergeCart(sessionID, userID)
-		if err != nil {
-			log.Printf("Error merging cart during signup: %v", err)
-		}
-		delete(session.Values, "id")
+	// The account works straight away, but checkout and reviews stay
+	// locked until the address is confirmed
+	if err := h.sendVerificationEmail(userID, email, false); err != nil {
+		log.Printf("Error sending verification email to user %d: %v", userID, err)
 	}
 
-	session.Values["user_id"] = userID
-	if err := session.Save(r, w); err != nil {
+	session, _ := h.Store.Get(r, "cart-session")
+	if err := h.signIn(w, r, session, userID); err != nil {
 		log.Printf("Error saving session: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	nextURL := r.URL.Query().Get("next")
+	nextURL := h.safeNext(r.URL.Query().Get("next"))
 	if nextURL != "" {
 		http.Redirect(w, r, nextURL, http.StatusFound)
 		return
@@ -106,6 +110,17 @@ func (h *Handlers) Signup(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
+// normalizeEmail returns email trimmed if it is a bare address such as
+// reader@example.com, without a display name or angle brackets
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return "", fmt.Errorf("invalid email address")
+	}
+	return email, nil
+}
+
 func validatePassword(password string) error {
 	var hasLetter, hasNumber bool
 	if len(password) < 8 {
@@ -131,9 +146,23 @@ func (h *Handlers) LoginPage(w http.ResponseWriter, r *http.Request, errorMsg st
 		ReaderBrowserURL:  h.ReaderBrowserURL,
 		ChatbotBrowserURL: h.ChatbotBrowserURL,
 		Error:             errorMsg,
-		Next:              r.URL.Query().Get("next"),
+		Next:              h.safeNext(r.URL.Query().Get("next")),
+		PasskeysEnabled:   h.Passkeys != nil,
+		IdentityProviders: h.identityProviderLinks(),
+	}
+	switch {
+	case r.URL.Query().Get("verified") != "":
+		data.Success = "Your email address has been verified. Sign in to continue."
+	case r.URL.Query().Get("unlocked") != "":
+		data.Success = "Your account has been unlocked. You can sign in now."
+	case r.URL.Query().Get("reset") != "":
+		data.Success = "Your password has been reset. Sign in with your new password."
+	case r.URL.Query().Get("signed_out") != "":
+		data.Success = "You have been signed out on every device."
+	case r.URL.Query().Get("deleted") != "":
+		data.Success = "Your account has been deleted."
 	}
-	ts, err := template.ParseFiles("./templates/base.html", "./templates/login.html")
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/login.html", "./templates/webauthn.html")
 	if err != nil {
 		log.Printf("Error parsing template: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -149,34 +178,47 @@ func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
 	password := r.FormValue("password")
 
+	if retryAfter, msg, ok := h.checkLogin(r, email); !ok {
+		w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+		w.WriteHeader(http.StatusTooManyRequests)
+		h.LoginPage(w, r, msg)
+		return
+	}
+
 	user, err := h.Repo.Users().GetUserByEmail(email)
 	if err != nil || user == nil {
+		h.recordLoginFailure(r, email, nil)
 		h.LoginPage(w, r, "Incorrect email address or password. Please verify they are correct or create an account if a new customer.")
 		return
 	}
 
 	if !user.CheckPassword(password) {
+		h.recordLoginFailure(r, email, user)
 		h.LoginPage(w, r, "Incorrect email address or password. Please verify they are correct or create an account if a new customer.")
 		return
 	}
 
-	if sessionID, ok := session.Values["id"].(string); ok && sessionID != "" {
-		err := h.Repo.Cart().MergeCart(sessionID, user.ID)
-		if err != nil {
-			log.Printf("Error merging cart: %v", err)
-		}
-		delete(session.Values, "id")
+	// Failures are only cleared once every factor has been checked, so code
+	// guesses cannot be reset by repeating the known password
+	if user.TwoFactorEnabled {
+		h.startTwoFactorLogin(w, r, session, user.ID, r.URL.Query().Get("next"))
+		return
 	}
 
-	session.Values["user_id"] = user.ID
-	if err := session.Save(r, w); err != nil {
+	h.recordLoginSuccess(r, email)
+	h.completeLogin(w, r, session, user.ID, r.URL.Query().Get("next"))
+}
+
+// completeLogin signs userID in once every factor has been checked and
+// sends them on to next if it is safe
+func (h *Handlers) completeLogin(w http.ResponseWriter, r *http.Request, session *sessions.Session, userID int, next string) {
+	if err := h.signIn(w, r, session, userID); err != nil {
 		log.Printf("Error saving session: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	nextURL := r.URL.Query().Get("next")
-	if nextURL != "" {
+	if nextURL := h.safeNext(next); nextURL != "" {
 		http.Redirect(w, r, nextURL, http.StatusFound)
 		return
 	}
@@ -184,13 +226,40 @@ func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
+// signIn stores userID in the session, merging the anonymous cart into
+// theirs and recording the session so it can be revoked later. Every login
+// method goes through here, and the session gets a fresh ID so one fixed in
+// the browser before login is never authenticated.
+func (h *Handlers) signIn(w http.ResponseWriter, r *http.Request, session *sessions.Session, userID int) error {
+	if regenerator, ok := h.Store.(sessionstore.Regenerator); ok {
+		if err := regenerator.RegenerateID(r, session); err != nil {
+			return err
+		}
+	}
+	if err := h.startSession(r, session, userID); err != nil {
+		return err
+	}
+	// Pages rendered after login get a fresh CSRF token
+	delete(session.Values, csrfSessionKey)
+
+	if sessionID, ok := session.Values["id"].(string); ok && sessionID != "" {
+		err := h.Repo.Cart().MergeCart(sessionID, userID)
+		if err != nil {
+			log.Printf("Error merging cart: %v", err)
+		}
+		delete(session.Values, "id")
+	}
+
+	session.Values["user_id"] = userID
+	return session.Save(r, w)
+}
+
 func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
 	session, err := h.Store.Get(r, "cart-session")
 	if err != nil {
 		log.Printf("Error getting session: %v", err)
 	}
-	delete(session.Values, "user_id")
-	if err := session.Save(r, w); err != nil {
+	if err := h.endSession(w, r, session); err != nil {
 		log.Printf("Error saving session: %v", err)
 	}
 	http.Redirect(w, r, "/", http.StatusFound)
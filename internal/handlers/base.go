@@ -1,9 +1,15 @@
 package handlers
 
 import (
+	"DemoApp/internal/entitlements"
+	"DemoApp/internal/identity"
+	"DemoApp/internal/loginguard"
+	"DemoApp/internal/mail"
 	"DemoApp/internal/repository"
+	"DemoApp/internal/webhooks"
 	"net/http"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gorilla/sessions"
 )
 
@@ -12,6 +18,19 @@ type Handlers struct {
 	Store             sessions.Store
 	ReaderBrowserURL  string
 	ChatbotBrowserURL string
+	// Entitlements receives a grant for each book in a completed order (optional)
+	Entitlements entitlements.Broker
+	// Webhooks queues order and entitlement events for subscribers (optional)
+	Webhooks *webhooks.Dispatcher
+	// LoginGuard throttles and locks out failed logins (optional)
+	LoginGuard *loginguard.Guard
+	Mailer     mail.Mailer
+	// PublicURL is the externally reachable base URL used in emailed links
+	PublicURL string
+	// Passkeys enables WebAuthn passkey sign-in (optional)
+	Passkeys *webauthn.WebAuthn
+	// IdentityProviders offer "Continue with ..." sign-in (optional)
+	IdentityProviders []identity.Provider
 }
 
 // BaseViewData contains common data passed to all templates
@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"DemoApp/internal/models"
-	"html/template"
 	"log"
 	"net/http"
 	"strconv"
@@ -215,7 +214,7 @@ func (h *Handlers) ViewCart(w http.ResponseWriter, r *http.Request) {
 			Items:             nil,
 			Total:             0,
 		}
-		ts, err := template.ParseFiles("./templates/base.html", "./templates/cart.html")
+		ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/cart.html")
 		if err != nil {
 			log.Printf("Error parsing template: %v", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -242,7 +241,7 @@ func (h *Handlers) ViewCart(w http.ResponseWriter, r *http.Request) {
 		Total:             total,
 	}
 
-	ts, err := template.ParseFiles("./templates/base.html", "./templates/cart.html")
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/cart.html")
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Internal Server Error", 500)
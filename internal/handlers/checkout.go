@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"DemoApp/internal/models"
-	"html/template"
 	"log"
 	"net/http"
 
@@ -31,6 +30,9 @@ func (h *Handlers) CheckoutPage(w http.ResponseWriter, r *http.Request) {
 	if !userOk {
 		userID = 0
 	}
+	if userOk && !h.requireVerifiedEmail(w, r, userID, "checking out") {
+		return
+	}
 	if !sessionOk {
 		sessionID = ""
 	}
@@ -61,7 +63,7 @@ func (h *Handlers) CheckoutPage(w http.ResponseWriter, r *http.Request) {
 		Total:             total,
 	}
 
-	ts, err := template.ParseFiles("./templates/base.html", "./templates/checkout.html")
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/checkout.html")
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Internal Server Error", 500)
@@ -87,6 +89,9 @@ func (h *Handlers) ProcessOrder(w http.ResponseWriter, r *http.Request) {
 	if !userOk {
 		userID = 0
 	}
+	if userOk && !h.requireVerifiedEmail(w, r, userID, "checking out") {
+		return
+	}
 	if !sessionOk {
 		// Fallback for edge case where session might be missing but user is somehow authenticated
 		// But usually ProcessOrder should fail if no session
@@ -103,6 +108,8 @@ func (h *Handlers) ProcessOrder(w http.ResponseWriter, r *http.Request) {
 	// So passing items is technically redundant but good for interface correctness if we swapped to a non-SQL repo.
 	// For now I will just pass nil as I know my Postgres implementation ignores it (it does `INSERT INTO ... SELECT FROM cart_items`).
 
+	// Entitlement and webhook notifications are driven by the order.created
+	// outbox event written in the same transaction (see events.go)
 	_, err := h.Repo.Orders().CreateOrder(sessionID, userID, nil)
 	if err != nil {
 		log.Println(err)
@@ -125,7 +132,7 @@ func (h *Handlers) ConfirmationPage(w http.ResponseWriter, r *http.Request) {
 		ReaderBrowserURL:  h.ReaderBrowserURL,
 		ChatbotBrowserURL: h.ChatbotBrowserURL,
 	}
-	ts, err := template.ParseFiles("./templates/base.html", "./templates/confirmation.html")
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/confirmation.html")
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Internal Server Error", 500)
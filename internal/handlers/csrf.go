@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"DemoApp/internal/models"
+	"crypto/subtle"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CSRF tokens follow the synchronizer pattern: one random token per session,
+// embedded in every form and sent back on each state-changing request
+const (
+	csrfSessionKey = "csrf_token"
+	// CSRFFormField is the hidden form field carrying the token
+	CSRFFormField = "csrf_token"
+	// CSRFHeader carries the token on HTMX and fetch requests
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// csrfExemptPrefixes are endpoints authenticated by bearer tokens or
+// credentials in the request body rather than the session cookie
+var csrfExemptPrefixes = []string{"/api/", "/graphql"}
+
+// csrfToken returns the session's CSRF token, creating and saving one if
+// needed. It must be called before anything is written to w.
+func (h *Handlers) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	session, _ := h.Store.Get(r, "cart-session")
+	if token, ok := session.Values[csrfSessionKey].(string); ok && token != "" {
+		return token
+	}
+
+	token, _, err := models.NewToken()
+	if err != nil {
+		log.Printf("Error generating CSRF token: %v", err)
+		return ""
+	}
+	session.Values[csrfSessionKey] = token
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+	return token
+}
+
+// templateFuncs returns the helpers available to every page template:
+// csrfToken for the meta tag read by scripts, and csrfField for forms
+func (h *Handlers) templateFuncs(w http.ResponseWriter, r *http.Request) template.FuncMap {
+	token := h.csrfToken(w, r)
+	return template.FuncMap{
+		"csrfToken": func() string { return token },
+		"csrfField": func() template.HTML {
+			// The token is hex, so it needs no escaping
+			return template.HTML(`<input type="hidden" name="` + CSRFFormField + `" value="` + token + `">`)
+		},
+	}
+}
+
+// parseTemplates parses page templates with templateFuncs available
+func (h *Handlers) parseTemplates(w http.ResponseWriter, r *http.Request, files ...string) (*template.Template, error) {
+	return template.New("").Funcs(h.templateFuncs(w, r)).ParseFiles(files...)
+}
+
+// VerifyCSRF rejects state-changing requests that do not carry the session's
+// CSRF token in the X-CSRF-Token header or the csrf_token form field
+func (h *Handlers) VerifyCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, prefix := range csrfExemptPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		session, _ := h.Store.Get(r, "cart-session")
+		expected, _ := session.Values[csrfSessionKey].(string)
+		sent := r.Header.Get(CSRFHeader)
+		if sent == "" {
+			sent = r.FormValue(CSRFFormField)
+		}
+		if expected == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(expected)) != 1 {
+			log.Printf("Rejected %s %s from %s: missing or invalid CSRF token", r.Method, r.URL.Path, h.clientIP(r))
+			http.Error(w, "Forbidden - invalid or missing CSRF token. Reload the page and try again.", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// safeNext returns next if it is a path on this site or a URL on one of the
+// allowlisted origins (this site, the Reader and the Chatbot), otherwise "".
+// It guards every post-login redirect against sending users off-site.
+func (h *Handlers) safeNext(next string) string {
+	if next == "" || strings.ContainsAny(next, "\\\r\n") {
+		return ""
+	}
+	u, err := url.Parse(next)
+	if err != nil {
+		return ""
+	}
+	if u.Scheme == "" && u.Host == "" {
+		// "//evil.example" has a host, so only true paths get here
+		if strings.HasPrefix(next, "/") {
+			return next
+		}
+		return ""
+	}
+	for _, allowed := range []string{h.PublicURL, h.ReaderBrowserURL, h.ChatbotBrowserURL} {
+		a, err := url.Parse(allowed)
+		if err != nil || a.Host == "" {
+			continue
+		}
+		if strings.EqualFold(u.Scheme, a.Scheme) && strings.EqualFold(u.Host, a.Host) {
+			return next
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+// TestVerifyCSRF checks that state-changing requests need the session's token
+// in the header or form, while safe methods and the token-authenticated API
+// pass through
+func TestVerifyCSRF(t *testing.T) {
+	h := &Handlers{Store: sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))}
+	protected := h.VerifyCSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// Render a page to get a session cookie holding a token
+	page := httptest.NewRecorder()
+	token := h.csrfToken(page, httptest.NewRequest(http.MethodGet, "/", nil))
+	if token == "" {
+		t.Fatal("expected a CSRF token")
+	}
+	cookies := page.Result().Cookies()
+
+	send := func(method, target, body string, header string) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if header != "" {
+			req.Header.Set(CSRFHeader, header)
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		protected.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		header string
+		want   int
+	}{
+		{"GET needs no token", http.MethodGet, "/cart", "", "", http.StatusNoContent},
+		{"POST without token", http.MethodPost, "/cart/add", "product_id=1", "", http.StatusForbidden},
+		{"POST with wrong token", http.MethodPost, "/cart/add", "product_id=1", "nope", http.StatusForbidden},
+		{"POST with header token", http.MethodPost, "/cart/add", "product_id=1", token, http.StatusNoContent},
+		{"POST with form token", http.MethodPost, "/cart/add", "product_id=1&" + CSRFFormField + "=" + url.QueryEscape(token), "", http.StatusNoContent},
+		{"API is exempt", http.MethodPost, "/api/auth", "{}", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if got := send(tt.method, tt.target, tt.body, tt.header); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestCSRFTokenRotatedOnSignOut checks that a token issued to a signed-in
+// session stops being the session's token once it is signed out
+func TestCSRFTokenRotatedOnSignOut(t *testing.T) {
+	h := &Handlers{Store: sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	before := h.csrfToken(httptest.NewRecorder(), req)
+
+	session, _ := h.Store.Get(req, "cart-session")
+	if err := h.endSession(httptest.NewRecorder(), req, session); err != nil {
+		t.Fatalf("endSession failed: %v", err)
+	}
+	if after := h.csrfToken(httptest.NewRecorder(), req); after == "" || after == before {
+		t.Errorf("expected a new CSRF token after sign-out, got %q (was %q)", after, before)
+	}
+}
+
+// TestCSRFTokenRotatedOnRevokedSession checks a session signed out because
+// it was revoked elsewhere also loses its CSRF token
+func TestCSRFTokenRotatedOnRevokedSession(t *testing.T) {
+	h := &Handlers{Store: sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))}
+
+	// A session from before tracking, with no session token, counts as revoked
+	signedIn := httptest.NewRequest(http.MethodGet, "/", nil)
+	page := httptest.NewRecorder()
+	session, _ := h.Store.Get(signedIn, "cart-session")
+	before := "issued-while-signed-in"
+	session.Values["user_id"] = 7
+	session.Values[csrfSessionKey] = before
+	if err := session.Save(signedIn, page); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range page.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	var after string
+	h.TrackSessions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		after = h.csrfToken(w, r)
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	if after == "" || after == before {
+		t.Errorf("expected a new CSRF token after revocation, got %q (was %q)", after, before)
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	h := &Handlers{PublicURL: "https://shop.example.com", ReaderBrowserURL: "http://localhost:8081"}
+	tests := map[string]string{
+		"":                                  "",
+		"/checkout":                         "/checkout",
+		"/products/1?tab=reviews":           "/products/1?tab=reviews",
+		"//evil.example/phish":              "",
+		"/\\evil.example":                   "",
+		"https://evil.example/":             "",
+		"javascript:alert(1)":               "",
+		"checkout":                          "",
+		"https://shop.example.com/orders":   "https://shop.example.com/orders",
+		"http://localhost:8081/library":     "http://localhost:8081/library",
+		"http://shop.example.com/downgrade": "",
+	}
+	for next, want := range tests {
+		if got := h.safeNext(next); got != want {
+			t.Errorf("safeNext(%q) = %q, want %q", next, got, want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"DemoApp/internal/entitlements"
+	"DemoApp/internal/models"
+	"DemoApp/internal/outbox"
+	"DemoApp/internal/webhooks"
+	"context"
+	"fmt"
+	"time"
+)
+
+// RegisterEventHandlers subscribes the order side effects (entitlement
+// streams and webhooks) to outbox events. Handlers may run more than once
+// for the same event.
+func (h *Handlers) RegisterEventHandlers(sink *outbox.InProcessSink) {
+	sink.Subscribe(models.EventOrderCreated, h.onOrderCreated)
+	sink.Subscribe(models.EventOrderCancelled, h.onOrderCancelled)
+}
+
+// onOrderCreated notifies entitlement streams and webhook subscribers of a
+// new order and the books it grants
+func (h *Handlers) onOrderCreated(ctx context.Context, event models.OutboxEvent) error {
+	var payload models.OrderEvent
+	if err := event.Decode(&payload); err != nil {
+		return err
+	}
+	order, err := h.Repo.Orders().GetOrderByID(payload.OrderID)
+	if err != nil {
+		return fmt.Errorf("error loading order %d: %w", payload.OrderID, err)
+	}
+
+	if h.Entitlements != nil {
+		entitlements.PublishOrder(ctx, h.Entitlements, order)
+	}
+	if h.Webhooks == nil {
+		return nil
+	}
+	if err := h.Webhooks.PublishOrder(webhooks.EventID(event.ID, webhooks.EventOrderCreated), webhooks.EventOrderCreated, order); err != nil {
+		return err
+	}
+	if order.UserID == nil {
+		return nil
+	}
+	for _, item := range order.Items {
+		if item.Product.SKU == nil {
+			continue
+		}
+		sku := *item.Product.SKU
+		eventID := webhooks.EventID(event.ID, webhooks.EventEntitlementGranted, sku)
+		if err := h.Webhooks.PublishEntitlement(eventID, webhooks.EventEntitlementGranted, *order.UserID, sku, order.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// onOrderCancelled notifies subscribers of the cancellation and revokes books
+// the user no longer owns through another order
+func (h *Handlers) onOrderCancelled(ctx context.Context, event models.OutboxEvent) error {
+	var payload models.OrderEvent
+	if err := event.Decode(&payload); err != nil {
+		return err
+	}
+	order, err := h.Repo.Orders().GetOrderByID(payload.OrderID)
+	if err != nil {
+		return fmt.Errorf("error loading order %d: %w", payload.OrderID, err)
+	}
+
+	if h.Webhooks != nil {
+		if err := h.Webhooks.PublishOrder(webhooks.EventID(event.ID, webhooks.EventOrderCancelled), webhooks.EventOrderCancelled, order); err != nil {
+			return err
+		}
+	}
+
+	for _, item := range order.Items {
+		if item.Product.SKU == nil {
+			continue
+		}
+		sku := *item.Product.SKU
+		owned, err := h.Repo.Orders().VerifyPurchase(payload.UserID, sku)
+		if err != nil {
+			return fmt.Errorf("error checking ownership of %s for user %d: %w", sku, payload.UserID, err)
+		}
+		if owned {
+			continue
+		}
+
+		if h.Entitlements != nil {
+			revoked := entitlements.Event{Type: entitlements.EventRevoked, UserID: payload.UserID, SKU: sku, OrderID: order.ID, OccurredAt: time.Now()}
+			if err := h.Entitlements.Publish(ctx, revoked); err != nil {
+				return err
+			}
+		}
+		if h.Webhooks != nil {
+			eventID := webhooks.EventID(event.ID, webhooks.EventEntitlementRevoked, sku)
+			if err := h.Webhooks.PublishEntitlement(eventID, webhooks.EventEntitlementRevoked, payload.UserID, sku, order.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
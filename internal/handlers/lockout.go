@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"DemoApp/internal/mail"
+	"DemoApp/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// checkLogin asks the login guard whether an attempt for email may proceed.
+// When it may not, it returns the wait and a message for the user. Guard
+// errors are logged and the attempt allowed, so a Redis outage does not
+// block every login.
+func (h *Handlers) checkLogin(r *http.Request, email string) (retryAfter time.Duration, message string, ok bool) {
+	if h.LoginGuard == nil {
+		return 0, "", true
+	}
+
+	decision, err := h.LoginGuard.Check(r.Context(), email, h.LoginGuard.ClientIP(r))
+	if err != nil {
+		log.Printf("Error checking login throttle: %v", err)
+		return 0, "", true
+	}
+	if decision.Allowed {
+		return 0, "", true
+	}
+
+	if decision.Locked {
+		return decision.RetryAfter, fmt.Sprintf("Too many failed sign-in attempts. Sign-in is locked for %s, or use the unlock link sent to your email address.", formatWait(decision.RetryAfter)), false
+	}
+	return decision.RetryAfter, fmt.Sprintf("Too many failed sign-in attempts. Please wait %s and try again.", formatWait(decision.RetryAfter)), false
+}
+
+// recordLoginFailure counts a failed attempt. When it locks the account an
+// unlock link is emailed to the owner (if the account exists); lockouts are
+// written to the audit log.
+func (h *Handlers) recordLoginFailure(r *http.Request, email string, user *models.User) {
+	if h.LoginGuard == nil {
+		return
+	}
+
+	ip := h.LoginGuard.ClientIP(r)
+	failure, err := h.LoginGuard.RecordFailure(r.Context(), email, ip)
+	if err != nil {
+		log.Printf("Error recording failed login: %v", err)
+		return
+	}
+
+	if failure.IPLocked {
+		h.audit(models.AuditEntry{Event: models.AuditIPBlocked, IP: ip, Details: map[string]interface{}{
+			"failures": failure.IPFailures,
+		}})
+	}
+	if !failure.AccountLocked {
+		return
+	}
+
+	entry := models.AuditEntry{Event: models.AuditAccountLocked, IP: ip, Details: map[string]interface{}{
+		"email":    email,
+		"failures": failure.AccountFailures,
+	}}
+	if user != nil {
+		entry.UserID = &user.ID
+	}
+	h.audit(entry)
+
+	if user != nil {
+		h.sendUnlockEmail(r.Context(), user)
+	}
+}
+
+// recordLoginSuccess clears the account's failed attempts
+func (h *Handlers) recordLoginSuccess(r *http.Request, email string) {
+	if h.LoginGuard == nil {
+		return
+	}
+	if err := h.LoginGuard.RecordSuccess(r.Context(), email); err != nil {
+		log.Printf("Error clearing failed logins: %v", err)
+	}
+}
+
+func (h *Handlers) sendUnlockEmail(ctx context.Context, user *models.User) {
+	if h.Mailer == nil {
+		return
+	}
+
+	token, err := h.LoginGuard.IssueUnlockToken(ctx, user.Email)
+	if err != nil {
+		log.Printf("Error issuing unlock token for user %d: %v", user.ID, err)
+		return
+	}
+
+	link := h.PublicURL + "/account/unlock?token=" + url.QueryEscape(token)
+	go h.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Your Bookstore account has been locked",
+		Body: "We locked your Bookstore account after several failed sign-in attempts.\n\n" +
+			"If this was you, unlock your account now with this link:\n\n" + link + "\n\n" +
+			"Otherwise the lock lifts automatically. If you did not try to sign in, consider changing your password.\n",
+	})
+}
+
+// UnlockAccount redeems an emailed unlock token
+// GET /account/unlock?token=...
+func (h *Handlers) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	if h.LoginGuard == nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	email, ok, err := h.LoginGuard.RedeemUnlockToken(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		log.Printf("Error redeeming unlock token: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		h.LoginPage(w, r, "This unlock link is invalid or has expired.")
+		return
+	}
+
+	entry := models.AuditEntry{Event: models.AuditAccountUnlocked, IP: h.clientIP(r), Details: map[string]interface{}{
+		"email":  email,
+		"method": "email",
+	}}
+	if user, err := h.Repo.Users().GetUserByEmail(email); err == nil && user != nil {
+		entry.UserID = &user.ID
+	}
+	h.audit(entry)
+
+	http.Redirect(w, r, "/login?unlocked=1", http.StatusFound)
+}
+
+// audit writes an audit log entry, logging rather than failing the request on error
+func (h *Handlers) audit(entry models.AuditEntry) {
+	if err := h.Repo.Audit().Record(entry); err != nil {
+		log.Printf("Error writing audit entry %s: %v", entry.Event, err)
+	}
+}
+
+// formatWait renders a retry delay for users, rounding up
+func formatWait(d time.Duration) string {
+	if d < 2*time.Minute {
+		seconds := int((d + time.Second - 1) / time.Second)
+		if seconds <= 1 {
+			return "1 second"
+		}
+		return strconv.Itoa(seconds) + " seconds"
+	}
+	return strconv.Itoa(int((d+time.Minute-1)/time.Minute)) + " minutes"
+}
+
+// retryAfterSeconds formats d for a Retry-After header
+func retryAfterSeconds(d time.Duration) string {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"DemoApp/internal/models"
+	"DemoApp/internal/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Fakes embed the repository interfaces so only the methods exercised by the
+// API handlers need implementing; anything else panics if called.
+
+type fakeRepo struct {
+	products *fakeProductRepo
+	orders   *fakeOrderRepo
+	users    *fakeUserRepo
+}
+
+func (f *fakeRepo) Products() repository.ProductRepository                     { return f.products }
+func (f *fakeRepo) Orders() repository.OrderRepository                         { return f.orders }
+func (f *fakeRepo) Cart() repository.CartRepository                            { return nil }
+func (f *fakeRepo) Users() repository.UserRepository                           { return f.users }
+func (f *fakeRepo) Reviews() repository.ReviewRepository                       { return nil }
+func (f *fakeRepo) Webhooks() repository.WebhookRepository                     { return nil }
+func (f *fakeRepo) Outbox() repository.OutboxRepository                        { return nil }
+func (f *fakeRepo) Audit() repository.AuditRepository                          { return nil }
+func (f *fakeRepo) PasswordResets() repository.PasswordResetRepository         { return nil }
+func (f *fakeRepo) EmailVerifications() repository.EmailVerificationRepository { return nil }
+func (f *fakeRepo) TwoFactor() repository.TwoFactorRepository                  { return nil }
+func (f *fakeRepo) Passkeys() repository.PasskeyRepository                     { return nil }
+func (f *fakeRepo) Sessions() repository.SessionRepository                     { return nil }
+func (f *fakeRepo) Identities() repository.IdentityRepository                  { return nil }
+func (f *fakeRepo) SearchRules() repository.SearchRulesRepository              { return nil }
+func (f *fakeRepo) SearchAnalytics() repository.SearchAnalyticsRepository      { return nil }
+
+type fakeProductRepo struct {
+	repository.ProductRepository
+	products   []models.Product
+	categories []models.Category
+}
+
+func (f *fakeProductRepo) ListProducts() ([]models.Product, error) { return f.products, nil }
+func (f *fakeProductRepo) SearchProducts(query string, categoryID int) ([]models.Product, error) {
+	return f.products, nil
+}
+func (f *fakeProductRepo) ListCategories() ([]models.Category, error) { return f.categories, nil }
+func (f *fakeProductRepo) SuggestCompletions(prefix string, limit int) (*models.Suggestions, error) {
+	return &models.Suggestions{
+		Titles:     []models.TitleSuggestion{{ProductID: 1, Title: "Pride and Prejudice", Author: "Jane Austen"}, {ProductID: 2, Title: "Untitled"}},
+		Authors:    []string{"Jane Austen"},
+		Categories: []models.CategorySuggestion{},
+	}, nil
+}
+func (f *fakeProductRepo) SearchProductsFaceted(ctx context.Context, query string, filters models.SearchFilters, page, pageSize int, sortBy string) (*models.SearchResult, error) {
+	hits := make([]models.SearchHit, len(f.products))
+	for i, p := range f.products {
+		hits[i].Product = p
+		if query != "" {
+			hits[i].Highlight = &models.Highlight{Name: "<mark>" + p.Name + "</mark>", Description: []string{"…a <mark>match</mark>…"}}
+		}
+	}
+	return &models.SearchResult{
+		Hits:       hits,
+		Pagination: models.Pagination{Page: page, PageSize: pageSize, TotalItems: len(f.products), TotalPages: 1},
+		Facets: models.Facets{
+			Categories: []models.FacetValue{{Key: "1", Label: "Fiction", Count: 1, Selected: true}},
+			Authors:    []models.FacetValue{{Key: "Jane Austen", Label: "Jane Austen", Count: 1}},
+			Prices:     []models.FacetValue{{Key: "10-20", Label: "$10 to $20", Count: 1}},
+			Ratings:    []models.FacetValue{},
+			InStock:    models.FacetValue{Key: "1", Label: "In stock", Count: 1},
+		},
+	}, nil
+}
+
+type fakeOrderRepo struct {
+	repository.OrderRepository
+	purchases []models.PurchasedBook
+}
+
+func (f *fakeOrderRepo) GetUserPurchases(userID int) ([]models.PurchasedBook, error) {
+	return f.purchases, nil
+}
+func (f *fakeOrderRepo) VerifyPurchase(userID int, sku string) (bool, error) {
+	for _, p := range f.purchases {
+		if p.SKU == sku {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type fakeUserRepo struct {
+	repository.UserRepository
+	users []models.User
+}
+
+func (f *fakeUserRepo) GetUserByEmail(email string) (*models.User, error) {
+	for i := range f.users {
+		if f.users[i].Email == email {
+			return &f.users[i], nil
+		}
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+func newFakeRepo(t *testing.T) *fakeRepo {
+	t.Helper()
+
+	sku := "BOOK-1342"
+	author := "Jane Austen"
+	categoryID := 1
+	description := "Novels and stories"
+
+	user := models.User{ID: 7, Email: "reader@example.com", Role: "customer"}
+	if err := user.SetPassword("password123"); err != nil {
+		t.Fatalf("SetPassword failed: %v", err)
+	}
+
+	return &fakeRepo{
+		products: &fakeProductRepo{
+			products: []models.Product{
+				{ID: 1, Name: "Pride and Prejudice", Description: "A romantic novel", Price: 12.29, SKU: &sku, StockQuantity: 3, CategoryID: &categoryID, Status: "active", Author: &author, PopularityScore: 65000},
+				{ID: 2, Name: "Untitled", Description: "No optional fields", Price: 9.99, Status: "active"},
+			},
+			categories: []models.Category{
+				{ID: 1, Name: "Fiction", Description: &description},
+				{ID: 2, Name: "Poetry"},
+			},
+		},
+		orders: &fakeOrderRepo{
+			purchases: []models.PurchasedBook{
+				{SKU: sku, GutenbergID: 1342, Title: "Pride and Prejudice", Author: author, CoverURL: "/images/BOOK-1342.jpg", PurchasedAt: "2026-01-02T15:04:05Z"},
+			},
+		},
+		users: &fakeUserRepo{users: []models.User{user}},
+	}
+}
+
+// loadSpec parses the embedded OpenAPI document
+func loadSpec(t *testing.T) map[string]interface{} {
+	t.Helper()
+	var spec map[string]interface{}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	return spec
+}
+
+// resolveRef follows a local "#/..." reference inside the spec
+func resolveRef(spec map[string]interface{}, ref string) map[string]interface{} {
+	var node interface{} = spec
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = m[part]
+	}
+	m, _ := node.(map[string]interface{})
+	return m
+}
+
+func deref(spec, node map[string]interface{}) map[string]interface{} {
+	for node != nil {
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node
+		}
+		node = resolveRef(spec, ref)
+	}
+	return nil
+}
+
+// validateSchema checks value against the subset of JSON Schema used in
+// openapi.json: type, nullable, properties, required, additionalProperties
+// and items. Every problem found is returned so a drift shows all fields at once.
+func validateSchema(spec, schema map[string]interface{}, value interface{}, path string) []string {
+	schema = deref(spec, schema)
+	if schema == nil {
+		return []string{path + ": unresolved schema"}
+	}
+
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+		return []string{path + ": null is not allowed"}
+	}
+
+	var errs []string
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected object, got %T", path, value)}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, present := obj[name.(string)]; !present {
+					errs = append(errs, fmt.Sprintf("%s.%s: required property missing", path, name))
+				}
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			propSchema, known := props[k].(map[string]interface{})
+			if !known {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					errs = append(errs, fmt.Sprintf("%s.%s: property not in spec", path, k))
+				}
+				continue
+			}
+			errs = append(errs, validateSchema(spec, propSchema, obj[k], path+"."+k)...)
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected array, got %T", path, value)}
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range arr {
+			errs = append(errs, validateSchema(spec, items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			errs = append(errs, fmt.Sprintf("%s: expected string, got %T", path, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs = append(errs, fmt.Sprintf("%s: expected boolean, got %T", path, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			errs = append(errs, fmt.Sprintf("%s: expected number, got %T", path, value))
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			errs = append(errs, fmt.Sprintf("%s: expected integer, got %v", path, value))
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("%s: unsupported schema type %v", path, schema["type"]))
+	}
+	return errs
+}
+
+// responseSchema returns the application/json schema for an operation's status code
+func responseSchema(spec map[string]interface{}, path, method string, status int) map[string]interface{} {
+	paths, _ := spec["paths"].(map[string]interface{})
+	item, _ := paths[path].(map[string]interface{})
+	op, _ := item[method].(map[string]interface{})
+	if op == nil {
+		return nil
+	}
+	responses, _ := op["responses"].(map[string]interface{})
+	resp, _ := responses[fmt.Sprint(status)].(map[string]interface{})
+	resp = deref(spec, resp)
+	content, _ := resp["content"].(map[string]interface{})
+	media, _ := content["application/json"].(map[string]interface{})
+	schema, _ := media["schema"].(map[string]interface{})
+	return schema
+}
+
+// TestAPIResponsesMatchOpenAPISpec calls every JSON API handler and validates
+// the response body against the schema documented in openapi.json
+func TestAPIResponsesMatchOpenAPISpec(t *testing.T) {
+	spec := loadSpec(t)
+	h := &Handlers{Repo: newFakeRepo(t)}
+
+	mux := http.NewServeMux()
+	for _, route := range h.APIRoutes("") {
+		mux.Handle(route.Pattern, route.Handler)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		specPath string
+		target   string
+		body     string
+	}{
+		{"auth", http.MethodPost, "/api/auth", "/api/auth", `{"email":"reader@example.com","password":"password123"}`},
+		{"purchases", http.MethodGet, "/api/purchases/{user_id}", "/api/purchases/7", ""},
+		{"verify purchase", http.MethodGet, "/api/purchases/{user_id}/{sku}", "/api/purchases/7/BOOK-1342", ""},
+		{"products", http.MethodGet, "/api/products", "/api/products", ""},
+		{"products by category", http.MethodGet, "/api/products", "/api/products?category=fiction", ""},
+		{"products by facets", http.MethodGet, "/api/products", "/api/products?category=fiction&category=poetry&price=10-20&in_stock=1", ""},
+		{"product search", http.MethodGet, "/api/products/search", "/api/products/search?q=austen", ""},
+		{"filtered product search", http.MethodGet, "/api/products/search", "/api/products/search?q=austen&rating=4-up", ""},
+		{"product suggestions", http.MethodGet, "/api/products/suggest", "/api/products/suggest?q=pri", ""},
+		{"product facets", http.MethodGet, "/api/products/facets", "/api/products/facets?q=austen&category=fiction", ""},
+		{"categories", http.MethodGet, "/api/categories", "/api/categories", ""},
+	}
+
+	covered := make(map[string]bool)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			covered[strings.ToLower(tt.method)+" "+tt.specPath] = true
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Errorf("expected application/json content type, got %q", ct)
+			}
+
+			schema := responseSchema(spec, tt.specPath, strings.ToLower(tt.method), http.StatusOK)
+			if schema == nil {
+				t.Fatalf("openapi.json has no 200 application/json response for %s %s", tt.method, tt.specPath)
+			}
+
+			var body interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response is not valid JSON: %v", err)
+			}
+			for _, problem := range validateSchema(spec, schema, body, "$") {
+				t.Error(problem)
+			}
+		})
+	}
+
+	// Every documented JSON operation must be exercised above
+	paths, _ := spec["paths"].(map[string]interface{})
+	for path, item := range paths {
+		for method := range item.(map[string]interface{}) {
+			if responseSchema(spec, path, method, http.StatusOK) == nil {
+				continue
+			}
+			if !covered[method+" "+path] {
+				t.Errorf("%s %s is documented in openapi.json but not covered by this test", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+// TestOpenAPISpecCoversRoutes checks every route the API serves is
+// documented in openapi.json with the same method, and every documented
+// operation is served
+func TestOpenAPISpecCoversRoutes(t *testing.T) {
+	spec := loadSpec(t)
+	paths, _ := spec["paths"].(map[string]interface{})
+
+	served := make(map[string]bool)
+	for _, route := range (&Handlers{}).APIRoutes("") {
+		method, path, ok := strings.Cut(route.Pattern, " ")
+		if !ok {
+			t.Errorf("route %q has no method", route.Pattern)
+			continue
+		}
+		served[strings.ToLower(method)+" "+path] = true
+		item, _ := paths[path].(map[string]interface{})
+		if item[strings.ToLower(method)] == nil {
+			t.Errorf("%s is served but not documented in openapi.json", route.Pattern)
+		}
+	}
+
+	for path, item := range paths {
+		for method := range item.(map[string]interface{}) {
+			if !served[method+" "+path] {
+				t.Errorf("%s %s is documented in openapi.json but not served by APIRoutes", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+// TestOpenAPISpecServed verifies the spec endpoint returns the embedded document
+func TestOpenAPISpecServed(t *testing.T) {
+	h := &Handlers{}
+	rec := httptest.NewRecorder()
+	h.OpenAPISpec(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var spec map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("served spec is not valid JSON: %v", err)
+	}
+	if version, _ := spec["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		t.Errorf("expected an OpenAPI 3 document, got version %q", version)
+	}
+}
@@ -2,9 +2,9 @@ package handlers
 
 import (
 	"DemoApp/internal/models"
-	"html/template"
 	"log"
 	"net/http"
+	"strconv"
 )
 
 type MyOrdersViewData struct {
@@ -43,7 +43,7 @@ func (h *Handlers) MyOrders(w http.ResponseWriter, r *http.Request) {
 		Orders:            orders,
 	}
 
-	ts, err := template.ParseFiles("./templates/base.html", "./templates/orders.html")
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/orders.html")
 	if err != nil {
 		log.Printf("Template parse error: %v", err)
 		http.Error(w, "Internal Server Error", 500)
@@ -56,3 +56,34 @@ func (h *Handlers) MyOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// CancelOrder cancels one of the user's pending orders
+// POST /orders/{id}/cancel
+func (h *Handlers) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.GetUserID(r)
+	if !ok {
+		http.Redirect(w, r, "/login?next=/orders", http.StatusFound)
+		return
+	}
+
+	orderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	// Not-pending or foreign orders are left alone; subscribers are notified
+	// through the order.cancelled outbox event
+	if _, err := h.Repo.Orders().CancelOrder(orderID, userID); err != nil {
+		log.Printf("Error cancelling order %d for user %d: %v", orderID, userID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/orders", http.StatusSeeOther)
+}
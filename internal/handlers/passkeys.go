@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"DemoApp/internal/models"
+	"DemoApp/internal/passkeys"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// Session keys for WebAuthn ceremonies in progress
+const (
+	sessionPasskeyRegistration = "passkey_registration"
+	sessionPasskeyLogin        = "passkey_login"
+)
+
+type PasskeysPageData struct {
+	IsAuthenticated   bool
+	ReaderBrowserURL  string
+	ChatbotBrowserURL string
+	Passkeys          []models.Passkey
+	Error             string
+	Success           string
+}
+
+// passkeyUser loads userID as a WebAuthn user with their registered
+// credentials, assigning a user handle on first use
+func (h *Handlers) passkeyUser(userID int) (*passkeys.User, error) {
+	user, err := h.Repo.Users().GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	candidate, err := passkeys.NewHandle()
+	if err != nil {
+		return nil, err
+	}
+	handle, err := h.Repo.Passkeys().EnsureWebAuthnHandle(userID, candidate)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := h.Repo.Passkeys().ListPasskeys(userID)
+	if err != nil {
+		return nil, err
+	}
+	pu := &passkeys.User{ID: user.ID, Handle: handle, Email: user.Email}
+	if user.FullName != nil {
+		pu.Name = *user.FullName
+	}
+	for _, p := range stored {
+		var cred webauthn.Credential
+		if err := json.Unmarshal(p.Credential, &cred); err != nil {
+			return nil, fmt.Errorf("decoding passkey %d: %w", p.ID, err)
+		}
+		pu.Credentials = append(pu.Credentials, cred)
+	}
+	return pu, nil
+}
+
+// writeCeremony stores ceremony state in the session and returns the
+// browser options as JSON
+func (h *Handlers) writeCeremony(w http.ResponseWriter, r *http.Request, key string, options interface{}, state *webauthn.SessionData) {
+	encoded, err := passkeys.EncodeSession(state)
+	if err != nil {
+		log.Printf("Error encoding passkey ceremony: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	session, _ := h.Store.Get(r, "cart-session")
+	session.Values[key] = encoded
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Error saving session: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(options); err != nil {
+		log.Printf("Error encoding passkey options: %v", err)
+	}
+}
+
+// PasskeysPage lists the user's passkeys and offers to add one
+func (h *Handlers) PasskeysPage(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.GetUserID(r)
+	if !authenticated {
+		http.Redirect(w, r, "/login?next=/profile/passkeys", http.StatusFound)
+		return
+	}
+
+	list, err := h.Repo.Passkeys().ListPasskeys(userID)
+	if err != nil {
+		log.Printf("Error listing passkeys: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := PasskeysPageData{
+		IsAuthenticated:   true,
+		ReaderBrowserURL:  h.ReaderBrowserURL,
+		ChatbotBrowserURL: h.ChatbotBrowserURL,
+		Passkeys:          list,
+		Error:             r.URL.Query().Get("error"),
+		Success:           r.URL.Query().Get("success"),
+	}
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/profile-passkeys.html", "./templates/webauthn.html")
+	if err != nil {
+		log.Printf("Error parsing template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := ts.ExecuteTemplate(w, "profile-passkeys.html", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// BeginPasskeyRegistration starts the registration ceremony
+// POST /profile/passkeys/register/begin
+func (h *Handlers) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.GetUserID(r)
+	if !authenticated {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pu, err := h.passkeyUser(userID)
+	if err != nil {
+		log.Printf("Error loading passkey user %d: %v", userID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	options, state, err := h.Passkeys.BeginRegistration(pu, passkeys.RegistrationOptions(pu)...)
+	if err != nil {
+		log.Printf("Error starting passkey registration: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	h.writeCeremony(w, r, sessionPasskeyRegistration, options, state)
+}
+
+// FinishPasskeyRegistration verifies the authenticator's response and stores
+// the new passkey
+// POST /profile/passkeys/register/finish?name=...
+func (h *Handlers) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.GetUserID(r)
+	if !authenticated {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, _ := h.Store.Get(r, "cart-session")
+	encoded, _ := session.Values[sessionPasskeyRegistration].(string)
+	delete(session.Values, sessionPasskeyRegistration)
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+	state, err := passkeys.DecodeSession(encoded)
+	if err != nil {
+		http.Error(w, "No passkey registration in progress", http.StatusBadRequest)
+		return
+	}
+
+	pu, err := h.passkeyUser(userID)
+	if err != nil {
+		log.Printf("Error loading passkey user %d: %v", userID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	cred, err := h.Passkeys.FinishRegistration(pu, state, r)
+	if err != nil {
+		log.Printf("Passkey registration failed for user %d: %v", userID, err)
+		http.Error(w, "Passkey registration failed", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" {
+		name = "Passkey added " + time.Now().Format("Jan 2, 2006")
+	}
+	if len(name) > 100 {
+		name = name[:100]
+	}
+
+	data, err := json.Marshal(cred)
+	if err != nil {
+		log.Printf("Error encoding passkey: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Repo.Passkeys().CreatePasskey(userID, name, cred.ID, data); err != nil {
+		log.Printf("Error storing passkey: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(models.AuditEntry{UserID: &userID, Event: models.AuditPasskeyAdded, IP: h.clientIP(r), Details: map[string]interface{}{
+		"name": name,
+	}})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeletePasskey removes one of the user's passkeys
+// POST /profile/passkeys/{id}/delete
+func (h *Handlers) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.GetUserID(r)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/profile/passkeys", http.StatusFound)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid passkey ID", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.Repo.Passkeys().DeletePasskey(id, userID)
+	if err != nil {
+		log.Printf("Error deleting passkey: %v", err)
+		http.Redirect(w, r, "/profile/passkeys?error=Could+not+remove+passkey", http.StatusFound)
+		return
+	}
+	if deleted {
+		h.audit(models.AuditEntry{UserID: &userID, Event: models.AuditPasskeyRemoved, IP: h.clientIP(r), Details: map[string]interface{}{
+			"passkey_id": id,
+		}})
+	}
+	http.Redirect(w, r, "/profile/passkeys?success=Passkey+removed", http.StatusFound)
+}
+
+// BeginPasskeyLogin starts a discoverable login: the browser offers any
+// passkey for this site without the user typing an email
+// POST /login/passkey/begin
+func (h *Handlers) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	options, state, err := h.Passkeys.BeginDiscoverableLogin(passkeys.LoginOptions()...)
+	if err != nil {
+		log.Printf("Error starting passkey login: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	h.writeCeremony(w, r, sessionPasskeyLogin, options, state)
+}
+
+// PasskeyLoginResponse tells the login page where to go after a passkey login
+type PasskeyLoginResponse struct {
+	Redirect string `json:"redirect"`
+}
+
+// FinishPasskeyLogin verifies the assertion and signs the user in exactly as
+// a password login would, including the cart merge
+// POST /login/passkey/finish?next=...
+func (h *Handlers) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, _ := h.Store.Get(r, "cart-session")
+	encoded, _ := session.Values[sessionPasskeyLogin].(string)
+	delete(session.Values, sessionPasskeyLogin)
+	state, err := passkeys.DecodeSession(encoded)
+	if err != nil {
+		http.Error(w, "No passkey login in progress", http.StatusBadRequest)
+		return
+	}
+
+	lookup := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := h.Repo.Passkeys().GetUserIDByWebAuthnHandle(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		return h.passkeyUser(userID)
+	}
+	found, cred, err := h.Passkeys.FinishPasskeyLogin(lookup, state, r)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Passkey login failed: %v", err)
+		}
+		http.Error(w, "Passkey not recognised", http.StatusUnauthorized)
+		return
+	}
+	pu := found.(*passkeys.User)
+
+	if cred.Authenticator.CloneWarning {
+		log.Printf("Rejected passkey login for user %d: signature counter went backwards, authenticator may be cloned", pu.ID)
+		http.Error(w, "Passkey not recognised", http.StatusUnauthorized)
+		return
+	}
+	if data, err := json.Marshal(cred); err != nil {
+		log.Printf("Error encoding passkey: %v", err)
+	} else if err := h.Repo.Passkeys().UpdatePasskeyUsage(cred.ID, data); err != nil {
+		log.Printf("Error updating passkey usage: %v", err)
+	}
+
+	// A user-verified passkey is already two factors, so no TOTP prompt
+	if err := h.signIn(w, r, session, pu.ID); err != nil {
+		log.Printf("Error saving session: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	next := h.safeNext(r.URL.Query().Get("next"))
+	if next == "" {
+		next = "/"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(PasskeyLoginResponse{Redirect: next}); err != nil {
+		log.Printf("Error encoding passkey login response: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"DemoApp/internal/mail"
+	"DemoApp/internal/models"
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// passwordResetTTL is how long an emailed reset link stays valid
+const passwordResetTTL = time.Hour
+
+type PasswordResetPageData struct {
+	IsAuthenticated   bool
+	ReaderBrowserURL  string
+	ChatbotBrowserURL string
+	Error             string
+	Success           string
+	Token             string
+}
+
+func (h *Handlers) renderPasswordResetPage(w http.ResponseWriter, r *http.Request, page string, data PasswordResetPageData) {
+	data.IsAuthenticated = h.IsAuthenticated(r)
+	data.ReaderBrowserURL = h.ReaderBrowserURL
+	data.ChatbotBrowserURL = h.ChatbotBrowserURL
+
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/"+page)
+	if err != nil {
+		log.Printf("Error parsing template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := ts.ExecuteTemplate(w, page, data); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// ForgotPasswordPage displays the form to request a reset link
+func (h *Handlers) ForgotPasswordPage(w http.ResponseWriter, r *http.Request) {
+	h.renderPasswordResetPage(w, r, "password-forgot.html", PasswordResetPageData{})
+}
+
+// RequestPasswordReset emails a reset link if the address belongs to an
+// account. The response is the same either way so it cannot be used to
+// discover which addresses are registered.
+func (h *Handlers) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/password/forgot", http.StatusFound)
+		return
+	}
+
+	email := strings.TrimSpace(r.FormValue("email"))
+	sent := PasswordResetPageData{
+		Success: "If an account exists for that address, we've emailed a link to reset your password. The link expires in 1 hour.",
+	}
+
+	user, err := h.Repo.Users().GetUserByEmail(email)
+	if err != nil || user == nil {
+		h.renderPasswordResetPage(w, r, "password-forgot.html", sent)
+		return
+	}
+
+	token, hash, err := models.NewToken()
+	if err != nil {
+		log.Printf("Error generating reset token: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Repo.PasswordResets().CreatePasswordReset(user.ID, hash, time.Now().Add(passwordResetTTL)); err != nil {
+		log.Printf("Error storing reset token for user %d: %v", user.ID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(models.AuditEntry{UserID: &user.ID, Event: models.AuditPasswordResetRequested, IP: h.clientIP(r)})
+
+	link := h.PublicURL + "/password/reset?token=" + url.QueryEscape(token)
+	// Sent in the background so response time does not reveal whether the
+	// address has an account
+	go h.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Bookstore password",
+		Body: "Someone asked to reset the password for your Bookstore account.\n\n" +
+			"To choose a new password, open this link within the next hour:\n\n" + link + "\n\n" +
+			"If you did not ask for this, you can ignore this email; your password has not been changed.\n",
+	})
+
+	h.renderPasswordResetPage(w, r, "password-forgot.html", sent)
+}
+
+// ResetPasswordPage displays the new-password form for a reset link
+// GET /password/reset?token=...
+func (h *Handlers) ResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if _, ok, err := h.Repo.PasswordResets().GetPasswordResetUser(models.HashToken(token)); err != nil {
+		log.Printf("Error checking reset token: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	} else if !ok {
+		h.renderPasswordResetPage(w, r, "password-forgot.html", PasswordResetPageData{
+			Error: "This reset link is invalid, has expired or has already been used. Request a new one below.",
+		})
+		return
+	}
+
+	h.renderPasswordResetPage(w, r, "password-reset.html", PasswordResetPageData{Token: token})
+}
+
+// ResetPassword sets a new password using a reset token
+func (h *Handlers) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/password/forgot", http.StatusFound)
+		return
+	}
+
+	token := r.FormValue("token")
+	newPassword := r.FormValue("new_password")
+	confirmPassword := r.FormValue("confirm_password")
+
+	if newPassword != confirmPassword {
+		h.renderPasswordResetPage(w, r, "password-reset.html", PasswordResetPageData{Token: token, Error: "Passwords do not match"})
+		return
+	}
+	if err := validatePassword(newPassword); err != nil {
+		h.renderPasswordResetPage(w, r, "password-reset.html", PasswordResetPageData{Token: token, Error: err.Error()})
+		return
+	}
+
+	var tempUser models.User
+	if err := tempUser.SetPassword(newPassword); err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok, err := h.Repo.PasswordResets().ResetPassword(models.HashToken(token), tempUser.PasswordHash)
+	if err != nil {
+		log.Printf("Error resetting password: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		h.renderPasswordResetPage(w, r, "password-forgot.html", PasswordResetPageData{
+			Error: "This reset link is invalid, has expired or has already been used. Request a new one below.",
+		})
+		return
+	}
+
+	// Whoever knew the old password may still be signed in
+	revoked, err := h.Repo.Sessions().RevokeUserSessions(userID, "")
+	if err != nil {
+		log.Printf("Error revoking sessions for user %d: %v", userID, err)
+	}
+	h.audit(models.AuditEntry{UserID: &userID, Event: models.AuditPasswordReset, IP: h.clientIP(r), Details: map[string]interface{}{
+		"sessions_revoked": revoked,
+	}})
+
+	if user, err := h.Repo.Users().GetUserByID(userID); err != nil {
+		log.Printf("Error fetching user %d after password reset: %v", userID, err)
+	} else {
+		// Proving control of the mailbox also lifts any lockout
+		if h.LoginGuard != nil {
+			if err := h.LoginGuard.Unlock(r.Context(), user.Email); err != nil {
+				log.Printf("Error clearing lockout for user %d: %v", userID, err)
+			}
+		}
+		go h.sendMail(mail.Message{
+			To:      user.Email,
+			Subject: "Your Bookstore password was changed",
+			Body: "The password for your Bookstore account was just reset.\n\n" +
+				"If this was not you, reset your password again at " + h.PublicURL + "/password/forgot and contact support.\n",
+		})
+	}
+
+	http.Redirect(w, r, "/login?reset=1", http.StatusFound)
+}
+
+// sendMail sends msg outside the request, logging failures
+func (h *Handlers) sendMail(msg mail.Message) {
+	if h.Mailer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := h.Mailer.Send(ctx, msg); err != nil {
+		log.Printf("Error sending %q email: %v", msg.Subject, err)
+	}
+}
+
+// clientIP returns the request's client address for audit entries
+func (h *Handlers) clientIP(r *http.Request) string {
+	if h.LoginGuard != nil {
+		return h.LoginGuard.ClientIP(r)
+	}
+	return r.RemoteAddr
+}
@@ -2,20 +2,28 @@ package handlers
 
 import (
 	"DemoApp/internal/models"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type ProductListViewData struct {
 	IsAuthenticated   bool
 	ReaderBrowserURL  string
 	ChatbotBrowserURL string
-	Products          []models.Product
+	Products          []ProductListItem
 	Categories        []models.Category
 	SearchQuery       string
-	SelectedCategory  int
+	OriginalQuery     string // What the user typed, when SearchQuery is its respelling
+	SelectedCategory  int    // First selected category, for the mobile dropdown
+	Facets            models.Facets
+	Filters           models.SearchFilters
+	FilterQuery       template.URL // Search and filter parameters for page links, ending in "&"
 	ResultCount       int
 	Pagination        *models.Pagination
 	PageSize          int
@@ -24,6 +32,34 @@ type ProductListViewData struct {
 	SortOptions       []SortOption
 }
 
+// ProductListItem is a product on the list page with the parts that matched
+// the search highlighted. The highlight fields are empty when nothing in
+// them matched.
+type ProductListItem struct {
+	models.Product
+	NameHTML    template.HTML
+	AuthorHTML  template.HTML
+	SnippetHTML template.HTML // Description snippets, replacing the full description
+	Href        string        // Product page link, tagged with the search it was found by
+}
+
+// productListItems converts search hits for the list page. Highlights are
+// built from escaped text with only <mark> tags added, by Elasticsearch's
+// html encoder or the SQL fallback, so they are trusted as HTML.
+func productListItems(hits []models.SearchHit) []ProductListItem {
+	items := make([]ProductListItem, len(hits))
+	for i, hit := range hits {
+		items[i].Product = hit.Product
+		items[i].Href = "/products/" + strconv.Itoa(hit.ID)
+		if hl := hit.Highlight; hl != nil {
+			items[i].NameHTML = template.HTML(hl.Name)
+			items[i].AuthorHTML = template.HTML(hl.Author)
+			items[i].SnippetHTML = template.HTML(strings.Join(hl.Description, " … "))
+		}
+	}
+	return items
+}
+
 type SortOption struct {
 	Value string
 	Label string
@@ -39,23 +75,75 @@ type ProductDetailViewData struct {
 	Rating            *models.ProductRating
 	RatingBars        []models.RatingBar
 	UserReview        *models.Review
+	EmailVerified     bool
+}
+
+// parseSearchFilters reads the facet filters and search mode from query
+// parameters. Each facet parameter may repeat to select several values;
+// unknown range keys and malformed category IDs are ignored.
+func parseSearchFilters(values url.Values) models.SearchFilters {
+	var filters models.SearchFilters
+	for _, v := range values["category"] {
+		if id, err := strconv.Atoi(v); err == nil && id > 0 {
+			filters.CategoryIDs = append(filters.CategoryIDs, id)
+		}
+	}
+	for _, v := range values["author"] {
+		if v != "" {
+			filters.Authors = append(filters.Authors, v)
+		}
+	}
+	for _, r := range models.SelectedRanges(models.PriceRanges, values["price"]) {
+		filters.PriceRanges = append(filters.PriceRanges, r.Key)
+	}
+	for _, r := range models.SelectedRanges(models.RatingRanges, values["rating"]) {
+		filters.RatingRanges = append(filters.RatingRanges, r.Key)
+	}
+	filters.InStock = values.Get("in_stock") == "1"
+	if values.Get("mode") == string(models.SearchHybrid) {
+		filters.Mode = models.SearchHybrid
+	}
+	return filters
+}
+
+// filterQuery encodes the search query and filters for links that change
+// only the page, size or sort
+func filterQuery(query string, filters models.SearchFilters) template.URL {
+	values := url.Values{}
+	if query != "" {
+		values.Set("q", query)
+	}
+	for _, id := range filters.CategoryIDs {
+		values.Add("category", strconv.Itoa(id))
+	}
+	for _, a := range filters.Authors {
+		values.Add("author", a)
+	}
+	for _, k := range filters.PriceRanges {
+		values.Add("price", k)
+	}
+	for _, k := range filters.RatingRanges {
+		values.Add("rating", k)
+	}
+	if filters.InStock {
+		values.Set("in_stock", "1")
+	}
+	if filters.Mode != models.SearchLexical {
+		values.Set("mode", string(filters.Mode))
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return template.URL(values.Encode() + "&")
 }
 
 func (h *Handlers) ListProducts(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
-	categoryIDStr := r.URL.Query().Get("category")
+	filters := parseSearchFilters(r.URL.Query())
 	pageStr := r.URL.Query().Get("page")
 	pageSizeStr := r.URL.Query().Get("pageSize")
 	sortBy := r.URL.Query().Get("sort")
 
-	// Parse category ID
-	categoryID := 0
-	if categoryIDStr != "" {
-		if id, err := strconv.Atoi(categoryIDStr); err == nil {
-			categoryID = id
-		}
-	}
-
 	// Parse pagination parameters
 	page := 1
 	if pageStr != "" {
@@ -71,63 +159,104 @@ func (h *Handlers) ListProducts(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Validate sort parameter
+	// Validate sort parameter. Searches default to relevance, which only
+	// applies when there is a query to be relevant to.
 	validSorts := map[string]bool{"name": true, "price_asc": true, "price_desc": true, "popularity": true, "newest": true}
+	if query != "" {
+		validSorts["relevance"] = true
+	}
 	if sortBy == "" || !validSorts[sortBy] {
 		sortBy = "name" // Default sort
+		if query != "" {
+			sortBy = "relevance"
+		}
 	}
 
-	var products []models.Product
-	var pagination *models.Pagination
-	var err error
+	started := time.Now()
+	result, err := h.Repo.Products().SearchProductsFaceted(r.Context(), query, filters, page, pageSize, sortBy)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", 500)
+		return
+	}
 
-	// Use paginated methods with sorting
-	if query != "" || categoryID > 0 {
-		result, err := h.Repo.Products().SearchProductsPaginatedSorted(query, categoryID, page, pageSize, sortBy)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, "Internal Server Error", 500)
-			return
+	// When nothing matches, show the results for a respelled query instead,
+	// unless the user asked for their exact spelling
+	var originalQuery string
+	if query != "" && result.Pagination.TotalItems == 0 && r.URL.Query().Get("exact") != "1" {
+		if corrected := h.suggestQuery(query); corrected != "" {
+			retried, err := h.Repo.Products().SearchProductsFaceted(r.Context(), corrected, filters, page, pageSize, sortBy)
+			if err != nil {
+				log.Printf("Error searching for suggested query %q: %v", corrected, err)
+			} else if retried.Pagination.TotalItems > 0 {
+				originalQuery, query, result = query, corrected, retried
+			}
 		}
-		products = result.Products
-		pagination = &result.Pagination
-	} else {
-		result, err := h.Repo.Products().ListProductsPaginatedSorted(page, pageSize, sortBy)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, "Internal Server Error", 500)
-			return
+	}
+
+	// Record new searches for analytics. Later pages carry the search's ID
+	// so clicks on them count towards it too.
+	searchID, _ := strconv.ParseInt(r.URL.Query().Get("search"), 10, 64)
+	if searchID <= 0 && page == 1 && (query != "" || !filters.IsEmpty()) {
+		event := models.SearchEvent{
+			Query:       strings.TrimSpace(query),
+			Filters:     filters,
+			ResultCount: result.Pagination.TotalItems,
+			Latency:     time.Since(started),
+		}
+		if originalQuery != "" {
+			event.Query, event.CorrectedQuery = strings.TrimSpace(originalQuery), query
+		}
+		searchID = h.recordSearch(w, r, event)
+	}
+	items := productListItems(result.Hits)
+	filterQueryURL := filterQuery(query, filters)
+	if searchID > 0 {
+		for i := range items {
+			items[i].Href = fmt.Sprintf("/products/%d?search=%d&pos=%d", items[i].ID, searchID, (page-1)*pageSize+i+1)
 		}
-		products = result.Products
-		pagination = &result.Pagination
+		filterQueryURL += template.URL(fmt.Sprintf("search=%d&", searchID))
 	}
 
-	// Fetch all categories for the sidebar
+	// Fetch all categories for the mobile dropdown
 	categories, err := h.Repo.Products().ListCategories()
 	if err != nil {
 		log.Println("Error fetching categories:", err)
 		categories = []models.Category{} // Continue with empty categories
 	}
 
+	selectedCategory := 0
+	if len(filters.CategoryIDs) > 0 {
+		selectedCategory = filters.CategoryIDs[0]
+	}
+
 	// Sort options for dropdown
-	sortOptions := []SortOption{
+	var sortOptions []SortOption
+	if query != "" {
+		sortOptions = append(sortOptions, SortOption{Value: "relevance", Label: "Best Match"})
+	}
+	sortOptions = append(sortOptions, []SortOption{
 		{Value: "name", Label: "Name (A-Z)"},
 		{Value: "price_asc", Label: "Price (Low to High)"},
 		{Value: "price_desc", Label: "Price (High to Low)"},
 		{Value: "popularity", Label: "Most Popular"},
 		{Value: "newest", Label: "Newest First"},
-	}
+	}...)
 
 	data := ProductListViewData{
 		IsAuthenticated:   h.IsAuthenticated(r),
 		ReaderBrowserURL:  h.ReaderBrowserURL,
 		ChatbotBrowserURL: h.ChatbotBrowserURL,
-		Products:          products,
+		Products:          items,
 		Categories:        categories,
 		SearchQuery:       query,
-		SelectedCategory:  categoryID,
-		ResultCount:       pagination.TotalItems,
-		Pagination:        pagination,
+		OriginalQuery:     originalQuery,
+		SelectedCategory:  selectedCategory,
+		Facets:            result.Facets,
+		Filters:           filters,
+		FilterQuery:       filterQueryURL,
+		ResultCount:       result.Pagination.TotalItems,
+		Pagination:        &result.Pagination,
 		PageSize:          pageSize,
 		PageSizeOptions:   []int{10, 20, 30, 50, 100},
 		SortBy:            sortBy,
@@ -155,6 +284,10 @@ func (h *Handlers) ListProducts(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	for name, fn := range h.templateFuncs(w, r) {
+		funcMap[name] = fn
+	}
+
 	ts, err := template.New("").Funcs(funcMap).ParseFiles("./templates/base.html", "./templates/products.html")
 	if err != nil {
 		log.Println(err)
@@ -167,46 +300,64 @@ func (h *Handlers) ListProducts(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// suggestionLimit is how many suggestions of each kind the search box shows
+const suggestionLimit = 5
+
+// SearchSuggestionsData is the search box completion partial's data
+type SearchSuggestionsData struct {
+	Suggestions *models.Suggestions
+	Query       string
+	Corrected   string // Respelling the suggestions are for, when the query had none
+}
+
+// SearchSuggestions renders completions for the search box as grouped
+// list items. When nothing completes the query, the completions of its
+// respelling are shown instead.
 func (h *Handlers) SearchSuggestions(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("q")
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
 
 	// Don't search for very short queries
-	if len(query) < 2 {
-		if _, err := w.Write([]byte("")); err != nil {
-			log.Printf("Error writing response: %v", err)
-		}
+	if len([]rune(query)) < 2 {
 		return
 	}
 
-	// Search for products
-	products, err := h.Repo.Products().SearchProducts(query, 0)
+	suggestions, err := h.Repo.Products().SuggestCompletions(query, suggestionLimit)
 	if err != nil {
 		log.Println(err)
-		if _, err := w.Write([]byte("")); err != nil {
-			log.Printf("Error writing response: %v", err)
-		}
 		return
 	}
 
-	// Limit to top 5 results
-	if len(products) > 5 {
-		products = products[:5]
+	data := SearchSuggestionsData{Suggestions: suggestions, Query: query}
+	if suggestions.IsEmpty() {
+		if corrected := h.suggestQuery(query); corrected != "" {
+			retried, err := h.Repo.Products().SuggestCompletions(corrected, suggestionLimit)
+			if err != nil {
+				log.Printf("Error completing suggested query %q: %v", corrected, err)
+			} else if !retried.IsEmpty() {
+				data.Suggestions, data.Corrected = retried, corrected
+			}
+		}
 	}
 
-	// Return HTML list of suggestions
-	if len(products) == 0 {
-		if _, err := w.Write([]byte("<li><em>No results found</em></li>")); err != nil {
-			log.Printf("Error writing response: %v", err)
-		}
+	ts, err := template.ParseFiles("./templates/partials/search-suggestions.html")
+	if err != nil {
+		log.Println(err)
 		return
 	}
+	if err := ts.Execute(w, data); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
 
-	for _, p := range products {
-		html := `<li><a href="/products/` + strconv.Itoa(p.ID) + `">` + p.Name + `</a></li>`
-		if _, err := w.Write([]byte(html)); err != nil {
-			log.Printf("Error writing response: %v", err)
-		}
+// suggestQuery returns the repository's respelling of query, or "" if there
+// is none or it could not be worked out
+func (h *Handlers) suggestQuery(query string) string {
+	corrected, err := h.Repo.Products().SuggestQuery(query)
+	if err != nil {
+		log.Printf("Error suggesting a spelling for %q: %v", query, err)
+		return ""
 	}
+	return corrected
 }
 
 func (h *Handlers) ProductDetail(w http.ResponseWriter, r *http.Request) {
@@ -227,6 +378,9 @@ func (h *Handlers) ProductDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Count the visit as a click on the search result it came from
+	h.recordSearchClick(r, productID)
+
 	// Fetch reviews for this product
 	reviews, err := h.Repo.Reviews().GetReviewsByProductID(productID)
 	if err != nil {
@@ -261,12 +415,18 @@ func (h *Handlers) ProductDetail(w http.ResponseWriter, r *http.Request) {
 
 	// Check if current user has already reviewed this product
 	var userReview *models.Review
+	var emailVerified bool
 	userID, authenticated := h.GetUserID(r)
 	if authenticated {
 		userReview, err = h.Repo.Reviews().GetReviewByUserAndProduct(userID, productID)
 		if err != nil {
 			log.Printf("Error fetching user review: %v", err)
 		}
+		if user, err := h.Repo.Users().GetUserByID(userID); err != nil {
+			log.Printf("Error fetching user: %v", err)
+		} else {
+			emailVerified = user.EmailVerified()
+		}
 	}
 
 	data := ProductDetailViewData{
@@ -279,9 +439,10 @@ func (h *Handlers) ProductDetail(w http.ResponseWriter, r *http.Request) {
 		Rating:            rating,
 		RatingBars:        ratingBars,
 		UserReview:        userReview,
+		EmailVerified:     emailVerified,
 	}
 
-	ts, err := template.ParseFiles("./templates/base.html", "./templates/product-detail.html")
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/product-detail.html")
 	if err != nil {
 		log.Println("Template parsing error:", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -2,9 +2,9 @@ package handlers
 
 import (
 	"DemoApp/internal/models"
-	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
@@ -14,6 +14,10 @@ type ProfileViewData struct {
 	ChatbotBrowserURL string
 	User              *models.User
 	OrderCount        int
+	PendingEmail      string // New address awaiting confirmation
+	PasskeysEnabled   bool
+	Sessions          []models.UserSession
+	Identities        []models.UserIdentity // Linked social logins
 	Error             string
 	Success           string
 }
@@ -40,16 +44,40 @@ func (h *Handlers) ProfilePage(w http.ResponseWriter, r *http.Request) {
 		orderCount = len(orders)
 	}
 
+	pendingEmail, err := h.Repo.EmailVerifications().PendingEmail(userID)
+	if err != nil {
+		log.Printf("Error fetching pending email change: %v", err)
+	}
+
+	activeSessions, err := h.Repo.Sessions().ListSessions(userID)
+	if err != nil {
+		log.Printf("Error listing sessions: %v", err)
+	}
+	current := h.currentSessionHash(r)
+	for i := range activeSessions {
+		activeSessions[i].Current = activeSessions[i].TokenHash == current
+	}
+
+	identities, err := h.Repo.Identities().ListIdentities(userID)
+	if err != nil {
+		log.Printf("Error listing linked identities: %v", err)
+	}
+
 	data := ProfileViewData{
 		IsAuthenticated:   true,
 		ReaderBrowserURL:  h.ReaderBrowserURL,
 		ChatbotBrowserURL: h.ChatbotBrowserURL,
 		User:              user,
 		OrderCount:        orderCount,
+		PendingEmail:      pendingEmail,
+		PasskeysEnabled:   h.Passkeys != nil,
+		Sessions:          activeSessions,
+		Identities:        identities,
 		Success:           r.URL.Query().Get("success"),
+		Error:             r.URL.Query().Get("error"),
 	}
 
-	ts, err := template.ParseFiles("./templates/base.html", "./templates/profile.html")
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/profile.html")
 	if err != nil {
 		log.Printf("Error parsing template: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -84,7 +112,7 @@ func (h *Handlers) ProfileEditPage(w http.ResponseWriter, r *http.Request) {
 		Error:             r.URL.Query().Get("error"),
 	}
 
-	ts, err := template.ParseFiles("./templates/base.html", "./templates/profile-edit.html")
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/profile-edit.html")
 	if err != nil {
 		log.Printf("Error parsing template: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -105,10 +133,10 @@ func (h *Handlers) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	fullName := strings.TrimSpace(r.FormValue("full_name"))
-	email := strings.TrimSpace(r.FormValue("email"))
+	email, err := normalizeEmail(r.FormValue("email"))
 
 	// Validate email
-	if !strings.Contains(email, "@") {
+	if err != nil {
 		http.Redirect(w, r, "/profile/edit?error=Invalid+email+format", http.StatusFound)
 		return
 	}
@@ -119,14 +147,43 @@ func (h *Handlers) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, err := h.Repo.Users().GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error fetching user: %v", err)
+		http.Redirect(w, r, "/profile/edit?error=Could+not+update+profile", http.StatusFound)
+		return
+	}
+
+	// A new address only replaces the current one once it is confirmed, so
+	// the name is saved now with the existing email. An edit that only
+	// changes the letter case is not a new address and leaves it as it is.
+	newEmail := email
+	emailChanged := !strings.EqualFold(newEmail, user.Email)
+	if emailChanged {
+		if other, err := h.Repo.Users().GetUserByEmail(newEmail); err == nil && other != nil {
+			http.Redirect(w, r, "/profile/edit?error=That+email+address+is+already+in+use", http.StatusFound)
+			return
+		}
+	}
+
 	// Update user profile
-	err := h.Repo.Users().UpdateUserProfile(userID, email, fullName)
+	err = h.Repo.Users().UpdateUserProfile(userID, user.Email, fullName)
 	if err != nil {
 		log.Printf("Error updating profile: %v", err)
 		http.Redirect(w, r, "/profile/edit?error=Could+not+update+profile", http.StatusFound)
 		return
 	}
 
+	if emailChanged {
+		if err := h.sendVerificationEmail(userID, newEmail, true); err != nil {
+			log.Printf("Error sending email change verification for user %d: %v", userID, err)
+			http.Redirect(w, r, "/profile/edit?error=Could+not+send+confirmation+email", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/profile?success="+url.QueryEscape("Profile updated. We've sent a link to "+newEmail+"; your email address will change once you confirm it."), http.StatusFound)
+		return
+	}
+
 	http.Redirect(w, r, "/profile?success=Profile+updated+successfully", http.StatusFound)
 }
 
@@ -153,7 +210,7 @@ func (h *Handlers) ProfilePasswordPage(w http.ResponseWriter, r *http.Request) {
 		Error:             r.URL.Query().Get("error"),
 	}
 
-	ts, err := template.ParseFiles("./templates/base.html", "./templates/profile-password.html")
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/profile-password.html")
 	if err != nil {
 		log.Printf("Error parsing template: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -185,6 +242,13 @@ func (h *Handlers) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Accounts created through a social login have no password to check;
+	// proving control of the mailbox is how they set one
+	if !user.HasPassword() {
+		http.Redirect(w, r, "/profile/password?error=Your+account+has+no+password+yet.+Use+Forgot+password+on+the+login+page+to+set+one", http.StatusFound)
+		return
+	}
+
 	// Verify current password
 	if !user.CheckPassword(currentPassword) {
 		http.Redirect(w, r, "/profile/password?error=Current+password+is+incorrect", http.StatusFound)
@@ -217,5 +281,16 @@ func (h *Handlers) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Anyone else holding a session, such as whoever prompted the change,
+	// is signed out
+	revoked := h.revokeOtherSessions(r, userID)
+	h.audit(models.AuditEntry{UserID: &userID, Event: models.AuditPasswordChanged, IP: h.clientIP(r), Details: map[string]interface{}{
+		"sessions_revoked": revoked,
+	}})
+
+	if revoked > 0 {
+		http.Redirect(w, r, "/profile?success=Password+changed+successfully.+Your+other+sessions+were+signed+out.", http.StatusFound)
+		return
+	}
 	http.Redirect(w, r, "/profile?success=Password+changed+successfully", http.StatusFound)
 }
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"DemoApp/internal/models"
+	"DemoApp/internal/repository"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// profileRepo holds one user in memory and records profile updates and
+// email change tokens
+type profileRepo struct {
+	repository.Repository
+	user          models.User
+	verifications []string
+}
+
+func (f *profileRepo) Users() repository.UserRepository { return profileUsers{repo: f} }
+func (f *profileRepo) EmailVerifications() repository.EmailVerificationRepository {
+	return profileVerifications{repo: f}
+}
+
+type profileUsers struct {
+	repository.UserRepository
+	repo *profileRepo
+}
+
+func (f profileUsers) GetUserByID(id int) (*models.User, error) {
+	user := f.repo.user
+	return &user, nil
+}
+
+func (f profileUsers) UpdateUserProfile(id int, email, fullName string) error {
+	f.repo.user.Email = email
+	f.repo.user.FullName = &fullName
+	return nil
+}
+
+type profileVerifications struct {
+	repository.EmailVerificationRepository
+	repo *profileRepo
+}
+
+func (f profileVerifications) CreateEmailVerification(userID int, email, tokenHash string, expiresAt time.Time) error {
+	f.repo.verifications = append(f.repo.verifications, email)
+	return nil
+}
+
+// TestUpdateProfileCaseOnlyEmail checks that changing only the letter case
+// of the email saves the name but leaves the confirmed address untouched
+func TestUpdateProfileCaseOnlyEmail(t *testing.T) {
+	repo := &profileRepo{user: models.User{ID: 7, Email: "reader@example.com"}}
+	h := &Handlers{Repo: repo, Store: sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))}
+
+	// Sign in by saving a session cookie for the user
+	signIn := httptest.NewRecorder()
+	session, _ := h.Store.Get(httptest.NewRequest(http.MethodGet, "/", nil), "cart-session")
+	session.Values["user_id"] = 7
+	if err := session.Save(httptest.NewRequest(http.MethodGet, "/", nil), signIn); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"email": {"Reader@Example.com"}, "full_name": {"Ada Reader"}}
+	req := httptest.NewRequest(http.MethodPost, "/profile/update", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range signIn.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	h.UpdateProfile(rec, req)
+
+	if loc := rec.Header().Get("Location"); !strings.HasPrefix(loc, "/profile?success=") {
+		t.Fatalf("expected redirect to profile with success, got %d %q", rec.Code, loc)
+	}
+	if repo.user.Email != "reader@example.com" {
+		t.Errorf("email changed to %q without confirmation", repo.user.Email)
+	}
+	if repo.user.FullName == nil || *repo.user.FullName != "Ada Reader" {
+		t.Errorf("full name not saved: %v", repo.user.FullName)
+	}
+	if len(repo.verifications) != 0 {
+		t.Errorf("expected no email change link, got %v", repo.verifications)
+	}
+}
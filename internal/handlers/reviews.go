@@ -14,6 +14,9 @@ func (h *Handlers) SubmitReview(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
+	if !h.requireVerifiedEmail(w, r, userID, "writing reviews") {
+		return
+	}
 
 	// Parse product ID from URL
 	productIDStr := r.PathValue("id")
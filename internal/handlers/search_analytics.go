@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"DemoApp/internal/models"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// searchSessionKey holds the ID tying a browser's searches to the results it
+// clicks. It is separate from the cart's session ID so recording searches
+// does not change how carts are looked up.
+const searchSessionKey = "search_session"
+
+// searchReportLimit is how many queries each list of the search report shows
+const searchReportLimit = 25
+
+// searchReportPeriods are the choices of how many days the report covers
+var searchReportPeriods = []int{1, 7, 30, 90}
+
+// searchSessionID returns the browser's search session ID, creating and
+// saving one if needed. It must be called before anything is written to w.
+func (h *Handlers) searchSessionID(w http.ResponseWriter, r *http.Request) string {
+	session, _ := h.Store.Get(r, "cart-session")
+	if id, ok := session.Values[searchSessionKey].(string); ok && id != "" {
+		return id
+	}
+
+	id := uuid.New().String()
+	session.Values[searchSessionKey] = id
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Error saving session: %v", err)
+		return ""
+	}
+	return id
+}
+
+// recordSearch stores a search for analytics and returns its ID, or 0 if
+// it could not be stored. Analytics never fail the search itself.
+func (h *Handlers) recordSearch(w http.ResponseWriter, r *http.Request, event models.SearchEvent) int64 {
+	event.SessionID = h.searchSessionID(w, r)
+	if userID, ok := h.GetUserID(r); ok {
+		event.UserID = &userID
+	}
+	id, err := h.Repo.SearchAnalytics().RecordSearch(event)
+	if err != nil {
+		log.Printf("Error recording search: %v", err)
+		return 0
+	}
+	return id
+}
+
+// recordSearchClick stores a visit to a product page as a click on a search
+// result when the link came from one, carrying ?search=ID&pos=N
+func (h *Handlers) recordSearchClick(r *http.Request, productID int) {
+	searchID, err := strconv.ParseInt(r.URL.Query().Get("search"), 10, 64)
+	if err != nil || searchID <= 0 {
+		return
+	}
+	position, err := strconv.Atoi(r.URL.Query().Get("pos"))
+	if err != nil || position <= 0 {
+		return
+	}
+
+	session, _ := h.Store.Get(r, "cart-session")
+	sessionID, _ := session.Values[searchSessionKey].(string)
+	if sessionID == "" {
+		return
+	}
+	if err := h.Repo.SearchAnalytics().RecordClick(searchID, sessionID, productID, position); err != nil {
+		log.Printf("Error recording search click: %v", err)
+	}
+}
+
+type AdminSearchViewData struct {
+	IsAuthenticated   bool
+	ReaderBrowserURL  string
+	ChatbotBrowserURL string
+	Report            *models.SearchReport
+	Days              int
+	Periods           []int
+}
+
+// AdminSearchAnalytics reports the most common searches, the searches that
+// found nothing and how often results are clicked
+// GET /admin/search?days=30
+func (h *Handlers) AdminSearchAnalytics(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if d, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && d > 0 && d <= 365 {
+		days = d
+	}
+
+	report, err := h.Repo.SearchAnalytics().SearchReport(time.Now().AddDate(0, 0, -days), searchReportLimit)
+	if err != nil {
+		log.Printf("Error building search report: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := AdminSearchViewData{
+		IsAuthenticated:   true,
+		ReaderBrowserURL:  h.ReaderBrowserURL,
+		ChatbotBrowserURL: h.ChatbotBrowserURL,
+		Report:            report,
+		Days:              days,
+		Periods:           searchReportPeriods,
+	}
+
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/admin-search.html")
+	if err != nil {
+		log.Printf("Error parsing template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := ts.ExecuteTemplate(w, "admin-search.html", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
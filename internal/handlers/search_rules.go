@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"DemoApp/internal/models"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// searchPreviewLimit is how many results the rules preview compares
+const searchPreviewLimit = 10
+
+type AdminSearchRulesViewData struct {
+	IsAuthenticated   bool
+	ReaderBrowserURL  string
+	ChatbotBrowserURL string
+	SynonymSets       []models.SynonymSet
+	Promotions        []models.SearchPromotion
+	Preview           *models.SearchPreview
+	PreviewQuery      string
+	Error             string
+}
+
+// AdminSearchRules lists the synonym sets and promoted products, and
+// previews how they change the results of ?q=
+// GET /admin/search/rules
+func (h *Handlers) AdminSearchRules(w http.ResponseWriter, r *http.Request) {
+	h.renderAdminSearchRules(w, r, "")
+}
+
+func (h *Handlers) renderAdminSearchRules(w http.ResponseWriter, r *http.Request, errMsg string) {
+	sets, err := h.Repo.SearchRules().ListSynonymSets()
+	if err != nil {
+		log.Printf("Error listing synonym sets: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	promotions, err := h.Repo.SearchRules().ListPromotions()
+	if err != nil {
+		log.Printf("Error listing search promotions: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := AdminSearchRulesViewData{
+		IsAuthenticated:   true,
+		ReaderBrowserURL:  h.ReaderBrowserURL,
+		ChatbotBrowserURL: h.ChatbotBrowserURL,
+		SynonymSets:       sets,
+		Promotions:        promotions,
+		PreviewQuery:      strings.TrimSpace(r.URL.Query().Get("q")),
+		Error:             errMsg,
+	}
+	if data.PreviewQuery != "" {
+		data.Preview, err = h.Repo.SearchRules().PreviewSearch(r.Context(), data.PreviewQuery, searchPreviewLimit)
+		if err != nil {
+			log.Printf("Error previewing search %q: %v", data.PreviewQuery, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/admin-search-rules.html")
+	if err != nil {
+		log.Printf("Error parsing template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := ts.ExecuteTemplate(w, "admin-search-rules.html", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// parseSynonymTerms splits a comma-separated list of equivalent terms,
+// lowercased, requiring at least two different ones
+func parseSynonymTerms(input string) ([]string, error) {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(input, ",") {
+		t = strings.Join(strings.Fields(strings.ToLower(t)), " ")
+		if t == "" || seen[t] {
+			continue
+		}
+		if len(t) > 100 || strings.Contains(t, "=>") {
+			return nil, errors.New("terms must be under 100 characters and cannot contain \"=>\"")
+		}
+		seen[t] = true
+		terms = append(terms, t)
+	}
+	if len(terms) < 2 {
+		return nil, errors.New("enter at least two different terms, separated by commas")
+	}
+	return terms, nil
+}
+
+// AdminCreateSynonymSet adds a group of equivalent terms and pushes the
+// synonyms to Elasticsearch
+// POST /admin/search/synonyms
+func (h *Handlers) AdminCreateSynonymSet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	terms, err := parseSynonymTerms(r.FormValue("terms"))
+	if err != nil {
+		h.renderAdminSearchRules(w, r, "Synonyms not saved: "+err.Error())
+		return
+	}
+	if _, err := h.Repo.SearchRules().CreateSynonymSet(terms); err != nil {
+		log.Printf("Error creating synonym set: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	h.syncSynonyms(w, r)
+}
+
+// AdminDeleteSynonymSet removes a group of synonyms
+// POST /admin/search/synonyms/{id}/delete
+func (h *Handlers) AdminDeleteSynonymSet(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminPostID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Repo.SearchRules().DeleteSynonymSet(id); err != nil {
+		log.Printf("Error deleting synonym set %d: %v", id, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	h.syncSynonyms(w, r)
+}
+
+// syncSynonyms pushes the saved synonyms to Elasticsearch and returns to the
+// rules page, explaining if the push failed
+func (h *Handlers) syncSynonyms(w http.ResponseWriter, r *http.Request) {
+	if err := h.Repo.SearchRules().SyncSynonyms(); err != nil {
+		log.Printf("Error pushing synonyms to Elasticsearch: %v", err)
+		h.renderAdminSearchRules(w, r, "Synonyms saved, but Elasticsearch could not be updated; they apply to SQL search only until the next restart.")
+		return
+	}
+	http.Redirect(w, r, "/admin/search/rules", http.StatusSeeOther)
+}
+
+// AdminCreatePromotion pins or boosts a product for a query
+// POST /admin/search/promotions
+func (h *Handlers) AdminCreatePromotion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	promotion := models.SearchPromotion{
+		Query:  strings.TrimSpace(r.FormValue("query")),
+		Pinned: r.FormValue("mode") == "pin",
+		Boost:  1,
+	}
+	if promotion.Query == "" {
+		h.renderAdminSearchRules(w, r, "Promotion not saved: enter the query it applies to")
+		return
+	}
+	productID, err := strconv.Atoi(r.FormValue("product_id"))
+	if err != nil {
+		h.renderAdminSearchRules(w, r, "Promotion not saved: enter a product ID")
+		return
+	}
+	if _, err := h.Repo.Products().GetProductByID(productID); err != nil {
+		h.renderAdminSearchRules(w, r, "Promotion not saved: there is no product "+strconv.Itoa(productID))
+		return
+	}
+	promotion.ProductID = productID
+	if !promotion.Pinned {
+		boost, err := strconv.ParseFloat(r.FormValue("boost"), 64)
+		if err != nil || boost <= 0 || boost > 100 {
+			h.renderAdminSearchRules(w, r, "Promotion not saved: the boost must be a number above 0 and at most 100")
+			return
+		}
+		promotion.Boost = boost
+	}
+
+	if _, err := h.Repo.SearchRules().CreatePromotion(promotion); err != nil {
+		log.Printf("Error creating search promotion: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/search/rules?q="+url.QueryEscape(promotion.Query), http.StatusSeeOther)
+}
+
+// AdminDeletePromotion removes a pinned or boosted product
+// POST /admin/search/promotions/{id}/delete
+func (h *Handlers) AdminDeletePromotion(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminPostID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Repo.SearchRules().DeletePromotion(id); err != nil {
+		log.Printf("Error deleting search promotion %d: %v", id, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/search/rules", http.StatusSeeOther)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"DemoApp/internal/models"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+)
+
+// sessionKeyToken holds the random ID that ties a cookie session to its
+// user_sessions row
+const sessionKeyToken = "sid"
+
+// maxUserAgentLength caps what is stored from the User-Agent header
+const maxUserAgentLength = 512
+
+// startSession records a new signed-in session for userID and stores its ID
+// in the cookie session
+func (h *Handlers) startSession(r *http.Request, session *sessions.Session, userID int) error {
+	token, hash, err := models.NewToken()
+	if err != nil {
+		return err
+	}
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	if err := h.Repo.Sessions().CreateSession(userID, hash, userAgent, h.clientIP(r)); err != nil {
+		return err
+	}
+	session.Values[sessionKeyToken] = token
+	return nil
+}
+
+// currentSessionHash returns the stored hash of the request's session ID, or ""
+func (h *Handlers) currentSessionHash(r *http.Request) string {
+	session, _ := h.Store.Get(r, "cart-session")
+	token, _ := session.Values[sessionKeyToken].(string)
+	if token == "" {
+		return ""
+	}
+	return models.HashToken(token)
+}
+
+// endSession signs the request's session out and revokes its record
+func (h *Handlers) endSession(w http.ResponseWriter, r *http.Request, session *sessions.Session) error {
+	if token, _ := session.Values[sessionKeyToken].(string); token != "" {
+		if err := h.Repo.Sessions().RevokeSessionByToken(models.HashToken(token)); err != nil {
+			log.Printf("Error revoking session: %v", err)
+		}
+	}
+	clearSignIn(session)
+	return session.Save(r, w)
+}
+
+// clearSignIn removes the signed-in user from session. The CSRF token goes
+// too, so the signed-out session gets a fresh one.
+func clearSignIn(session *sessions.Session) {
+	delete(session.Values, "user_id")
+	delete(session.Values, sessionKeyToken)
+	delete(session.Values, csrfSessionKey)
+}
+
+// TrackSessions signs out requests whose session has been revoked from
+// another device, and keeps each live session's last-seen time current.
+// Sessions from before tracking existed have no ID and are signed out too.
+func (h *Handlers) TrackSessions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("cart-session"); err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		session, _ := h.Store.Get(r, "cart-session")
+		if userID, ok := session.Values["user_id"].(int); ok {
+			live := false
+			if token, _ := session.Values[sessionKeyToken].(string); token != "" {
+				var err error
+				live, err = h.Repo.Sessions().TouchSession(userID, models.HashToken(token), h.clientIP(r))
+				if err != nil {
+					// Keep the user signed in rather than failing every page
+					log.Printf("Error checking session for user %d: %v", userID, err)
+					live = true
+				}
+			}
+			if !live {
+				clearSignIn(session)
+				if err := session.Save(r, w); err != nil {
+					log.Printf("Error saving session: %v", err)
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// revokeOtherSessions signs userID out everywhere except the current
+// session, returning how many sessions were ended
+func (h *Handlers) revokeOtherSessions(r *http.Request, userID int) int {
+	n, err := h.Repo.Sessions().RevokeUserSessions(userID, h.currentSessionHash(r))
+	if err != nil {
+		log.Printf("Error revoking sessions for user %d: %v", userID, err)
+	}
+	return n
+}
+
+// RevokeSession signs one of the user's other sessions out
+// POST /profile/sessions/{id}/revoke
+func (h *Handlers) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.GetUserID(r)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/profile", http.StatusFound)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := h.Repo.Sessions().RevokeSession(id, userID)
+	if err != nil {
+		log.Printf("Error revoking session %d: %v", id, err)
+		http.Redirect(w, r, "/profile?error=Could+not+sign+out+session", http.StatusFound)
+		return
+	}
+	if revoked {
+		h.audit(models.AuditEntry{UserID: &userID, Event: models.AuditSessionRevoked, IP: h.clientIP(r), Details: map[string]interface{}{
+			"session_id": id,
+		}})
+	}
+	http.Redirect(w, r, "/profile?success=Session+signed+out", http.StatusFound)
+}
+
+// SignOutEverywhere ends every session of the user, including this one
+// POST /profile/sessions/revoke-all
+func (h *Handlers) SignOutEverywhere(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.GetUserID(r)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/profile", http.StatusFound)
+		return
+	}
+
+	n, err := h.Repo.Sessions().RevokeUserSessions(userID, "")
+	if err != nil {
+		log.Printf("Error revoking sessions for user %d: %v", userID, err)
+		http.Redirect(w, r, "/profile?error=Could+not+sign+out+everywhere", http.StatusFound)
+		return
+	}
+	h.audit(models.AuditEntry{UserID: &userID, Event: models.AuditSessionsRevokedAll, IP: h.clientIP(r), Details: map[string]interface{}{
+		"sessions": n,
+	}})
+
+	session, _ := h.Store.Get(r, "cart-session")
+	if err := h.endSession(w, r, session); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+	http.Redirect(w, r, "/login?signed_out=1", http.StatusFound)
+}
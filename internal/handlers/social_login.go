@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"DemoApp/internal/identity"
+	"DemoApp/internal/mail"
+	"DemoApp/internal/models"
+	"DemoApp/internal/repository"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// sessionOAuthLogin holds the provider sign-in in progress
+const sessionOAuthLogin = "oauth_login"
+
+// oauthLoginTTL bounds how long the user may spend at the provider
+const oauthLoginTTL = 10 * time.Minute
+
+// oauthLogin is what the callback needs to check the provider's response
+type oauthLogin struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Next     string `json:"next"`
+	Expires  int64  `json:"expires"`
+}
+
+// IdentityProviderLink is a "Continue with ..." button on the login and signup pages
+type IdentityProviderLink struct {
+	Name        string
+	DisplayName string
+}
+
+func (h *Handlers) identityProviderLinks() []IdentityProviderLink {
+	links := make([]IdentityProviderLink, 0, len(h.IdentityProviders))
+	for _, p := range h.IdentityProviders {
+		links = append(links, IdentityProviderLink{Name: p.Name(), DisplayName: p.DisplayName()})
+	}
+	return links
+}
+
+func (h *Handlers) identityProvider(name string) identity.Provider {
+	for _, p := range h.IdentityProviders {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// OAuthLogin sends the browser to the provider to sign in
+// GET /login/oauth/{provider}?next=...
+func (h *Handlers) OAuthLogin(w http.ResponseWriter, r *http.Request) {
+	provider := h.identityProvider(r.PathValue("provider"))
+	if provider == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	state, _, err := models.NewToken()
+	if err != nil {
+		log.Printf("Error generating OAuth state: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	nonce, _, err := models.NewToken()
+	if err != nil {
+		log.Printf("Error generating OAuth nonce: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	pending := oauthLogin{
+		Provider: provider.Name(),
+		State:    state,
+		Nonce:    nonce,
+		Verifier: identity.NewVerifier(),
+		Next:     h.safeNext(r.URL.Query().Get("next")),
+		Expires:  time.Now().Add(oauthLoginTTL).Unix(),
+	}
+	encoded, err := json.Marshal(pending)
+	if err != nil {
+		log.Printf("Error encoding OAuth login: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	session, _ := h.Store.Get(r, "cart-session")
+	session.Values[sessionOAuthLogin] = string(encoded)
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Error saving session: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, provider.AuthCodeURL(pending.State, pending.Nonce, pending.Verifier), http.StatusFound)
+}
+
+// OAuthCallback finishes a provider sign-in, signing into the linked account,
+// linking an existing account with the same verified email, or creating one
+// GET /login/oauth/{provider}/callback?code=...&state=...
+func (h *Handlers) OAuthCallback(w http.ResponseWriter, r *http.Request) {
+	provider := h.identityProvider(r.PathValue("provider"))
+	if provider == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	session, _ := h.Store.Get(r, "cart-session")
+	raw, _ := session.Values[sessionOAuthLogin].(string)
+	// Each state is good for one callback
+	delete(session.Values, sessionOAuthLogin)
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+
+	var pending oauthLogin
+	query := r.URL.Query()
+	if raw == "" || json.Unmarshal([]byte(raw), &pending) != nil ||
+		pending.Provider != provider.Name() || time.Now().Unix() > pending.Expires ||
+		subtle.ConstantTimeCompare([]byte(pending.State), []byte(query.Get("state"))) != 1 {
+		h.LoginPage(w, r, "Your sign-in with "+provider.DisplayName()+" expired or was started in another window. Please try again.")
+		return
+	}
+	if query.Get("error") != "" {
+		h.LoginPage(w, r, "Sign-in with "+provider.DisplayName()+" was cancelled.")
+		return
+	}
+
+	id, err := provider.Exchange(r.Context(), query.Get("code"), pending.Nonce, pending.Verifier)
+	if err != nil {
+		log.Printf("Error completing %s sign-in: %v", provider.Name(), err)
+		h.LoginPage(w, r, "We couldn't sign you in with "+provider.DisplayName()+". Please try again.")
+		return
+	}
+
+	userID, msg, err := h.resolveIdentity(r, provider, id)
+	if err != nil {
+		log.Printf("Error resolving %s identity: %v", provider.Name(), err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if msg != "" {
+		h.LoginPage(w, r, msg)
+		return
+	}
+
+	user, err := h.Repo.Users().GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error fetching user %d: %v", userID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	// The provider stands in for the password, not for the second factor
+	if user.TwoFactorEnabled {
+		h.startTwoFactorLogin(w, r, session, user.ID, pending.Next)
+		return
+	}
+	h.completeLogin(w, r, session, user.ID, pending.Next)
+}
+
+// resolveIdentity returns the account id signs in to. A non-empty message
+// means sign-in is refused and explains why to the user.
+func (h *Handlers) resolveIdentity(r *http.Request, provider identity.Provider, id *identity.Identity) (int, string, error) {
+	userID, err := h.Repo.Identities().FindIdentityUser(provider.Name(), id.Subject)
+	if err == nil {
+		return userID, "", nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, "", err
+	}
+
+	email, err := normalizeEmail(id.Email)
+	if err != nil {
+		return 0, provider.DisplayName() + " did not share an email address with us. Sign up with your email and a password instead.", nil
+	}
+
+	existing, err := h.Repo.Users().GetUserByEmail(email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, "", err
+	}
+	if existing != nil {
+		// Linking on an unverified address on either side would let whoever
+		// registered it first take over the other account
+		if !id.EmailVerified || !existing.EmailVerified() {
+			return 0, "An account already exists for " + email + ". Sign in with your password to continue.", nil
+		}
+		if err := h.Repo.Identities().LinkIdentity(existing.ID, provider.Name(), id.Subject, email); err != nil {
+			return 0, "", err
+		}
+		h.audit(models.AuditEntry{UserID: &existing.ID, Event: models.AuditIdentityLinked, IP: h.clientIP(r), Details: map[string]interface{}{
+			"provider": provider.Name(),
+		}})
+		go h.sendMail(mail.Message{
+			To:      existing.Email,
+			Subject: provider.DisplayName() + " sign-in added to your Bookstore account",
+			Body: "You can now sign in to your Bookstore account with " + provider.DisplayName() + ".\n\n" +
+				"If this was not you, reset your password at " + h.PublicURL + "/password/forgot and contact support.\n",
+		})
+		return existing.ID, "", nil
+	}
+
+	userID, err = h.Repo.Identities().CreateUserWithIdentity(email, id.Name, provider.Name(), id.Subject, id.EmailVerified)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		return 0, "An account already exists for " + email + ". Sign in with your password to continue.", nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	h.audit(models.AuditEntry{UserID: &userID, Event: models.AuditIdentityLinked, IP: h.clientIP(r), Details: map[string]interface{}{
+		"provider":    provider.Name(),
+		"new_account": true,
+	}})
+	if !id.EmailVerified {
+		if err := h.sendVerificationEmail(userID, email, false); err != nil {
+			log.Printf("Error sending verification email to user %d: %v", userID, err)
+		}
+	}
+	return userID, "", nil
+}
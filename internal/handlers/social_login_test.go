@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"DemoApp/internal/identity"
+	"DemoApp/internal/models"
+	"DemoApp/internal/repository"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// socialRepo keeps users and linked identities in memory for the social
+// login tests
+type socialRepo struct {
+	repository.Repository
+	users      []models.User
+	identities []models.UserIdentity
+}
+
+func (f *socialRepo) Users() repository.UserRepository          { return socialUsers{repo: f} }
+func (f *socialRepo) Identities() repository.IdentityRepository { return socialIdentities{repo: f} }
+func (f *socialRepo) Sessions() repository.SessionRepository    { return socialSessions{} }
+func (f *socialRepo) Audit() repository.AuditRepository         { return socialAudit{} }
+func (f *socialRepo) EmailVerifications() repository.EmailVerificationRepository {
+	return socialVerifications{}
+}
+
+type socialUsers struct {
+	repository.UserRepository
+	repo *socialRepo
+}
+
+func (f socialUsers) GetUserByEmail(email string) (*models.User, error) {
+	for i := range f.repo.users {
+		if f.repo.users[i].Email == email {
+			return &f.repo.users[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f socialUsers) GetUserByID(id int) (*models.User, error) {
+	for i := range f.repo.users {
+		if f.repo.users[i].ID == id {
+			return &f.repo.users[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+type socialIdentities struct {
+	repository.IdentityRepository
+	repo *socialRepo
+}
+
+func (f socialIdentities) FindIdentityUser(provider, subject string) (int, error) {
+	for _, id := range f.repo.identities {
+		if id.Provider == provider && id.Subject == subject {
+			return id.UserID, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (f socialIdentities) LinkIdentity(userID int, provider, subject, email string) error {
+	f.repo.identities = append(f.repo.identities, models.UserIdentity{UserID: userID, Provider: provider, Subject: subject, Email: &email})
+	return nil
+}
+
+func (f socialIdentities) CreateUserWithIdentity(email, fullName, provider, subject string, emailVerified bool) (int, error) {
+	if _, err := (socialUsers{repo: f.repo}).GetUserByEmail(email); err == nil {
+		return 0, repository.ErrEmailTaken
+	}
+	user := models.User{ID: len(f.repo.users) + 100, Email: email}
+	if emailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	f.repo.users = append(f.repo.users, user)
+	return user.ID, f.LinkIdentity(user.ID, provider, subject, email)
+}
+
+type socialSessions struct {
+	repository.SessionRepository
+}
+
+func (socialSessions) CreateSession(userID int, tokenHash, userAgent, ip string) error { return nil }
+
+type socialAudit struct{}
+
+func (socialAudit) Record(entry models.AuditEntry) error { return nil }
+
+type socialVerifications struct {
+	repository.EmailVerificationRepository
+}
+
+func (socialVerifications) CreateEmailVerification(userID int, email, tokenHash string, expiresAt time.Time) error {
+	return nil
+}
+
+// TestSocialLoginFlow runs the redirect to the stand-in provider and back,
+// checking the callback signs the browser in to the right account
+func TestSocialLoginFlow(t *testing.T) {
+	verified := time.Now()
+	repo := &socialRepo{users: []models.User{{ID: 7, Email: "reader@example.com", EmailVerifiedAt: &verified}}}
+	provider := &identity.Fake{
+		ProviderName: "test",
+		RedirectURL:  "/login/oauth/test/callback",
+		Identity:     identity.Identity{Subject: "abc", Email: "reader@example.com", EmailVerified: true},
+	}
+	h := &Handlers{
+		Repo:              repo,
+		Store:             sessions.NewCookieStore([]byte(strings.Repeat("k", 32))),
+		IdentityProviders: []identity.Provider{provider},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /login/oauth/{provider}", h.OAuthLogin)
+	mux.HandleFunc("GET /login/oauth/{provider}/callback", h.OAuthCallback)
+
+	start := httptest.NewRecorder()
+	mux.ServeHTTP(start, httptest.NewRequest(http.MethodGet, "/login/oauth/test?next=/orders", nil))
+	if start.Code != http.StatusFound {
+		t.Fatalf("expected a redirect to the provider, got %d", start.Code)
+	}
+
+	callback := httptest.NewRequest(http.MethodGet, start.Header().Get("Location"), nil)
+	for _, c := range start.Result().Cookies() {
+		callback.AddCookie(c)
+	}
+	done := httptest.NewRecorder()
+	mux.ServeHTTP(done, callback)
+	if done.Code != http.StatusFound || done.Header().Get("Location") != "/orders" {
+		t.Fatalf("expected a redirect to /orders, got %d %q: %s", done.Code, done.Header().Get("Location"), done.Body.String())
+	}
+
+	// The callback saves the session twice; the browser keeps the last cookie
+	cookies := done.Result().Cookies()
+	session := cookies[len(cookies)-1]
+
+	check := httptest.NewRequest(http.MethodGet, "/", nil)
+	check.AddCookie(session)
+	if userID, ok := h.GetUserID(check); !ok || userID != 7 {
+		t.Errorf("expected to be signed in as user 7, got %d (%v)", userID, ok)
+	}
+	if len(repo.identities) != 1 || repo.identities[0].UserID != 7 {
+		t.Errorf("expected the identity to be linked to user 7, got %+v", repo.identities)
+	}
+
+	// Replaying the callback must not sign in again
+	replay := httptest.NewRequest(http.MethodGet, start.Header().Get("Location"), nil)
+	replay.AddCookie(session)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, replay)
+	if rec.Code == http.StatusFound {
+		t.Errorf("expected a replayed callback to be refused, got redirect to %q", rec.Header().Get("Location"))
+	}
+}
+
+// TestResolveIdentity covers when a provider account may sign in to,
+// link to or create a local account
+func TestResolveIdentity(t *testing.T) {
+	verified := time.Now()
+	provider := &identity.Fake{ProviderName: "test"}
+
+	tests := []struct {
+		name        string
+		id          identity.Identity
+		wantUser    int
+		wantRefused bool
+	}{
+		{"already linked", identity.Identity{Subject: "linked", Email: "someone@example.com"}, 7, false},
+		{"verified email links", identity.Identity{Subject: "new", Email: "reader@example.com", EmailVerified: true}, 7, false},
+		{"unverified provider email", identity.Identity{Subject: "new", Email: "reader@example.com"}, 0, true},
+		{"unverified local account", identity.Identity{Subject: "new", Email: "pending@example.com", EmailVerified: true}, 0, true},
+		{"no email", identity.Identity{Subject: "new"}, 0, true},
+		{"new account", identity.Identity{Subject: "new", Email: "newcomer@example.com"}, 100 + 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &socialRepo{
+				users: []models.User{
+					{ID: 7, Email: "reader@example.com", EmailVerifiedAt: &verified},
+					{ID: 8, Email: "pending@example.com"},
+				},
+				identities: []models.UserIdentity{{UserID: 7, Provider: "test", Subject: "linked"}},
+			}
+			h := &Handlers{Repo: repo}
+
+			userID, msg, err := h.resolveIdentity(httptest.NewRequest(http.MethodGet, "/", nil), provider, &tt.id)
+			if err != nil {
+				t.Fatalf("resolveIdentity failed: %v", err)
+			}
+			if refused := msg != ""; refused != tt.wantRefused {
+				t.Fatalf("refused = %v (%q), want %v", refused, msg, tt.wantRefused)
+			}
+			if userID != tt.wantUser {
+				t.Errorf("userID = %d, want %d", userID, tt.wantUser)
+			}
+			if tt.wantRefused && len(repo.identities) != 1 {
+				t.Errorf("a refused sign-in linked an identity: %+v", repo.identities)
+			}
+		})
+	}
+}
@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"DemoApp/internal/mail"
+	"DemoApp/internal/models"
+	"DemoApp/internal/twofactor"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// twoFactorLoginTTL bounds the time between the password and code steps
+const twoFactorLoginTTL = 5 * time.Minute
+
+// Session keys for a login waiting on its second factor, and for an
+// authenticator being enrolled
+const (
+	sessionPending2FAUser    = "2fa_user_id"
+	sessionPending2FAExpires = "2fa_expires"
+	sessionPendingTOTPSecret = "totp_pending_secret"
+)
+
+type TwoFactorLoginData struct {
+	IsAuthenticated   bool
+	ReaderBrowserURL  string
+	ChatbotBrowserURL string
+	Error             string
+	Next              string
+}
+
+type TwoFactorPageData struct {
+	IsAuthenticated   bool
+	ReaderBrowserURL  string
+	ChatbotBrowserURL string
+	User              *models.User
+	TwoFactor         *models.TwoFactor // Nil until enrolled
+	QRCode            template.URL      // Enrollment QR code as a data: URI
+	Secret            string            // Enrollment secret for manual entry
+	RecoveryCodes     []string          // Shown once, right after they are issued
+	Error             string
+	Success           string
+}
+
+// startTwoFactorLogin records that userID passed the first factor and
+// sends them to the code prompt, carrying next along
+func (h *Handlers) startTwoFactorLogin(w http.ResponseWriter, r *http.Request, session *sessions.Session, userID int, next string) {
+	session.Values[sessionPending2FAUser] = userID
+	session.Values[sessionPending2FAExpires] = time.Now().Add(twoFactorLoginTTL).Unix()
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Error saving session: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	target := "/login/2fa"
+	if next := h.safeNext(next); next != "" {
+		target += "?next=" + url.QueryEscape(next)
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// pendingTwoFactorUser returns the user waiting on a second factor, if any
+func pendingTwoFactorUser(session *sessions.Session) (int, bool) {
+	userID, ok := session.Values[sessionPending2FAUser].(int)
+	expires, _ := session.Values[sessionPending2FAExpires].(int64)
+	if !ok || time.Now().Unix() > expires {
+		return 0, false
+	}
+	return userID, true
+}
+
+// verifySecondFactor checks a TOTP code, or a recovery code when the input
+// is not shaped like one. Each code works once.
+func (h *Handlers) verifySecondFactor(tf *models.TwoFactor, input string) (usedRecoveryCode, ok bool, err error) {
+	if twofactor.LooksLikeTOTP(input) {
+		step, valid := twofactor.Verify(tf.Secret, input, time.Now())
+		if !valid {
+			return false, false, nil
+		}
+		ok, err := h.Repo.TwoFactor().AcceptTOTPStep(tf.UserID, step)
+		return false, ok, err
+	}
+	ok, err = h.Repo.TwoFactor().UseRecoveryCode(tf.UserID, twofactor.HashRecoveryCode(input))
+	return ok, ok, err
+}
+
+// LoginTwoFactorPage prompts for the authenticator code after a correct password
+func (h *Handlers) LoginTwoFactorPage(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "cart-session")
+	if _, ok := pendingTwoFactorUser(session); !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	h.renderTwoFactorLogin(w, r, "")
+}
+
+func (h *Handlers) renderTwoFactorLogin(w http.ResponseWriter, r *http.Request, errorMsg string) {
+	data := TwoFactorLoginData{
+		ReaderBrowserURL:  h.ReaderBrowserURL,
+		ChatbotBrowserURL: h.ChatbotBrowserURL,
+		Error:             errorMsg,
+		Next:              h.safeNext(r.URL.Query().Get("next")),
+	}
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/login-2fa.html")
+	if err != nil {
+		log.Printf("Error parsing template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := ts.ExecuteTemplate(w, "login-2fa.html", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// LoginTwoFactor completes a login with a TOTP or recovery code
+func (h *Handlers) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "cart-session")
+	userID, ok := pendingTwoFactorUser(session)
+	if !ok {
+		h.LoginPage(w, r, "Your sign-in expired. Please enter your password again.")
+		return
+	}
+
+	user, err := h.Repo.Users().GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error fetching user: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Code guesses count towards the same lockout as password guesses
+	if retryAfter, msg, ok := h.checkLogin(r, user.Email); !ok {
+		w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+		w.WriteHeader(http.StatusTooManyRequests)
+		h.renderTwoFactorLogin(w, r, msg)
+		return
+	}
+
+	tf, err := h.Repo.TwoFactor().GetTwoFactor(userID)
+	if err != nil {
+		log.Printf("Error fetching two-factor settings: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if tf != nil {
+		usedRecoveryCode, ok, err := h.verifySecondFactor(tf, r.FormValue("code"))
+		if err != nil {
+			log.Printf("Error verifying two-factor code: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			h.recordLoginFailure(r, user.Email, user)
+			h.renderTwoFactorLogin(w, r, "That code is not valid. Check your authenticator app and try again.")
+			return
+		}
+		if usedRecoveryCode {
+			h.audit(models.AuditEntry{UserID: &userID, Event: models.AuditRecoveryCodeUsed, IP: h.clientIP(r), Details: map[string]interface{}{
+				"remaining": tf.RecoveryCodesLeft - 1,
+			}})
+		}
+	}
+
+	delete(session.Values, sessionPending2FAUser)
+	delete(session.Values, sessionPending2FAExpires)
+	h.recordLoginSuccess(r, user.Email)
+	h.completeLogin(w, r, session, userID, r.URL.Query().Get("next"))
+}
+
+// TwoFactorPage shows two-factor status, or enrollment with a QR code
+func (h *Handlers) TwoFactorPage(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.GetUserID(r)
+	if !authenticated {
+		http.Redirect(w, r, "/login?next=/profile/2fa", http.StatusFound)
+		return
+	}
+	h.renderTwoFactorPage(w, r, userID, TwoFactorPageData{
+		Error:   r.URL.Query().Get("error"),
+		Success: r.URL.Query().Get("success"),
+	})
+}
+
+func (h *Handlers) renderTwoFactorPage(w http.ResponseWriter, r *http.Request, userID int, data TwoFactorPageData) {
+	user, err := h.Repo.Users().GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error fetching user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	tf, err := h.Repo.TwoFactor().GetTwoFactor(userID)
+	if err != nil {
+		log.Printf("Error fetching two-factor settings: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data.IsAuthenticated = true
+	data.ReaderBrowserURL = h.ReaderBrowserURL
+	data.ChatbotBrowserURL = h.ChatbotBrowserURL
+	data.User = user
+	data.TwoFactor = tf
+
+	if tf == nil {
+		// The secret stays in the session until a code from it is confirmed
+		session, _ := h.Store.Get(r, "cart-session")
+		secret, _ := session.Values[sessionPendingTOTPSecret].(string)
+		if secret == "" {
+			if secret, err = twofactor.NewSecret(); err != nil {
+				log.Printf("Error generating TOTP secret: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			session.Values[sessionPendingTOTPSecret] = secret
+			if err := session.Save(r, w); err != nil {
+				log.Printf("Error saving session: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+		qr, err := twofactor.QRCodeDataURI(twofactor.URI(secret, user.Email))
+		if err != nil {
+			log.Printf("Error rendering QR code: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		data.Secret = secret
+		data.QRCode = template.URL(qr)
+	}
+
+	ts, err := h.parseTemplates(w, r, "./templates/base.html", "./templates/profile-2fa.html")
+	if err != nil {
+		log.Printf("Error parsing template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := ts.ExecuteTemplate(w, "profile-2fa.html", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// EnableTwoFactor confirms enrollment with a code from the new authenticator
+// and shows the recovery codes once
+func (h *Handlers) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.GetUserID(r)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	session, _ := h.Store.Get(r, "cart-session")
+	secret, _ := session.Values[sessionPendingTOTPSecret].(string)
+	if secret == "" {
+		http.Redirect(w, r, "/profile/2fa", http.StatusFound)
+		return
+	}
+
+	step, ok := twofactor.Verify(secret, r.FormValue("code"), time.Now())
+	if !ok {
+		http.Redirect(w, r, "/profile/2fa?error=That+code+is+not+valid.+Check+the+time+on+your+device+and+try+again.", http.StatusFound)
+		return
+	}
+
+	codes, hashes, err := twofactor.NewRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Repo.TwoFactor().EnableTwoFactor(userID, secret, step, hashes); err != nil {
+		log.Printf("Error enabling two-factor authentication: %v", err)
+		http.Redirect(w, r, "/profile/2fa?error=Could+not+enable+two-factor+authentication", http.StatusFound)
+		return
+	}
+
+	delete(session.Values, sessionPendingTOTPSecret)
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+
+	h.audit(models.AuditEntry{UserID: &userID, Event: models.AuditTwoFactorEnabled, IP: h.clientIP(r)})
+	h.notifyTwoFactorChange(userID, "Two-factor authentication was turned on for your Bookstore account.")
+
+	h.renderTwoFactorPage(w, r, userID, TwoFactorPageData{
+		Success:       "Two-factor authentication is on. Save your recovery codes somewhere safe.",
+		RecoveryCodes: codes,
+	})
+}
+
+// DisableTwoFactor turns 2FA off after re-checking the password and a code.
+// Administrators cannot turn it off.
+func (h *Handlers) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.GetUserID(r)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	user, tf, ok := h.reauthenticateTwoFactor(w, r, userID, true)
+	if !ok {
+		return
+	}
+	if user.IsAdmin() {
+		http.Redirect(w, r, "/profile/2fa?error=Administrators+must+keep+two-factor+authentication+on", http.StatusFound)
+		return
+	}
+
+	if err := h.Repo.TwoFactor().DisableTwoFactor(tf.UserID); err != nil {
+		log.Printf("Error disabling two-factor authentication: %v", err)
+		http.Redirect(w, r, "/profile/2fa?error=Could+not+turn+off+two-factor+authentication", http.StatusFound)
+		return
+	}
+
+	h.audit(models.AuditEntry{UserID: &userID, Event: models.AuditTwoFactorDisabled, IP: h.clientIP(r)})
+	h.notifyTwoFactorChange(userID, "Two-factor authentication was turned off for your Bookstore account.")
+	http.Redirect(w, r, "/profile?success=Two-factor+authentication+turned+off", http.StatusFound)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes and shows the new set once
+func (h *Handlers) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.GetUserID(r)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	if _, _, ok := h.reauthenticateTwoFactor(w, r, userID, false); !ok {
+		return
+	}
+
+	codes, hashes, err := twofactor.NewRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Repo.TwoFactor().ReplaceRecoveryCodes(userID, hashes); err != nil {
+		log.Printf("Error replacing recovery codes: %v", err)
+		http.Redirect(w, r, "/profile/2fa?error=Could+not+generate+new+recovery+codes", http.StatusFound)
+		return
+	}
+
+	h.audit(models.AuditEntry{UserID: &userID, Event: models.AuditRecoveryCodesReissued, IP: h.clientIP(r)})
+	h.renderTwoFactorPage(w, r, userID, TwoFactorPageData{
+		Success:       "New recovery codes issued. Your old codes no longer work.",
+		RecoveryCodes: codes,
+	})
+}
+
+// reauthenticateTwoFactor checks the posted code (and password, if
+// withPassword) before a sensitive 2FA change. On failure it redirects back
+// to the 2FA page and returns ok=false.
+func (h *Handlers) reauthenticateTwoFactor(w http.ResponseWriter, r *http.Request, userID int, withPassword bool) (*models.User, *models.TwoFactor, bool) {
+	user, err := h.Repo.Users().GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error fetching user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	tf, err := h.Repo.TwoFactor().GetTwoFactor(userID)
+	if err != nil {
+		log.Printf("Error fetching two-factor settings: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if tf == nil {
+		http.Redirect(w, r, "/profile/2fa", http.StatusFound)
+		return nil, nil, false
+	}
+
+	if withPassword && !user.CheckPassword(r.FormValue("password")) {
+		http.Redirect(w, r, "/profile/2fa?error=Password+is+incorrect", http.StatusFound)
+		return nil, nil, false
+	}
+	_, ok, err := h.verifySecondFactor(tf, r.FormValue("code"))
+	if err != nil {
+		log.Printf("Error verifying two-factor code: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if !ok {
+		http.Redirect(w, r, "/profile/2fa?error=That+code+is+not+valid", http.StatusFound)
+		return nil, nil, false
+	}
+	return user, tf, true
+}
+
+func (h *Handlers) notifyTwoFactorChange(userID int, what string) {
+	user, err := h.Repo.Users().GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error fetching user %d for 2FA notification: %v", userID, err)
+		return
+	}
+	go h.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Bookstore sign-in settings changed",
+		Body: what + "\n\nIf you did not make this change, reset your password at " +
+			h.PublicURL + "/password/forgot and contact support.\n",
+	})
+}
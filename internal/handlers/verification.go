@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"DemoApp/internal/mail"
+	"DemoApp/internal/models"
+	"DemoApp/internal/repository"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// emailVerificationTTL is how long an emailed verification link stays valid
+const emailVerificationTTL = 48 * time.Hour
+
+// sendVerificationEmail emails a link confirming email for the user. For an
+// email change, email is the new address and only takes effect once the
+// link is followed.
+func (h *Handlers) sendVerificationEmail(userID int, email string, change bool) error {
+	token, hash, err := models.NewToken()
+	if err != nil {
+		return err
+	}
+	if err := h.Repo.EmailVerifications().CreateEmailVerification(userID, email, hash, time.Now().Add(emailVerificationTTL)); err != nil {
+		return err
+	}
+
+	link := h.PublicURL + "/account/verify?token=" + url.QueryEscape(token)
+	msg := mail.Message{
+		To:      email,
+		Subject: "Confirm your Bookstore email address",
+		Body: "Welcome to Bookstore! Please confirm your email address by opening this link:\n\n" + link + "\n\n" +
+			"You'll need a confirmed address to check out and write reviews. The link expires in 48 hours.\n",
+	}
+	if change {
+		msg.Subject = "Confirm your new Bookstore email address"
+		msg.Body = "You asked to change the email address on your Bookstore account to this one.\n\n" +
+			"Confirm the change by opening this link within 48 hours:\n\n" + link + "\n\n" +
+			"Until then your account keeps its current address. If you did not ask for this, ignore this email.\n"
+	}
+	go h.sendMail(msg)
+	return nil
+}
+
+// VerifyEmail confirms an address from an emailed link
+// GET /account/verify?token=...
+func (h *Handlers) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	_, authenticated := h.GetUserID(r)
+
+	userID, oldEmail, email, ok, err := h.Repo.EmailVerifications().VerifyEmail(models.HashToken(r.URL.Query().Get("token")))
+	if err == repository.ErrEmailTaken {
+		h.verifyEmailResult(w, r, authenticated, "", "That email address is now used by another account.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying email: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		h.verifyEmailResult(w, r, authenticated, "", "This verification link is invalid, has expired or has already been used.")
+		return
+	}
+
+	// Report an email change to the old address even when the link is
+	// opened without a session
+	if oldEmail != email {
+		h.audit(models.AuditEntry{UserID: &userID, Event: models.AuditEmailChanged, IP: h.clientIP(r), Details: map[string]interface{}{
+			"old_email": oldEmail,
+			"new_email": email,
+		}})
+		go h.sendMail(mail.Message{
+			To:      oldEmail,
+			Subject: "Your Bookstore email address was changed",
+			Body: "The email address on your Bookstore account was changed to " + email + ".\n\n" +
+				"If you did not make this change, reset your password at " + h.PublicURL + "/password/forgot and contact support.\n",
+		})
+		h.verifyEmailResult(w, r, authenticated, "Your email address has been changed to "+email+".", "")
+		return
+	}
+
+	h.audit(models.AuditEntry{UserID: &userID, Event: models.AuditEmailVerified, IP: h.clientIP(r), Details: map[string]interface{}{
+		"email": email,
+	}})
+	h.verifyEmailResult(w, r, authenticated, "Your email address has been verified.", "")
+}
+
+// verifyEmailResult reports a verification outcome on the profile page, or
+// the login page when the link was opened without a session
+func (h *Handlers) verifyEmailResult(w http.ResponseWriter, r *http.Request, authenticated bool, success, errorMsg string) {
+	if !authenticated {
+		if errorMsg != "" {
+			h.LoginPage(w, r, errorMsg)
+			return
+		}
+		http.Redirect(w, r, "/login?verified=1", http.StatusFound)
+		return
+	}
+	if errorMsg != "" {
+		http.Redirect(w, r, "/profile?error="+url.QueryEscape(errorMsg), http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/profile?success="+url.QueryEscape(success), http.StatusFound)
+}
+
+// ResendVerification emails a fresh verification link for the current address
+func (h *Handlers) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.GetUserID(r)
+	if !authenticated {
+		http.Redirect(w, r, "/login?next=/profile", http.StatusFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/profile", http.StatusFound)
+		return
+	}
+
+	user, err := h.Repo.Users().GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error fetching user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.EmailVerified() {
+		http.Redirect(w, r, "/profile", http.StatusFound)
+		return
+	}
+
+	if err := h.sendVerificationEmail(user.ID, user.Email, false); err != nil {
+		log.Printf("Error sending verification email to user %d: %v", user.ID, err)
+		http.Redirect(w, r, "/profile?error=Could+not+send+verification+email", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/profile?success="+url.QueryEscape("We've sent a verification link to "+user.Email+"."), http.StatusFound)
+}
+
+// requireVerifiedEmail redirects users who have not confirmed their email
+// address to the profile page and returns false. action completes the
+// sentence "Please verify your email address before ...".
+func (h *Handlers) requireVerifiedEmail(w http.ResponseWriter, r *http.Request, userID int, action string) bool {
+	user, err := h.Repo.Users().GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error fetching user: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if user.EmailVerified() {
+		return true
+	}
+	http.Redirect(w, r, "/profile?error="+url.QueryEscape("Please verify your email address before "+action+"."), http.StatusSeeOther)
+	return false
+}
@@ -0,0 +1,45 @@
+// Package identity signs users in through external OAuth2 and OpenID Connect
+// providers. Each provider turns an authorization code into an Identity; the
+// handlers decide whether that identity maps to a new or existing account.
+package identity
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// Identity is what a provider vouches for about the person signing in
+type Identity struct {
+	Provider string
+	// Subject is the provider's stable ID for the user. Emails can change
+	// hands, so accounts are linked by subject once known.
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is an external identity provider
+type Provider interface {
+	// Name identifies the provider in URLs and the database, e.g. "google"
+	Name() string
+	// DisplayName labels the sign-in button
+	DisplayName() string
+	// AuthCodeURL is where the browser is sent to sign in. state is echoed
+	// back to the callback, nonce is bound into OIDC ID tokens, and verifier
+	// is the PKCE code verifier.
+	AuthCodeURL(state, nonce, verifier string) string
+	// Exchange trades the callback's authorization code for the identity
+	Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, error)
+}
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+// ValidName reports whether name can be used as a provider name
+func ValidName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("identity: provider name %q must be lowercase letters, digits and dashes", name)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestOAuth2ProviderExchange(t *testing.T) {
+	verifier := NewVerifier()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "the-code" {
+			http.Error(w, "bad code", http.StatusBadRequest)
+			return
+		}
+		if r.FormValue("code_verifier") != verifier {
+			http.Error(w, "bad verifier", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "tok", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 4242, "email": "reader@example.com", "name": "Reader"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p, err := NewOAuth2(OAuth2Config{
+		Name:        "example",
+		ClientID:    "client",
+		RedirectURL: "http://shop.test/login/oauth/example/callback",
+		AuthURL:     srv.URL + "/authorize",
+		TokenURL:    srv.URL + "/token",
+		UserInfoURL: srv.URL + "/user",
+	})
+	if err != nil {
+		t.Fatalf("NewOAuth2 failed: %v", err)
+	}
+
+	authURL, err := url.Parse(p.AuthCodeURL("the-state", "nonce", verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL is not a URL: %v", err)
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	q := authURL.Query()
+	if q.Get("state") != "the-state" || q.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(sum[:]) || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("AuthCodeURL missing state or PKCE challenge: %s", authURL)
+	}
+
+	id, err := p.Exchange(context.Background(), "the-code", "nonce", verifier)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	want := Identity{Provider: "example", Subject: "4242", Email: "reader@example.com", Name: "Reader"}
+	if *id != want {
+		t.Errorf("got %+v, want %+v", *id, want)
+	}
+
+	if _, err := p.Exchange(context.Background(), "the-code", "nonce", "wrong-verifier"); err == nil {
+		t.Error("expected Exchange to fail with the wrong verifier")
+	}
+}
+
+func TestFakeCodesAreSingleUse(t *testing.T) {
+	f := &Fake{ProviderName: "test", RedirectURL: "/callback", Identity: Identity{Subject: "1", Email: "reader@example.com"}}
+
+	u, err := url.Parse(f.AuthCodeURL("state", "nonce", "verifier"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := u.Query().Get("code")
+	if _, err := f.Exchange(context.Background(), code, "other-nonce", "verifier"); err == nil {
+		t.Error("expected a nonce mismatch to fail")
+	}
+	if _, err := f.Exchange(context.Background(), code, "nonce", "verifier"); err == nil {
+		t.Error("expected a code to be rejected after its first exchange")
+	}
+
+	u, _ = url.Parse(f.AuthCodeURL("state", "nonce", "verifier"))
+	id, err := f.Exchange(context.Background(), u.Query().Get("code"), "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if id.Provider != "test" || id.Subject != "1" {
+		t.Errorf("unexpected identity %+v", id)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for _, name := range []string{"google", "azure-ad", "gh2"} {
+		if err := ValidName(name); err != nil {
+			t.Errorf("ValidName(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "Google", "-x", "a/b", "a_b"} {
+		if ValidName(name) == nil {
+			t.Errorf("ValidName(%q) accepted an invalid name", name)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Package loginguard throttles password logins per account and per client IP.
+//
+// Each failed attempt increments counters for the account and the IP. Past a
+// few free attempts, the next attempt must wait a delay that doubles with
+// every failure; past the lockout threshold the account (or IP) is locked
+// for a fixed period. An account lockout can be lifted early with a
+// single-use unlock token sent to the account's email address.
+package loginguard
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Policy configures thresholds and timings
+type Policy struct {
+	Window time.Duration // Failure counters reset this long after the first failure
+
+	AccountFreeAttempts int // Failures before delays start for an account
+	AccountLockAfter    int // Failures that lock an account
+	IPFreeAttempts      int // Failures before delays start for an IP
+	IPLockAfter         int // Failures that block an IP
+
+	BaseDelay    time.Duration // First delay, doubled for each further failure
+	MaxDelay     time.Duration
+	LockDuration time.Duration
+	UnlockTTL    time.Duration // Lifetime of emailed unlock tokens
+}
+
+// DefaultPolicy suits an interactive login form shared by many users behind
+// the same NAT
+var DefaultPolicy = Policy{
+	Window:              15 * time.Minute,
+	AccountFreeAttempts: 3,
+	AccountLockAfter:    10,
+	IPFreeAttempts:      10,
+	IPLockAfter:         100,
+	BaseDelay:           time.Second,
+	MaxDelay:            time.Minute,
+	LockDuration:        30 * time.Minute,
+	UnlockTTL:           24 * time.Hour,
+}
+
+// Guard applies a Policy using a Store
+type Guard struct {
+	store  Store
+	policy Policy
+
+	// TrustProxy makes ClientIP honour X-Forwarded-For. Only enable it when
+	// the app is reachable solely through a proxy that sets the header.
+	TrustProxy bool
+	// ProxyHops is how many trusted proxies append to X-Forwarded-For in
+	// front of the app; zero counts as one.
+	ProxyHops int
+}
+
+func New(store Store, policy Policy) *Guard {
+	return &Guard{store: store, policy: policy}
+}
+
+// Decision is the outcome of Check
+type Decision struct {
+	Allowed    bool
+	Locked     bool // The account or IP is locked out rather than just delayed
+	RetryAfter time.Duration
+}
+
+// Failure is the outcome of RecordFailure
+type Failure struct {
+	AccountFailures int64
+	IPFailures      int64
+	AccountLocked   bool // This failure locked the account
+	IPLocked        bool // This failure blocked the IP
+}
+
+func accountKey(kind, account string) string {
+	return kind + ":account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+func ipKey(kind, ip string) string {
+	return kind + ":ip:" + ip
+}
+
+// Check reports whether a login attempt for account from ip may proceed
+func (g *Guard) Check(ctx context.Context, account, ip string) (Decision, error) {
+	for _, key := range []string{accountKey("lock", account), ipKey("lock", ip)} {
+		_, ttl, ok, err := g.store.Get(ctx, key)
+		if err != nil {
+			return Decision{}, err
+		}
+		if ok {
+			return Decision{Locked: true, RetryAfter: ttl}, nil
+		}
+	}
+	for _, key := range []string{accountKey("delay", account), ipKey("delay", ip)} {
+		_, ttl, ok, err := g.store.Get(ctx, key)
+		if err != nil {
+			return Decision{}, err
+		}
+		if ok {
+			return Decision{RetryAfter: ttl}, nil
+		}
+	}
+	return Decision{Allowed: true}, nil
+}
+
+// RecordFailure counts a failed attempt and applies any delay or lockout it triggers
+func (g *Guard) RecordFailure(ctx context.Context, account, ip string) (Failure, error) {
+	p := g.policy
+	var f Failure
+	var err error
+
+	if f.AccountFailures, err = g.store.Incr(ctx, accountKey("fail", account), p.Window); err != nil {
+		return f, err
+	}
+	if f.IPFailures, err = g.store.Incr(ctx, ipKey("fail", ip), p.Window); err != nil {
+		return f, err
+	}
+
+	if f.AccountFailures >= int64(p.AccountLockAfter) {
+		if err := g.store.Set(ctx, accountKey("lock", account), "1", p.LockDuration); err != nil {
+			return f, err
+		}
+		if err := g.store.Del(ctx, accountKey("fail", account), accountKey("delay", account)); err != nil {
+			return f, err
+		}
+		f.AccountLocked = true
+	} else if delay := g.delay(f.AccountFailures, p.AccountFreeAttempts); delay > 0 {
+		if err := g.store.Set(ctx, accountKey("delay", account), "1", delay); err != nil {
+			return f, err
+		}
+	}
+
+	if f.IPFailures >= int64(p.IPLockAfter) {
+		if err := g.store.Set(ctx, ipKey("lock", ip), "1", p.LockDuration); err != nil {
+			return f, err
+		}
+		if err := g.store.Del(ctx, ipKey("fail", ip), ipKey("delay", ip)); err != nil {
+			return f, err
+		}
+		f.IPLocked = true
+	} else if delay := g.delay(f.IPFailures, p.IPFreeAttempts); delay > 0 {
+		if err := g.store.Set(ctx, ipKey("delay", ip), "1", delay); err != nil {
+			return f, err
+		}
+	}
+
+	return f, nil
+}
+
+// delay returns the wait imposed after failures, doubling past the free attempts
+func (g *Guard) delay(failures int64, free int) time.Duration {
+	if failures <= int64(free) {
+		return 0
+	}
+	delay := g.policy.BaseDelay
+	for i := int64(free) + 1; i < failures && delay < g.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.policy.MaxDelay {
+		delay = g.policy.MaxDelay
+	}
+	return delay
+}
+
+// RecordSuccess clears the account's failure history after a good login
+func (g *Guard) RecordSuccess(ctx context.Context, account string) error {
+	return g.store.Del(ctx, accountKey("fail", account), accountKey("delay", account))
+}
+
+// Unlock lifts an account lockout and clears its failures
+func (g *Guard) Unlock(ctx context.Context, account string) error {
+	return g.store.Del(ctx, accountKey("lock", account), accountKey("fail", account), accountKey("delay", account))
+}
+
+// IssueUnlockToken returns a single-use token that unlocks account. Only a
+// hash of the token is stored.
+func (g *Guard) IssueUnlockToken(ctx context.Context, account string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if err := g.store.Set(ctx, unlockKey(token), strings.ToLower(strings.TrimSpace(account)), g.policy.UnlockTTL); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RedeemUnlockToken unlocks the account a token was issued for and
+// invalidates the token. ok is false for unknown or expired tokens.
+func (g *Guard) RedeemUnlockToken(ctx context.Context, token string) (account string, ok bool, err error) {
+	if token == "" {
+		return "", false, nil
+	}
+	key := unlockKey(token)
+	account, _, ok, err = g.store.Get(ctx, key)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	if err := g.store.Del(ctx, key); err != nil {
+		return "", false, err
+	}
+	if err := g.Unlock(ctx, account); err != nil {
+		return "", false, err
+	}
+	return account, true, nil
+}
+
+func unlockKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "unlock:" + hex.EncodeToString(sum[:])
+}
+
+// ClientIP returns the address failures from r are counted against
+func (g *Guard) ClientIP(r *http.Request) string {
+	if g.TrustProxy {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			// Clients can put anything on the left, so count back from the
+			// right past the entries our own proxies appended
+			hops := max(g.ProxyHops, 1)
+			entries := strings.Split(strings.Join(fwd, ","), ",")
+			return strings.TrimSpace(entries[max(len(entries)-hops, 0)])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,146 @@
+package loginguard
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	Window:              time.Minute,
+	AccountFreeAttempts: 2,
+	AccountLockAfter:    5,
+	IPFreeAttempts:      3,
+	IPLockAfter:         8,
+	BaseDelay:           time.Second,
+	MaxDelay:            4 * time.Second,
+	LockDuration:        time.Minute,
+	UnlockTTL:           time.Hour,
+}
+
+func TestProgressiveDelayAndLockout(t *testing.T) {
+	ctx := context.Background()
+	g := New(NewMemoryStore(), testPolicy)
+
+	wantDelays := []time.Duration{0, 0, time.Second, 2 * time.Second}
+	for i, want := range wantDelays {
+		f, err := g.RecordFailure(ctx, "Reader@Example.com", "10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.AccountFailures != int64(i+1) {
+			t.Fatalf("failure %d: counted %d", i+1, f.AccountFailures)
+		}
+		d, err := g.Check(ctx, "reader@example.com", "10.0.0.2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want == 0 && !d.Allowed {
+			t.Fatalf("failure %d: want no delay, got %+v", i+1, d)
+		}
+		if want > 0 && (d.Allowed || d.Locked || d.RetryAfter > want || d.RetryAfter < want-100*time.Millisecond) {
+			t.Fatalf("failure %d: want delay %v, got %+v", i+1, want, d)
+		}
+	}
+
+	f, err := g.RecordFailure(ctx, "reader@example.com", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.AccountLocked {
+		t.Fatalf("fifth failure should lock the account: %+v", f)
+	}
+	d, _ := g.Check(ctx, "reader@example.com", "10.0.0.3")
+	if d.Allowed || !d.Locked {
+		t.Fatalf("locked account allowed: %+v", d)
+	}
+	if d, _ := g.Check(ctx, "other@example.com", "10.0.0.3"); !d.Allowed {
+		t.Fatalf("other account affected by lockout: %+v", d)
+	}
+}
+
+func TestIPBlockedAcrossAccounts(t *testing.T) {
+	ctx := context.Background()
+	g := New(NewMemoryStore(), testPolicy)
+
+	var f Failure
+	for i := 0; i < testPolicy.IPLockAfter; i++ {
+		var err error
+		if f, err = g.RecordFailure(ctx, "user"+string(rune('a'+i))+"@example.com", "10.0.0.9"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !f.IPLocked {
+		t.Fatalf("IP not blocked after %d failures: %+v", testPolicy.IPLockAfter, f)
+	}
+	if d, _ := g.Check(ctx, "fresh@example.com", "10.0.0.9"); d.Allowed || !d.Locked {
+		t.Fatalf("blocked IP allowed: %+v", d)
+	}
+	if d, _ := g.Check(ctx, "fresh@example.com", "10.0.0.10"); !d.Allowed {
+		t.Fatalf("other IP affected: %+v", d)
+	}
+}
+
+func TestUnlockToken(t *testing.T) {
+	ctx := context.Background()
+	g := New(NewMemoryStore(), testPolicy)
+
+	for i := 0; i < testPolicy.AccountLockAfter; i++ {
+		if _, err := g.RecordFailure(ctx, "reader@example.com", "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token, err := g.IssueUnlockToken(ctx, "Reader@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, _ := g.RedeemUnlockToken(ctx, "not-a-token"); ok {
+		t.Fatal("unknown token redeemed")
+	}
+	account, ok, err := g.RedeemUnlockToken(ctx, token)
+	if err != nil || !ok || account != "reader@example.com" {
+		t.Fatalf("redeem = %q, %v, %v", account, ok, err)
+	}
+	if d, _ := g.Check(ctx, "reader@example.com", "10.0.0.2"); !d.Allowed {
+		t.Fatalf("account still locked after unlock: %+v", d)
+	}
+	if _, ok, _ := g.RedeemUnlockToken(ctx, token); ok {
+		t.Fatal("token redeemed twice")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("POST", "/login/process", nil)
+	r.RemoteAddr = "192.0.2.1:5555"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+
+	g := New(NewMemoryStore(), testPolicy)
+	if ip := g.ClientIP(r); ip != "192.0.2.1" {
+		t.Fatalf("untrusted proxy: got %s", ip)
+	}
+	g.TrustProxy = true
+	if ip := g.ClientIP(r); ip != "10.0.0.1" {
+		t.Fatalf("trusted proxy: got %s", ip)
+	}
+	g.ProxyHops = 2
+	if ip := g.ClientIP(r); ip != "203.0.113.7" {
+		t.Fatalf("two trusted proxies: got %s", ip)
+	}
+}
+
+func TestClientIPIgnoresSpoofedForwardedFor(t *testing.T) {
+	// The client sends its own X-Forwarded-For and the proxy appends the
+	// address it saw
+	r := httptest.NewRequest("POST", "/login/process", nil)
+	r.RemoteAddr = "10.0.0.1:5555"
+	r.Header.Add("X-Forwarded-For", "198.51.100.99")
+	r.Header.Add("X-Forwarded-For", "203.0.113.7")
+
+	g := New(NewMemoryStore(), testPolicy)
+	g.TrustProxy = true
+	if ip := g.ClientIP(r); ip != "203.0.113.7" {
+		t.Fatalf("expected the address the proxy saw, got %s", ip)
+	}
+}
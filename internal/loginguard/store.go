@@ -0,0 +1,150 @@
+package loginguard
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store holds failure counters, delays, lockouts and unlock tokens, each
+// expiring on its own. Redis shares state across replicas; the in-memory
+// store is per process.
+type Store interface {
+	// Incr increments key, starting its expiry window on the first increment
+	Incr(ctx context.Context, key string, window time.Duration) (int64, error)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// Get returns the value and remaining lifetime of key; ok is false if it does not exist
+	Get(ctx context.Context, key string) (value string, ttl time.Duration, ok bool, err error)
+	Del(ctx context.Context, keys ...string) error
+}
+
+// RedisStore keeps guard state in Redis under the "loginguard:" prefix
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+const redisPrefix = "loginguard:"
+
+func (s *RedisStore) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	pipe := s.client.TxPipeline()
+	incr := pipe.Incr(ctx, redisPrefix+key)
+	pipe.ExpireNX(ctx, redisPrefix+key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return s.client.Set(ctx, redisPrefix+key, value, ttl).Err()
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (string, time.Duration, bool, error) {
+	pipe := s.client.Pipeline()
+	get := pipe.Get(ctx, redisPrefix+key)
+	ttl := pipe.PTTL(ctx, redisPrefix+key)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return "", 0, false, err
+	}
+	if errors.Is(get.Err(), redis.Nil) {
+		return "", 0, false, nil
+	}
+	return get.Val(), ttl.Val(), true, nil
+}
+
+func (s *RedisStore) Del(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, len(keys))
+	for i, k := range keys {
+		prefixed[i] = redisPrefix + k
+	}
+	return s.client.Del(ctx, prefixed...).Err()
+}
+
+// MemoryStore keeps guard state in process memory
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	now     func() time.Time
+}
+
+type memoryEntry struct {
+	value   string
+	count   int64
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry), now: time.Now}
+}
+
+// live returns the entry for key, dropping it if expired. Callers hold mu.
+func (s *MemoryStore) live(key string) (memoryEntry, bool) {
+	e, ok := s.entries[key]
+	if ok && !s.now().Before(e.expires) {
+		delete(s.entries, key)
+		return memoryEntry{}, false
+	}
+	return e, ok
+}
+
+func (s *MemoryStore) Incr(_ context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.live(key)
+	if !ok {
+		e = memoryEntry{expires: s.now().Add(window)}
+	}
+	e.count++
+	s.entries[key] = e
+	s.sweep()
+	return e.count, nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = memoryEntry{value: value, expires: s.now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (string, time.Duration, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.live(key)
+	if !ok {
+		return "", 0, false, nil
+	}
+	return e.value, e.expires.Sub(s.now()), true, nil
+}
+
+func (s *MemoryStore) Del(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range keys {
+		delete(s.entries, k)
+	}
+	return nil
+}
+
+// sweepThreshold bounds memory use under attack from many IPs or accounts
+const sweepThreshold = 10000
+
+// sweep drops expired entries once the map grows large. Callers hold mu.
+func (s *MemoryStore) sweep() {
+	if len(s.entries) < sweepThreshold {
+		return
+	}
+	now := s.now()
+	for k, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
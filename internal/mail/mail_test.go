@@ -0,0 +1,50 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailerWritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: dir, From: "Bookstore <no-reply@example.com>"}
+
+	err := m.Send(context.Background(), Message{
+		To:      "reader@example.com",
+		Subject: "Reset your password",
+		Body:    "Follow this link:\nhttp://localhost:8080/password/reset?token=abc\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("want 1 message file, got %d", len(files))
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"From: Bookstore <no-reply@example.com>\r\n",
+		"To: reader@example.com\r\n",
+		"Subject: Reset your password\r\n",
+		"\r\n\r\nFollow this link:\r\nhttp://localhost:8080/password/reset?token=abc\r\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("message missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestHeaderInjectionRejected(t *testing.T) {
+	m := &FileMailer{Dir: t.TempDir(), From: "no-reply@example.com"}
+	err := m.Send(context.Background(), Message{To: "a@example.com\r\nBcc: b@example.com", Subject: "x"})
+	if err == nil {
+		t.Fatal("expected an error for a recipient containing a line break")
+	}
+}
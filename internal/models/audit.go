@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Audit events
+const (
+	AuditAccountLocked   = "account.locked"
+	AuditAccountUnlocked = "account.unlocked"
+	AuditIPBlocked       = "ip.blocked"
+
+	AuditPasswordResetRequested = "password.reset_requested"
+	AuditPasswordReset          = "password.reset"
+
+	AuditEmailVerified = "email.verified"
+	AuditEmailChanged  = "email.changed"
+
+	AuditTwoFactorEnabled      = "2fa.enabled"
+	AuditTwoFactorDisabled     = "2fa.disabled"
+	AuditRecoveryCodeUsed      = "2fa.recovery_code_used"
+	AuditRecoveryCodesReissued = "2fa.recovery_codes_reissued"
+
+	AuditPasskeyAdded   = "passkey.added"
+	AuditPasskeyRemoved = "passkey.removed"
+
+	AuditIdentityLinked = "identity.linked"
+
+	AuditSessionRevoked     = "session.revoked"
+	AuditSessionsRevokedAll = "session.revoked_all"
+	AuditPasswordChanged    = "password.changed"
+
+	AuditAccountExported = "account.exported"
+	AuditAccountDeleted  = "account.deleted"
+)
+
+// AuditEntry records a security-relevant event
+type AuditEntry struct {
+	ID        int64
+	UserID    *int // Nil when the event is not tied to a known user
+	Event     string
+	IP        string
+	Details   map[string]interface{}
+	CreatedAt time.Time
+}
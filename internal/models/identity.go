@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to their account at an external identity provider
+type UserIdentity struct {
+	ID          int
+	UserID      int
+	Provider    string
+	Subject     string
+	Email       *string
+	CreatedAt   time.Time
+	LastLoginAt *time.Time
+}
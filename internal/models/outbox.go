@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Domain event types written to the outbox
+const (
+	EventOrderCreated        = "order.created"
+	EventOrderCancelled      = "order.cancelled"
+	EventReviewCreated       = "review.created"
+	EventReviewUpdated       = "review.updated"
+	EventReviewDeleted       = "review.deleted"
+	EventProductStockChanged = "product.stock_changed"
+)
+
+// OutboxEvent is a domain event recorded in the same transaction as the
+// change that caused it
+type OutboxEvent struct {
+	ID            int64
+	AggregateType string // order, review, product
+	AggregateID   int
+	EventType     string
+	Payload       []byte // JSON
+	Attempts      int
+	SinksDone     []string // Sinks that accepted the event on an earlier attempt
+	CreatedAt     time.Time
+}
+
+// Decode unmarshals the event payload into v
+func (e *OutboxEvent) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// OrderEvent is the payload of order events
+type OrderEvent struct {
+	OrderID int `json:"order_id"`
+	UserID  int `json:"user_id,omitempty"`
+}
+
+// ReviewEvent is the payload of review events
+type ReviewEvent struct {
+	ReviewID  int `json:"review_id"`
+	ProductID int `json:"product_id"`
+	UserID    int `json:"user_id"`
+}
+
+// ProductEvent is the payload of product events
+type ProductEvent struct {
+	ProductID int `json:"product_id"`
+	OrderID   int `json:"order_id,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Passkey is a WebAuthn credential registered to a user
+type Passkey struct {
+	ID           int
+	UserID       int
+	Name         string
+	CredentialID []byte
+	Credential   []byte // JSON-encoded webauthn.Credential
+	CreatedAt    time.Time
+	LastUsedAt   *time.Time
+}
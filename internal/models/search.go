@@ -0,0 +1,153 @@
+package models
+
+// FacetRange is a bucket of a numeric facet. Min is inclusive and Max
+// exclusive; a Max of 0 means no upper bound.
+type FacetRange struct {
+	Key   string
+	Label string
+	Min   float64
+	Max   float64
+}
+
+// Contains reports whether v falls in the range
+func (r FacetRange) Contains(v float64) bool {
+	return v >= r.Min && (r.Max == 0 || v < r.Max)
+}
+
+// PriceRanges are the buckets of the price facet
+var PriceRanges = []FacetRange{
+	{Key: "under-5", Label: "Under $5", Max: 5},
+	{Key: "5-10", Label: "$5 to $10", Min: 5, Max: 10},
+	{Key: "10-20", Label: "$10 to $20", Min: 10, Max: 20},
+	{Key: "20-up", Label: "$20 & above", Min: 20},
+}
+
+// RatingRanges bucket products by their average review rating. Products
+// without reviews are in none of them.
+var RatingRanges = []FacetRange{
+	{Key: "4-up", Label: "4 stars & up", Min: 4},
+	{Key: "3-4", Label: "3 to 4 stars", Min: 3, Max: 4},
+	{Key: "2-3", Label: "2 to 3 stars", Min: 2, Max: 3},
+	{Key: "1-2", Label: "1 to 2 stars", Min: 1, Max: 2},
+}
+
+// SearchMode is how a search matches its query
+type SearchMode string
+
+const (
+	// SearchLexical matches the words of the query
+	SearchLexical SearchMode = ""
+	// SearchHybrid also matches descriptions close in meaning to the query,
+	// by their embeddings. It needs Elasticsearch; the SQL search matches
+	// words only.
+	SearchHybrid SearchMode = "hybrid"
+)
+
+// SearchFilters narrows a product search. Values within one facet are
+// alternatives (OR); different facets must all match (AND). Mode travels
+// with the filters so links that change them keep it, but is not a filter.
+type SearchFilters struct {
+	CategoryIDs  []int      `json:"categories,omitempty"`
+	Authors      []string   `json:"authors,omitempty"`
+	PriceRanges  []string   `json:"prices,omitempty"`  // Keys of PriceRanges
+	RatingRanges []string   `json:"ratings,omitempty"` // Keys of RatingRanges
+	InStock      bool       `json:"in_stock,omitempty"`
+	Mode         SearchMode `json:"mode,omitempty"`
+}
+
+// IsEmpty reports whether no filter is set, whatever the mode
+func (f SearchFilters) IsEmpty() bool {
+	return len(f.CategoryIDs) == 0 && len(f.Authors) == 0 && len(f.PriceRanges) == 0 &&
+		len(f.RatingRanges) == 0 && !f.InStock
+}
+
+// SelectedRanges returns the ranges whose keys are in keys, in range order
+func SelectedRanges(ranges []FacetRange, keys []string) []FacetRange {
+	var selected []FacetRange
+	for _, r := range ranges {
+		for _, k := range keys {
+			if r.Key == k {
+				selected = append(selected, r)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// FacetValue is one option of a facet with the number of matching products
+type FacetValue struct {
+	Key      string `json:"key"`
+	Label    string `json:"label"`
+	Count    int    `json:"count"`
+	Selected bool   `json:"selected"`
+}
+
+// Facets are the counts shown beside search results. Each facet's counts
+// apply every filter except its own, so selecting one value does not hide
+// the others.
+type Facets struct {
+	Categories []FacetValue `json:"categories"`
+	Authors    []FacetValue `json:"authors"`
+	Prices     []FacetValue `json:"prices"`
+	Ratings    []FacetValue `json:"ratings"`
+	InStock    FacetValue   `json:"in_stock"`
+}
+
+// Highlight holds the parts of a product that matched a search query as
+// HTML: the text is escaped and each match is wrapped in <mark>. Fields
+// with no match are empty.
+type Highlight struct {
+	Name        string   `json:",omitempty"`
+	Author      string   `json:",omitempty"`
+	Description []string `json:",omitempty"` // Snippets around the matches
+}
+
+// SearchHit is a product in search results with what matched in it.
+// Highlight is nil when the search had no query.
+type SearchHit struct {
+	Product
+	Highlight *Highlight `json:",omitempty"`
+}
+
+// SearchResult is a page of search results with facet counts
+type SearchResult struct {
+	Hits       []SearchHit
+	Pagination Pagination
+	Facets     Facets
+}
+
+// Products returns the products of the hits, in order
+func (r *SearchResult) Products() []Product {
+	products := make([]Product, len(r.Hits))
+	for i, hit := range r.Hits {
+		products[i] = hit.Product
+	}
+	return products
+}
+
+// TitleSuggestion is a product offered as a completion in the search box
+type TitleSuggestion struct {
+	ProductID int    `json:"product_id"`
+	Title     string `json:"title"`
+	Author    string `json:"author,omitempty"`
+}
+
+// CategorySuggestion is a category offered as a completion
+type CategorySuggestion struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Suggestions are the completions for what has been typed in the search
+// box, grouped by kind and most popular first
+type Suggestions struct {
+	Titles     []TitleSuggestion    `json:"titles"`
+	Authors    []string             `json:"authors"`
+	Categories []CategorySuggestion `json:"categories"`
+}
+
+// IsEmpty reports whether there are no suggestions of any kind
+func (s *Suggestions) IsEmpty() bool {
+	return len(s.Titles) == 0 && len(s.Authors) == 0 && len(s.Categories) == 0
+}
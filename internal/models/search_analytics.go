@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// SearchEvent is a search run from the product list, recorded for analytics
+type SearchEvent struct {
+	ID             int64
+	Query          string // As typed; empty when only filters were chosen
+	CorrectedQuery string // Respelling whose results were shown instead, if any
+	Filters        SearchFilters
+	ResultCount    int
+	Latency        time.Duration
+	SessionID      string
+	UserID         *int // Nil for anonymous searches
+	CreatedAt      time.Time
+}
+
+// QueryStats sums up the searches for one query, ignoring case
+type QueryStats struct {
+	Query           string
+	Searches        int
+	AvgResults      float64
+	ClickedSearches int // Searches followed by at least one result click
+}
+
+// ClickThroughPercent is the share of the searches followed by a click
+func (s QueryStats) ClickThroughPercent() float64 {
+	return percent(s.ClickedSearches, s.Searches)
+}
+
+// SearchReport sums up the searches made since a point in time
+type SearchReport struct {
+	Since              time.Time
+	Searches           int
+	ZeroResultSearches int
+	ClickedSearches    int
+	AvgLatencyMs       float64
+	TopQueries         []QueryStats // Most searched first
+	ZeroResultQueries  []QueryStats // Most searched queries that found nothing
+}
+
+// ClickThroughPercent is the share of all searches followed by a click
+func (r *SearchReport) ClickThroughPercent() float64 {
+	return percent(r.ClickedSearches, r.Searches)
+}
+
+// ZeroResultPercent is the share of all searches that found nothing
+func (r *SearchReport) ZeroResultPercent() float64 {
+	return percent(r.ZeroResultSearches, r.Searches)
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
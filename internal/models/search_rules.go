@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// SynonymSet is a group of search terms that match each other, such as
+// "sci-fi" and "science fiction"
+type SynonymSet struct {
+	ID        int
+	Terms     []string
+	CreatedAt time.Time
+}
+
+// SearchPromotion raises a product in the results of one query. Pinned
+// products come first, in the order they were pinned, even if they do not
+// match; otherwise the product's relevance is multiplied by Boost.
+// Promotions only apply when results are sorted by relevance.
+type SearchPromotion struct {
+	ID          int
+	Query       string // Lowercased with single spaces
+	ProductID   int
+	ProductName string
+	Pinned      bool
+	Boost       float64
+	CreatedAt   time.Time
+}
+
+// SearchPreview shows how the search rules change the results of a query
+type SearchPreview struct {
+	Query        string
+	Expansions   []string // Synonym rewrites of the query, as the SQL search tries them
+	Promotions   []SearchPromotion
+	WithRules    []SearchHit
+	WithoutRules []SearchHit
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// TwoFactor is a user's TOTP enrollment
+type TwoFactor struct {
+	UserID            int
+	Secret            string
+	EnabledAt         time.Time
+	LastStep          int64 // Last accepted time step; codes at or before it are replays
+	RecoveryCodesLeft int
+}
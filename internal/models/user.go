@@ -7,12 +7,32 @@ import (
 )
 
 type User struct {
-	ID           int
-	Email        string
-	PasswordHash string
-	FullName     *string
-	Role         string
-	CreatedAt    time.Time
+	ID              int
+	Email           string
+	PasswordHash    string
+	FullName        *string
+	Role            string
+	EmailVerifiedAt *time.Time
+	// TwoFactorEnabled is set when the user has enrolled a TOTP authenticator
+	TwoFactorEnabled bool
+	CreatedAt        time.Time
+}
+
+// IsAdmin reports whether the user has the 'admin' role
+func (u *User) IsAdmin() bool {
+	return u.Role == "admin"
+}
+
+// EmailVerified reports whether the user has confirmed their current address.
+// Unverified users cannot check out or write reviews.
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// HasPassword reports whether the user can sign in with a password. Accounts
+// created through social login have none until they reset it.
+func (u *User) HasPassword() bool {
+	return u.PasswordHash != ""
 }
 
 func (u *User) SetPassword(password string) error {
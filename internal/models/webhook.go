@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// WebhookSubscriber is an external endpoint notified of store events
+type WebhookSubscriber struct {
+	ID        int
+	URL       string
+	Secret    string   // HMAC-SHA256 signing key shared with the subscriber
+	Events    []string // Event types to deliver; empty means all events
+	Active    bool
+	CreatedAt time.Time
+}
+
+// Wants reports whether the subscriber should receive eventType
+func (s *WebhookSubscriber) Wants(eventType string) bool {
+	if !s.Active {
+		return false
+	}
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook delivery statuses
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// WebhookDelivery is one event queued for one subscriber, with the outcome
+// of its latest attempt
+type WebhookDelivery struct {
+	ID             int
+	SubscriberID   int
+	URL            string // Joined from webhook_subscribers
+	Secret         string // Joined from webhook_subscribers
+	EventID        string
+	EventType      string
+	Payload        []byte
+	Status         string
+	Attempts       int
+	ResponseStatus *int
+	LastError      *string
+	NextAttemptAt  time.Time
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
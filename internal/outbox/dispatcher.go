@@ -0,0 +1,130 @@
+// Package outbox publishes domain events recorded in the outbox_events table.
+//
+// Repositories write events in the same transaction as the change that
+// caused them. The Dispatcher then hands each event to every Sink, records
+// each sink that accepts it so a retry only goes to the sinks that failed,
+// and marks it published once all sinks accept it. Delivery is at-least-once:
+// a sink may still see the same event again after a crash and must tolerate
+// duplicates (the event ID is stable across redeliveries).
+package outbox
+
+import (
+	"DemoApp/internal/models"
+	"DemoApp/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// Sink receives published outbox events
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, event models.OutboxEvent) error
+}
+
+// Dispatcher polls the outbox and publishes due events to its sinks
+type Dispatcher struct {
+	repo  repository.OutboxRepository
+	sinks []Sink
+
+	PollInterval time.Duration // How often Run looks for new events
+	BatchSize    int           // Events claimed per poll
+	BaseDelay    time.Duration // Delay before the first retry, doubled on each attempt
+	MaxDelay     time.Duration // Upper bound on the retry delay
+	Lease        time.Duration // How long a claimed event is hidden from other replicas
+}
+
+func NewDispatcher(repo repository.OutboxRepository, sinks ...Sink) *Dispatcher {
+	return &Dispatcher{
+		repo:         repo,
+		sinks:        sinks,
+		PollInterval: time.Second,
+		BatchSize:    50,
+		BaseDelay:    5 * time.Second,
+		MaxDelay:     10 * time.Minute,
+		Lease:        time.Minute,
+	}
+}
+
+// Run dispatches events until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain full batches straight away, then wait for the next tick
+		for {
+			n, err := d.DispatchPending(ctx)
+			if err != nil {
+				log.Printf("Outbox: error dispatching events: %v", err)
+			}
+			if err != nil || n < d.BatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchPending publishes one batch of due events and returns how many were claimed
+func (d *Dispatcher) DispatchPending(ctx context.Context) (int, error) {
+	events, err := d.repo.ClaimOutboxEvents(d.BatchSize, d.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		if err := d.publish(ctx, event); err != nil {
+			retryAt := time.Now().Add(d.backoff(event.Attempts + 1))
+			log.Printf("Outbox: event %d (%s) failed, retrying at %s: %v", event.ID, event.EventType, retryAt.Format(time.RFC3339), err)
+			if err := d.repo.MarkOutboxFailed(event.ID, err.Error(), retryAt); err != nil {
+				log.Printf("Outbox: error recording failure of event %d: %v", event.ID, err)
+			}
+			continue
+		}
+		if err := d.repo.MarkOutboxPublished(event.ID); err != nil {
+			// The event will be published again once its lease expires
+			log.Printf("Outbox: error marking event %d published: %v", event.ID, err)
+		}
+	}
+	return len(events), nil
+}
+
+// publish hands the event to every sink that has not yet accepted it,
+// returning the combined errors
+func (d *Dispatcher) publish(ctx context.Context, event models.OutboxEvent) error {
+	var errs []error
+	for _, sink := range d.sinks {
+		if slices.Contains(event.SinksDone, sink.Name()) {
+			continue
+		}
+		if err := sink.Publish(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+			continue
+		}
+		if err := d.repo.MarkOutboxSinkPublished(event.ID, sink.Name()); err != nil {
+			// The sink will see the event again if another sink fails
+			log.Printf("Outbox: error recording event %d published to %s: %v", event.ID, sink.Name(), err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// backoff returns the retry delay after the given number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay
+}
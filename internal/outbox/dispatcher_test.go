@@ -0,0 +1,136 @@
+package outbox
+
+import (
+	"DemoApp/internal/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// memoryOutbox is an in-memory OutboxRepository that ignores leases and
+// retry times so tests can step through redeliveries
+type memoryOutbox struct {
+	events    []models.OutboxEvent
+	published map[int64]bool
+	lastError map[int64]string
+}
+
+func newMemoryOutbox(events ...models.OutboxEvent) *memoryOutbox {
+	return &memoryOutbox{events: events, published: make(map[int64]bool), lastError: make(map[int64]string)}
+}
+
+func (m *memoryOutbox) ClaimOutboxEvents(limit int, _ time.Duration) ([]models.OutboxEvent, error) {
+	var due []models.OutboxEvent
+	for _, e := range m.events {
+		if !m.published[e.ID] && len(due) < limit {
+			due = append(due, e)
+		}
+	}
+	return due, nil
+}
+
+func (m *memoryOutbox) MarkOutboxSinkPublished(id int64, sink string) error {
+	for i := range m.events {
+		if m.events[i].ID == id {
+			m.events[i].SinksDone = append(m.events[i].SinksDone, sink)
+		}
+	}
+	return nil
+}
+
+func (m *memoryOutbox) MarkOutboxPublished(id int64) error {
+	m.published[id] = true
+	m.bump(id)
+	return nil
+}
+
+func (m *memoryOutbox) MarkOutboxFailed(id int64, errMsg string, _ time.Time) error {
+	m.lastError[id] = errMsg
+	m.bump(id)
+	return nil
+}
+
+func (m *memoryOutbox) bump(id int64) {
+	for i := range m.events {
+		if m.events[i].ID == id {
+			m.events[i].Attempts++
+		}
+	}
+}
+
+// flakySink fails the first failures publishes and records the rest
+type flakySink struct {
+	failures int
+	seen     []int64
+}
+
+func (s *flakySink) Name() string { return "flaky" }
+
+func (s *flakySink) Publish(_ context.Context, event models.OutboxEvent) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("sink unavailable")
+	}
+	s.seen = append(s.seen, event.ID)
+	return nil
+}
+
+func TestDispatchAtLeastOnce(t *testing.T) {
+	repo := newMemoryOutbox(
+		models.OutboxEvent{ID: 1, EventType: models.EventOrderCreated, Payload: []byte(`{"order_id":10,"user_id":3}`)},
+		models.OutboxEvent{ID: 2, EventType: models.EventReviewCreated, Payload: []byte(`{"review_id":5}`)},
+	)
+
+	var orders []models.OrderEvent
+	inProcess := NewInProcessSink()
+	inProcess.Subscribe(models.EventOrderCreated, func(_ context.Context, e models.OutboxEvent) error {
+		var payload models.OrderEvent
+		if err := e.Decode(&payload); err != nil {
+			return err
+		}
+		orders = append(orders, payload)
+		return nil
+	})
+	flaky := &flakySink{failures: 1}
+	d := NewDispatcher(repo, inProcess, flaky)
+
+	// First pass: event 1 fails in the flaky sink, event 2 goes through
+	if n, err := d.DispatchPending(context.Background()); err != nil || n != 2 {
+		t.Fatalf("expected 2 events claimed, got %d, %v", n, err)
+	}
+	if repo.published[1] || !repo.published[2] {
+		t.Fatalf("expected only event 2 published, got %v", repo.published)
+	}
+	if repo.lastError[1] == "" {
+		t.Error("expected failure recorded for event 1")
+	}
+
+	// Second pass redelivers event 1 only to the sink that failed
+	if n, err := d.DispatchPending(context.Background()); err != nil || n != 1 {
+		t.Fatalf("expected 1 event claimed, got %d, %v", n, err)
+	}
+	if !repo.published[1] {
+		t.Fatal("expected event 1 published after retry")
+	}
+	if len(orders) != 1 || orders[0].OrderID != 10 || orders[0].UserID != 3 {
+		t.Errorf("expected order.created handled once, got %+v", orders)
+	}
+	if len(flaky.seen) != 2 {
+		t.Errorf("expected flaky sink to accept both events, got %v", flaky.seen)
+	}
+
+	if n, _ := d.DispatchPending(context.Background()); n != 0 {
+		t.Errorf("expected nothing left to dispatch, got %d", n)
+	}
+}
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	d := NewDispatcher(newMemoryOutbox())
+	if got := d.backoff(3); got != 20*time.Second {
+		t.Errorf("expected 20s after 3 attempts, got %v", got)
+	}
+	if got := d.backoff(30); got != d.MaxDelay {
+		t.Errorf("expected cap of %v, got %v", d.MaxDelay, got)
+	}
+}
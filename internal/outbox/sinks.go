@@ -0,0 +1,86 @@
+package outbox
+
+import (
+	"DemoApp/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// HandlerFunc reacts to an outbox event inside the app process
+type HandlerFunc func(ctx context.Context, event models.OutboxEvent) error
+
+// InProcessSink calls handlers subscribed to an event's type
+type InProcessSink struct {
+	mu       sync.RWMutex
+	handlers map[string][]HandlerFunc
+}
+
+func NewInProcessSink() *InProcessSink {
+	return &InProcessSink{handlers: make(map[string][]HandlerFunc)}
+}
+
+// Subscribe registers fn for events of eventType
+func (s *InProcessSink) Subscribe(eventType string, fn HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[eventType] = append(s.handlers[eventType], fn)
+}
+
+func (s *InProcessSink) Name() string { return "in-process" }
+
+// Publish runs every handler for the event. All handlers run even if one
+// fails, so on retry handlers that already succeeded see the event again.
+func (s *InProcessSink) Publish(ctx context.Context, event models.OutboxEvent) error {
+	s.mu.RLock()
+	handlers := s.handlers[event.EventType]
+	s.mu.RUnlock()
+
+	var errs []error
+	for _, fn := range handlers {
+		if err := fn(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RedisStreamSink appends events to a Redis stream for other services to
+// consume with consumer groups
+type RedisStreamSink struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+}
+
+// NewRedisStreamSink writes to stream, trimming it to roughly maxLen entries
+func NewRedisStreamSink(client *redis.Client, stream string, maxLen int64) *RedisStreamSink {
+	return &RedisStreamSink{client: client, stream: stream, maxLen: maxLen}
+}
+
+func (s *RedisStreamSink) Name() string { return "redis-stream:" + s.stream }
+
+func (s *RedisStreamSink) Publish(ctx context.Context, event models.OutboxEvent) error {
+	err := s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"event_id":       strconv.FormatInt(event.ID, 10),
+			"event_type":     event.EventType,
+			"aggregate_type": event.AggregateType,
+			"aggregate_id":   strconv.Itoa(event.AggregateID),
+			"payload":        string(event.Payload),
+			"created_at":     event.CreatedAt.UTC().Format(time.RFC3339Nano),
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("error adding event %d to stream: %w", event.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Package passkeys adapts Bookstore accounts to WebAuthn so users can sign
+// in with passkeys instead of a password.
+package passkeys
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// NewWebAuthn configures the relying party from the site's public URL. The
+// RP ID is the URL's host, so passkeys registered on one host do not work on
+// another.
+func NewWebAuthn(publicURL string) (*webauthn.WebAuthn, error) {
+	u, err := url.Parse(publicURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("passkeys: invalid public URL %q", publicURL)
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: "Bookstore",
+		RPOrigins:     []string{u.Scheme + "://" + u.Host},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: 5 * time.Minute},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: 5 * time.Minute},
+		},
+	})
+}
+
+// NewHandle returns a random WebAuthn user handle. Handles are opaque so
+// authenticators never see the account's database ID or email.
+func NewHandle() ([]byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// User is an account as seen by WebAuthn
+type User struct {
+	ID          int
+	Handle      []byte
+	Email       string
+	Name        string
+	Credentials []webauthn.Credential
+}
+
+func (u *User) WebAuthnID() []byte                         { return u.Handle }
+func (u *User) WebAuthnName() string                       { return u.Email }
+func (u *User) WebAuthnCredentials() []webauthn.Credential { return u.Credentials }
+
+func (u *User) WebAuthnDisplayName() string {
+	if u.Name != "" {
+		return u.Name
+	}
+	return u.Email
+}
+
+// RegistrationOptions asks for a discoverable credential (a passkey) with
+// user verification, excluding the user's existing credentials
+func RegistrationOptions(u *User) []webauthn.RegistrationOption {
+	return []webauthn.RegistrationOption{
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		}),
+		webauthn.WithExclusions(webauthn.Credentials(u.Credentials).CredentialDescriptors()),
+	}
+}
+
+// LoginOptions requires user verification (PIN or biometric) so a passkey
+// counts as two factors on its own
+func LoginOptions() []webauthn.LoginOption {
+	return []webauthn.LoginOption{webauthn.WithUserVerification(protocol.VerificationRequired)}
+}
+
+// EncodeSession serializes ceremony state for storage in the HTTP session
+func EncodeSession(s *webauthn.SessionData) (string, error) {
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+// DecodeSession restores ceremony state stored by EncodeSession
+func DecodeSession(data string) (webauthn.SessionData, error) {
+	var s webauthn.SessionData
+	if data == "" {
+		return s, fmt.Errorf("passkeys: no ceremony in progress")
+	}
+	err := json.Unmarshal([]byte(data), &s)
+	return s, err
+}
@@ -0,0 +1,43 @@
+package passkeys
+
+import (
+	"testing"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+func TestNewWebAuthnUsesPublicURLHost(t *testing.T) {
+	wa, err := NewWebAuthn("https://shop.example.com:8443")
+	if err != nil {
+		t.Fatalf("NewWebAuthn failed: %v", err)
+	}
+	if wa.Config.RPID != "shop.example.com" {
+		t.Errorf("expected RP ID shop.example.com, got %q", wa.Config.RPID)
+	}
+	if len(wa.Config.RPOrigins) != 1 || wa.Config.RPOrigins[0] != "https://shop.example.com:8443" {
+		t.Errorf("unexpected origins %v", wa.Config.RPOrigins)
+	}
+
+	if _, err := NewWebAuthn("not a url"); err == nil {
+		t.Error("expected an error for a URL without a host")
+	}
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	in := &webauthn.SessionData{Challenge: "abc123", UserID: []byte{1, 2, 3}}
+	encoded, err := EncodeSession(in)
+	if err != nil {
+		t.Fatalf("EncodeSession failed: %v", err)
+	}
+	out, err := DecodeSession(encoded)
+	if err != nil {
+		t.Fatalf("DecodeSession failed: %v", err)
+	}
+	if out.Challenge != in.Challenge || string(out.UserID) != string(in.UserID) {
+		t.Errorf("round trip changed session: %+v", out)
+	}
+
+	if _, err := DecodeSession(""); err == nil {
+		t.Error("expected an error when no ceremony is stored")
+	}
+}
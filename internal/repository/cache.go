@@ -55,6 +55,11 @@ func (c *CachedProductRepository) GetProductByID(id int) (*models.Product, error
 	return product, nil
 }
 
+func (c *CachedProductRepository) GetProductsByIDs(ids []int) ([]models.Product, error) {
+	// Batch lookups are not cached (key sets vary per request)
+	return c.repo.GetProductsByIDs(ids)
+}
+
 func (c *CachedProductRepository) ListProductsPaginated(page, pageSize int) (*models.ProductsResult, error) {
 	// For paginated requests, we don't cache (too many variations)
 	// Delegate directly to underlying repository
@@ -79,6 +84,19 @@ func (c *CachedProductRepository) SearchProductsPaginatedSorted(query string, ca
 	return c.repo.SearchProductsPaginatedSorted(query, categoryID, page, pageSize, sortBy)
 }
 
+func (c *CachedProductRepository) SearchProductsFaceted(ctx context.Context, query string, filters models.SearchFilters, page, pageSize int, sortBy string) (*models.SearchResult, error) {
+	// Faceted search results are not cached (too many variations)
+	return c.repo.SearchProductsFaceted(ctx, query, filters, page, pageSize, sortBy)
+}
+
+func (c *CachedProductRepository) SuggestQuery(query string) (string, error) {
+	return c.repo.SuggestQuery(query)
+}
+
+func (c *CachedProductRepository) SuggestCompletions(prefix string, limit int) (*models.Suggestions, error) {
+	return c.repo.SuggestCompletions(prefix, limit)
+}
+
 func (c *CachedProductRepository) ListProducts() ([]models.Product, error) {
 	// Try cache first
 	cacheKey := "products:all"
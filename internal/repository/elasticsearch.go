@@ -1,28 +1,59 @@
 package repository
 
 import (
+	"DemoApp/internal/embeddings"
 	"DemoApp/internal/models"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 )
 
 const (
+	// productIndex is the alias searches and writes go through. It points
+	// at one versioned index, products_<timestamp>, swapped by RebuildIndex.
 	productIndex = "products"
+	// synonymSet is the synonyms set the search analyzer reads, managed
+	// from the admin search rules page
+	synonymSet = "products"
+	// vectorField holds the embedding of each product's title and
+	// description, for semantic search
+	vectorField = "description_vector"
+)
+
+// Semantic search settings. The nearest semanticK products by embedding
+// join the keyword matches, their similarity of 0.5 to 1 scaled by
+// semanticBoost so that close meanings rank alongside keyword matches,
+// which textQuery's boosts put in the tens.
+const (
+	semanticK          = 20
+	semanticCandidates = 100
+	semanticBoost      = 20
+	// embedBatchSize is how many products are embedded per request
+	embedBatchSize = 64
+	// queryEmbedTimeout bounds embedding a search query, after which the
+	// search goes ahead by keywords only
+	queryEmbedTimeout = time.Second
 )
 
 type ElasticsearchRepository struct {
-	client *elasticsearch.Client
+	client   *elasticsearch.Client
+	embedder embeddings.Embedder // nil disables semantic search
 }
 
-func NewElasticsearchRepository(addresses []string) (*ElasticsearchRepository, error) {
+// NewElasticsearchRepository connects to Elasticsearch and makes sure the
+// products index exists. With an embedder, products are indexed with
+// vectors and hybrid searches also match by meaning.
+func NewElasticsearchRepository(addresses []string, embedder embeddings.Embedder) (*ElasticsearchRepository, error) {
 	cfg := elasticsearch.Config{
 		Addresses: addresses,
 	}
@@ -43,7 +74,13 @@ func NewElasticsearchRepository(addresses []string) (*ElasticsearchRepository, e
 		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
 	}
 
-	repo := &ElasticsearchRepository{client: es}
+	repo := &ElasticsearchRepository{client: es, embedder: embedder}
+
+	// The index's search analyzer refers to the synonyms set, so it must
+	// exist before the index is created
+	if err := repo.ensureSynonymSet(); err != nil {
+		return nil, fmt.Errorf("error initializing synonyms: %w", err)
+	}
 
 	// Initialize index
 	if err := repo.initializeIndex(); err != nil {
@@ -53,117 +90,541 @@ func NewElasticsearchRepository(addresses []string) (*ElasticsearchRepository, e
 	return repo, nil
 }
 
+// productIndexBody holds the settings and mappings of the products index
+const productIndexBody = `{
+	"settings": {
+		"number_of_shards": 1,
+		"number_of_replicas": 0,
+		"analysis": {
+			"analyzer": {
+				"autocomplete": {
+					"type": "custom",
+					"tokenizer": "standard",
+					"filter": ["lowercase", "autocomplete_filter"]
+				},
+				"autocomplete_search": {
+					"type": "custom",
+					"tokenizer": "standard",
+					"filter": ["lowercase"]
+				},
+				"synonym_search": {
+					"type": "custom",
+					"tokenizer": "standard",
+					"filter": ["lowercase", "product_synonyms"]
+				}
+			},
+			"filter": {
+				"autocomplete_filter": {
+					"type": "edge_ngram",
+					"min_gram": 2,
+					"max_gram": 20
+				},
+				"product_synonyms": {
+					"type": "synonym_graph",
+					"synonyms_set": "products",
+					"updateable": true
+				}
+			}
+		}
+	},
+	"mappings": {
+		"properties": {
+			"id": { "type": "integer" },
+			"name": { 
+				"type": "text",
+				"analyzer": "autocomplete",
+				"search_analyzer": "autocomplete_search",
+				"fields": {
+					"keyword": { "type": "keyword" },
+					"standard": { 
+						"type": "text",
+						"analyzer": "standard"
+					},
+					"synonym": {
+						"type": "text",
+						"analyzer": "standard",
+						"search_analyzer": "synonym_search"
+					}
+				}
+			},
+			"description": { 
+				"type": "text",
+				"analyzer": "standard",
+				"fields": {
+					"synonym": {
+						"type": "text",
+						"analyzer": "standard",
+						"search_analyzer": "synonym_search"
+					}
+				}
+			},
+			"price": { "type": "float" },
+			"sku": { "type": "keyword" },
+			"stock_quantity": { "type": "integer" },
+			"image_url": { "type": "keyword" },
+			"category_id": { "type": "integer" },
+			"status": { "type": "keyword" },
+			"popularity_score": { "type": "integer" },
+			"author": { 
+				"type": "text",
+				"analyzer": "standard",
+				"fields": {
+					"keyword": { "type": "keyword" }
+				}
+			},
+			"average_rating": { "type": "float" },
+			"review_count": { "type": "integer" },
+			"title_suggest": { "type": "completion", "analyzer": "simple" },
+			"author_suggest": { "type": "completion", "analyzer": "simple" }
+		}
+	}
+}`
+
+// initializeIndex makes sure the products alias resolves to an index. A
+// new cluster gets a first versioned index; an existing index gets any
+// fields mapped since it was built.
 func (r *ElasticsearchRepository) initializeIndex() error {
-	// Check if index exists
+	// Check if the alias (or an index from before aliases) exists
 	res, err := r.client.Indices.Exists([]string{productIndex})
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
-	// If index exists, return
+	// If it exists, add any fields mapped since it was created. Changed
+	// fields need a rebuild, so keep serving from the current index.
 	if res.StatusCode == 200 {
-		log.Println("Elasticsearch index 'products' already exists")
+		log.Printf("Elasticsearch index '%s' already exists", productIndex)
+		if err := r.updateMapping(); err != nil {
+			log.Printf("Warning: %v; run the reindex command to rebuild the index", err)
+		}
 		return nil
 	}
 
-	// Create index with mappings
-	mapping := `{
-		"settings": {
-			"number_of_shards": 1,
-			"number_of_replicas": 0,
-			"analysis": {
-				"analyzer": {
-					"autocomplete": {
-						"type": "custom",
-						"tokenizer": "standard",
-						"filter": ["lowercase", "autocomplete_filter"]
-					},
-					"autocomplete_search": {
-						"type": "custom",
-						"tokenizer": "standard",
-						"filter": ["lowercase"]
-					}
-				},
-				"filter": {
-					"autocomplete_filter": {
-						"type": "edge_ngram",
-						"min_gram": 2,
-						"max_gram": 20
-					}
-				}
-			}
-		},
-		"mappings": {
-			"properties": {
-				"id": { "type": "integer" },
-				"name": { 
-					"type": "text",
-					"analyzer": "autocomplete",
-					"search_analyzer": "autocomplete_search",
-					"fields": {
-						"keyword": { "type": "keyword" },
-						"standard": { 
-							"type": "text",
-							"analyzer": "standard"
-						}
-					}
-				},
-				"description": { 
-					"type": "text",
-					"analyzer": "standard"
-				},
-				"price": { "type": "float" },
-				"sku": { "type": "keyword" },
-				"stock_quantity": { "type": "integer" },
-				"image_url": { "type": "keyword" },
-				"category_id": { "type": "integer" },
-				"status": { "type": "keyword" },
-				"author": { 
-					"type": "text",
-					"analyzer": "standard",
-					"fields": {
-						"keyword": { "type": "keyword" }
-					}
-				}
-			}
-		}
-	}`
+	index, err := r.createIndexVersion()
+	if err != nil {
+		return err
+	}
+	if err := r.swapAlias(index); err != nil {
+		return err
+	}
+
+	log.Printf("Elasticsearch index '%s' created behind alias '%s'", index, productIndex)
+	return nil
+}
+
+// indexBody returns productIndexBody with the vector field mapped when
+// there is an embedder, sized to its vectors
+func (r *ElasticsearchRepository) indexBody() (map[string]json.RawMessage, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(productIndexBody), &body); err != nil {
+		return nil, fmt.Errorf("error parsing index body: %w", err)
+	}
+	if r.embedder == nil {
+		return body, nil
+	}
+
+	var mappings struct {
+		Properties map[string]interface{} `json:"properties"`
+	}
+	if err := json.Unmarshal(body["mappings"], &mappings); err != nil {
+		return nil, fmt.Errorf("error parsing index mapping: %w", err)
+	}
+	mappings.Properties[vectorField] = map[string]interface{}{
+		"type":       "dense_vector",
+		"dims":       r.embedder.Dimensions(),
+		"index":      true,
+		"similarity": "cosine",
+	}
+	data, err := json.Marshal(mappings)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling index mapping: %w", err)
+	}
+	body["mappings"] = data
+	return body, nil
+}
 
+// createIndexVersion creates an empty index with the current settings and
+// mappings, named after the alias and the time, and returns its name
+func (r *ElasticsearchRepository) createIndexVersion() (string, error) {
+	body, err := r.indexBody()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling index body: %w", err)
+	}
+
+	index := productIndex + "_" + time.Now().UTC().Format("20060102150405")
 	req := esapi.IndicesCreateRequest{
-		Index: productIndex,
-		Body:  strings.NewReader(mapping),
+		Index: index,
+		Body:  bytes.NewReader(data),
 	}
 
-	res, err = req.Do(context.Background(), r.client)
+	res, err := req.Do(context.Background(), r.client)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return "", fmt.Errorf("error creating index %s: %s", index, res.String())
+	}
+	return index, nil
+}
+
+// updateMapping puts the current field mappings on the existing index.
+// Elasticsearch accepts new fields but rejects changes to existing ones,
+// which need the index rebuilt.
+func (r *ElasticsearchRepository) updateMapping() error {
+	body, err := r.indexBody()
+	if err != nil {
+		return err
+	}
+
+	req := esapi.IndicesPutMappingRequest{
+		Index: []string{productIndex},
+		Body:  bytes.NewReader(body["mappings"]),
+	}
+	res, err := req.Do(context.Background(), r.client)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
 	if res.IsError() {
-		return fmt.Errorf("error creating index: %s", res.String())
+		return fmt.Errorf("error updating index mapping: %s", res.String())
+	}
+	return nil
+}
+
+// ensureSynonymSet creates the synonyms set, empty, if it does not exist
+func (r *ElasticsearchRepository) ensureSynonymSet() error {
+	res, err := r.client.SynonymsGetSynonym(synonymSet)
+	if err != nil {
+		return err
 	}
+	defer res.Body.Close()
 
-	log.Println("Elasticsearch index 'products' created successfully")
+	if res.StatusCode != 404 {
+		if res.IsError() {
+			return fmt.Errorf("error getting synonyms set: %s", res.String())
+		}
+		return nil
+	}
+	return r.PutSynonyms(nil)
+}
+
+// PutSynonyms replaces the synonyms set with sets. Elasticsearch reloads
+// the search analyzers using it, so searches pick up the change at once
+// without reindexing.
+func (r *ElasticsearchRepository) PutSynonyms(sets []models.SynonymSet) error {
+	rules := make([]map[string]interface{}, 0, len(sets))
+	for _, set := range sets {
+		rules = append(rules, map[string]interface{}{
+			"id":       strconv.Itoa(set.ID),
+			"synonyms": strings.Join(set.Terms, ", "),
+		})
+	}
+	data, err := json.Marshal(map[string]interface{}{"synonyms_set": rules})
+	if err != nil {
+		return fmt.Errorf("error marshaling synonyms: %w", err)
+	}
+
+	res, err := r.client.SynonymsPutSynonym(synonymSet, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error putting synonyms: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error putting synonyms: %s", res.String())
+	}
 	return nil
 }
 
+// RebuildIndex builds a new versioned index holding products, checks every
+// product made it in, then points the products alias at it in one atomic
+// step and deletes the old versions. Searches use the old index until the
+// swap, and it is left in place if any step fails. It returns the name of
+// the new index.
+func (r *ElasticsearchRepository) RebuildIndex(products []models.Product, ratings map[int]*models.ProductRating) (string, error) {
+	index, err := r.createIndexVersion()
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Building Elasticsearch index '%s'", index)
+
+	if err := r.indexProducts(index, products, ratings); err != nil {
+		r.deleteIndices(index)
+		return "", err
+	}
+	count, err := r.countDocuments(index)
+	if err != nil {
+		r.deleteIndices(index)
+		return "", err
+	}
+	if count != len(products) {
+		r.deleteIndices(index)
+		return "", fmt.Errorf("index %s holds %d documents, expected %d", index, count, len(products))
+	}
+
+	if err := r.swapAlias(index); err != nil {
+		r.deleteIndices(index)
+		return "", err
+	}
+	log.Printf("Alias '%s' now points at '%s'", productIndex, index)
+
+	old, err := r.indexVersions()
+	if err != nil {
+		return index, fmt.Errorf("listing old indices: %w", err)
+	}
+	old = slices.DeleteFunc(old, func(name string) bool { return name == index })
+	if len(old) > 0 {
+		if err := r.deleteIndices(old...); err != nil {
+			return index, err
+		}
+		log.Printf("Deleted old Elasticsearch indices: %s", strings.Join(old, ", "))
+	}
+	return index, nil
+}
+
+// swapAlias moves the products alias to index in a single request, so
+// searches never see a missing or half-built index. An index from before
+// aliases that is named products itself is deleted in the same request.
+func (r *ElasticsearchRepository) swapAlias(index string) error {
+	current, err := r.aliasIndices()
+	if err != nil {
+		return err
+	}
+
+	actions := []map[string]interface{}{}
+	if current == nil {
+		res, err := r.client.Indices.Exists([]string{productIndex})
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode == 200 {
+			actions = append(actions, map[string]interface{}{
+				"remove_index": map[string]interface{}{"index": productIndex},
+			})
+		}
+	}
+	for _, name := range current {
+		actions = append(actions, map[string]interface{}{
+			"remove": map[string]interface{}{"index": name, "alias": productIndex},
+		})
+	}
+	actions = append(actions, map[string]interface{}{
+		"add": map[string]interface{}{"index": index, "alias": productIndex},
+	})
+
+	data, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return fmt.Errorf("error marshaling alias actions: %w", err)
+	}
+	res, err := r.client.Indices.UpdateAliases(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error updating alias: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error updating alias: %s", res.String())
+	}
+	return nil
+}
+
+// aliasIndices returns the indices the products alias points at, or nil
+// if there is no such alias
+func (r *ElasticsearchRepository) aliasIndices() ([]string, error) {
+	res, err := r.client.Indices.GetAlias(r.client.Indices.GetAlias.WithName(productIndex))
+	if err != nil {
+		return nil, fmt.Errorf("error getting alias: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return nil, nil
+	}
+	if res.IsError() {
+		return nil, fmt.Errorf("error getting alias: %s", res.String())
+	}
+
+	var indices map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return nil, fmt.Errorf("error parsing alias response: %w", err)
+	}
+	names := make([]string, 0, len(indices))
+	for name := range indices {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// indexVersions returns the names of all versioned products indices
+func (r *ElasticsearchRepository) indexVersions() ([]string, error) {
+	res, err := r.client.Indices.Get([]string{productIndex + "_*"})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("error listing indices: %s", res.String())
+	}
+
+	var indices map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return nil, fmt.Errorf("error parsing indices response: %w", err)
+	}
+	names := make([]string, 0, len(indices))
+	for name := range indices {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// countDocuments returns how many documents index holds
+func (r *ElasticsearchRepository) countDocuments(index string) (int, error) {
+	res, err := r.client.Count(r.client.Count.WithIndex(index))
+	if err != nil {
+		return 0, fmt.Errorf("error counting documents: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return 0, fmt.Errorf("error counting documents: %s", res.String())
+	}
+
+	var body struct {
+		Count int `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("error parsing count response: %w", err)
+	}
+	return body.Count, nil
+}
+
+// deleteIndices deletes the named indices. Failures are logged as well as
+// returned, since callers cleaning up after another error may ignore them.
+func (r *ElasticsearchRepository) deleteIndices(indices ...string) error {
+	res, err := r.client.Indices.Delete(indices)
+	if err != nil {
+		log.Printf("Error deleting indices %v: %v", indices, err)
+		return fmt.Errorf("error deleting indices: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Printf("Error deleting indices %v: %s", indices, res.String())
+		return fmt.Errorf("error deleting indices: %s", res.String())
+	}
+	return nil
+}
+
+// completionInputs returns text and each of its word-aligned suffixes, so
+// a completion suggester matches from the start of any word
+func completionInputs(text string) []string {
+	words := strings.Fields(text)
+	inputs := make([]string, 0, len(words))
+	for i := range words {
+		inputs = append(inputs, strings.Join(words[i:], " "))
+	}
+	return inputs
+}
+
+// productDocument is the indexed form of a product. Rating is nil for
+// products without reviews, which then match no rating filter.
+func productDocument(product models.Product, rating *models.ProductRating) map[string]interface{} {
+	doc := map[string]interface{}{
+		"id":               product.ID,
+		"name":             product.Name,
+		"description":      product.Description,
+		"price":            product.Price,
+		"sku":              product.SKU,
+		"stock_quantity":   product.StockQuantity,
+		"image_url":        product.ImageURL,
+		"category_id":      product.CategoryID,
+		"status":           product.Status,
+		"author":           product.Author,
+		"popularity_score": product.PopularityScore,
+		"review_count":     0,
+	}
+	// Only active products are offered as completions, weighted by popularity
+	if product.Status == "active" {
+		weight := min(product.PopularityScore, math.MaxInt32)
+		doc["title_suggest"] = map[string]interface{}{"input": completionInputs(product.Name), "weight": weight}
+		if product.Author != nil && *product.Author != "" {
+			doc["author_suggest"] = map[string]interface{}{"input": completionInputs(*product.Author), "weight": weight}
+		}
+	}
+	if rating != nil && rating.TotalReviews > 0 {
+		doc["average_rating"] = rating.AverageRating
+		doc["review_count"] = rating.TotalReviews
+	}
+	return doc
+}
+
+// embeddingText is what a product's vector is computed from: its title
+// and description, which say what the book is about
+func embeddingText(product models.Product) string {
+	return product.Name + ". " + product.Description
+}
+
+// embedProducts returns the vectors of products in order, or nil without
+// an embedder. Products are still indexed for keyword search if the model
+// fails, so failures are logged and also return nil. Elasticsearch rejects
+// zero vectors under cosine similarity, so those are left nil.
+func (r *ElasticsearchRepository) embedProducts(products []models.Product) [][]float32 {
+	if r.embedder == nil {
+		return nil
+	}
+	vectors := make([][]float32, 0, len(products))
+	for start := 0; start < len(products); start += embedBatchSize {
+		batch := products[start:min(start+embedBatchSize, len(products))]
+		texts := make([]string, len(batch))
+		for i, p := range batch {
+			texts[i] = embeddingText(p)
+		}
+		embedded, err := r.embedder.Embed(context.Background(), texts)
+		if err != nil {
+			log.Printf("Error embedding products, indexing them without vectors: %v", err)
+			return nil
+		}
+		for _, v := range embedded {
+			if isZeroVector(v) {
+				v = nil
+			}
+			vectors = append(vectors, v)
+		}
+	}
+	return vectors
+}
+
+// isZeroVector reports whether v has no direction, as for text of only
+// stop words, and so no cosine similarity to anything
+func isZeroVector(v []float32) bool {
+	for _, x := range v {
+		if x != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // IndexProduct indexes or updates a single product
-func (r *ElasticsearchRepository) IndexProduct(product models.Product) error {
+func (r *ElasticsearchRepository) IndexProduct(product models.Product, rating *models.ProductRating) error {
+	doc := productDocument(product, rating)
+	if vectors := r.embedProducts([]models.Product{product}); vectors != nil && vectors[0] != nil {
+		doc[vectorField] = vectors[0]
+	}
+
 	// Convert product to JSON
-	data, err := json.Marshal(map[string]interface{}{
-		"id":             product.ID,
-		"name":           product.Name,
-		"description":    product.Description,
-		"price":          product.Price,
-		"sku":            product.SKU,
-		"stock_quantity": product.StockQuantity,
-		"image_url":      product.ImageURL,
-		"category_id":    product.CategoryID,
-		"status":         product.Status,
-		"author":         product.Author,
-	})
+	data, err := json.Marshal(doc)
 	if err != nil {
 		return fmt.Errorf("error marshaling product: %w", err)
 	}
@@ -189,20 +650,28 @@ func (r *ElasticsearchRepository) IndexProduct(product models.Product) error {
 	return nil
 }
 
-// IndexProducts indexes multiple products in bulk
-func (r *ElasticsearchRepository) IndexProducts(products []models.Product) error {
+// IndexProducts indexes multiple products in bulk, with their ratings keyed by product ID
+func (r *ElasticsearchRepository) IndexProducts(products []models.Product, ratings map[int]*models.ProductRating) error {
+	return r.indexProducts(productIndex, products, ratings)
+}
+
+// indexProducts bulk indexes products into index, which may be the alias
+// or an index version being built
+func (r *ElasticsearchRepository) indexProducts(index string, products []models.Product, ratings map[int]*models.ProductRating) error {
 	if len(products) == 0 {
 		return nil
 	}
 
+	vectors := r.embedProducts(products)
+
 	var buf bytes.Buffer
-	for _, product := range products {
+	for i, product := range products {
 		// Bulk API requires two lines per document:
 		// 1. Action line (index operation)
 		// 2. Document line (the actual data)
 		meta := map[string]interface{}{
 			"index": map[string]interface{}{
-				"_index": productIndex,
+				"_index": index,
 				"_id":    strconv.Itoa(product.ID),
 			},
 		}
@@ -213,17 +682,9 @@ func (r *ElasticsearchRepository) IndexProducts(products []models.Product) error
 		buf.Write(metaJSON)
 		buf.WriteByte('\n')
 
-		doc := map[string]interface{}{
-			"id":             product.ID,
-			"name":           product.Name,
-			"description":    product.Description,
-			"price":          product.Price,
-			"sku":            product.SKU,
-			"stock_quantity": product.StockQuantity,
-			"image_url":      product.ImageURL,
-			"category_id":    product.CategoryID,
-			"status":         product.Status,
-			"author":         product.Author,
+		doc := productDocument(product, ratings[product.ID])
+		if vectors != nil && vectors[i] != nil {
+			doc[vectorField] = vectors[i]
 		}
 		docJSON, err := json.Marshal(doc)
 		if err != nil {
@@ -233,7 +694,7 @@ func (r *ElasticsearchRepository) IndexProducts(products []models.Product) error
 		buf.WriteByte('\n')
 	}
 
-	res, err := r.client.Bulk(bytes.NewReader(buf.Bytes()), r.client.Bulk.WithIndex(productIndex), r.client.Bulk.WithRefresh("true"))
+	res, err := r.client.Bulk(bytes.NewReader(buf.Bytes()), r.client.Bulk.WithIndex(index), r.client.Bulk.WithRefresh("true"))
 	if err != nil {
 		return fmt.Errorf("error executing bulk request: %w", err)
 	}
@@ -262,94 +723,10 @@ func (r *ElasticsearchRepository) SearchProducts(query string, categoryID int) (
 	} else {
 		// Build bool query
 		must := []map[string]interface{}{}
-		should := []map[string]interface{}{}
 
 		// Add text search if query provided
 		if query != "" {
-			// Use bool query with should clauses for better matching
-			// 1. Autocomplete match on name (best for prefix matching, no fuzzy needed)
-			should = append(should, map[string]interface{}{
-				"match": map[string]interface{}{
-					"name": map[string]interface{}{
-						"query": query,
-						"boost": 5,
-					},
-				},
-			})
-
-			// 2. Wildcard match on name for substring matching
-			// This handles cases like "ast" in "Fast"
-			should = append(should, map[string]interface{}{
-				"wildcard": map[string]interface{}{
-					"name.keyword": map[string]interface{}{
-						"value":            "*" + query + "*",
-						"boost":            4,
-						"case_insensitive": true,
-					},
-				},
-			})
-
-			// 3. Query string with wildcards for name, description, and author
-			// This handles partial word matching like "dan" in "Daniel"
-			should = append(should, map[string]interface{}{
-				"query_string": map[string]interface{}{
-					"query":            "*" + query + "*",
-					"fields":           []string{"name", "description", "author"},
-					"default_operator": "AND",
-					"boost":            3.5,
-				},
-			})
-
-			// 4. Standard match on name.standard with conservative fuzzy for typos
-			// Only apply fuzzy for queries 5+ chars to avoid false positives
-			nameMatch := map[string]interface{}{
-				"query": query,
-				"boost": 3,
-			}
-			if len(query) >= 5 {
-				nameMatch["fuzziness"] = "1" // Allow 1 typo for longer queries
-			}
-			should = append(should, map[string]interface{}{
-				"match": map[string]interface{}{
-					"name.standard": nameMatch,
-				},
-			})
-
-			// 5. Match on author with high boost (important for book searches)
-			authorMatch := map[string]interface{}{
-				"query": query,
-				"boost": 4, // High boost for author matches
-			}
-			if len(query) >= 5 {
-				authorMatch["fuzziness"] = "1"
-			}
-			should = append(should, map[string]interface{}{
-				"match": map[string]interface{}{
-					"author": authorMatch,
-				},
-			})
-
-			// 6. Match on description with conservative fuzzy
-			descMatch := map[string]interface{}{
-				"query": query,
-				"boost": 1,
-			}
-			if len(query) >= 5 {
-				descMatch["fuzziness"] = "1"
-			}
-			should = append(should, map[string]interface{}{
-				"match": map[string]interface{}{
-					"description": descMatch,
-				},
-			})
-
-			// Add the should clauses with minimum_should_match
-			must = append(must, map[string]interface{}{
-				"bool": map[string]interface{}{
-					"should":               should,
-					"minimum_should_match": 1,
-				},
-			})
+			must = append(must, textQuery(query, true))
 		}
 
 		// Add category filter if provided
@@ -371,7 +748,7 @@ func (r *ElasticsearchRepository) SearchProducts(query string, categoryID int) (
 	}
 
 	// Add size and source filtering
-	searchQuery["size"] = 100
+	searchQuery["size"] = maxSearchResults
 	searchQuery["_source"] = []string{"id"}
 
 	// Convert to JSON
@@ -415,6 +792,635 @@ func (r *ElasticsearchRepository) SearchProducts(query string, categoryID int) (
 	return productIDs, nil
 }
 
+// maxSearchResults caps how many matching IDs SearchProducts returns
+const maxSearchResults = 100
+
+// MaxResultWindow is the deepest result (from + size) Elasticsearch pages
+// to, its index.max_result_window default
+const MaxResultWindow = 10000
+
+// searchSort returns the Elasticsearch sort for sortBy, matching
+// getOrderClause. An empty sortBy or "relevance" sorts by score.
+func searchSort(sortBy string) []interface{} {
+	byName := map[string]interface{}{"name.keyword": "asc"}
+	switch sortBy {
+	case "price_asc":
+		return []interface{}{map[string]interface{}{"price": "asc"}, byName}
+	case "price_desc":
+		return []interface{}{map[string]interface{}{"price": "desc"}, byName}
+	case "popularity":
+		return []interface{}{map[string]interface{}{"popularity_score": "desc"}, byName}
+	case "newest":
+		return []interface{}{map[string]interface{}{"id": "desc"}, byName}
+	case "", "relevance":
+		return []interface{}{"_score", byName}
+	default:
+		return []interface{}{byName}
+	}
+}
+
+// facetFilters returns the Elasticsearch filter clauses for filters, leaving
+// out the facet named skip
+func facetFilters(filters models.SearchFilters, skip string) []map[string]interface{} {
+	clauses := []map[string]interface{}{}
+	if len(filters.CategoryIDs) > 0 && skip != facetCategory {
+		clauses = append(clauses, map[string]interface{}{
+			"terms": map[string]interface{}{"category_id": filters.CategoryIDs},
+		})
+	}
+	if len(filters.Authors) > 0 && skip != facetAuthor {
+		clauses = append(clauses, map[string]interface{}{
+			"terms": map[string]interface{}{"author.keyword": filters.Authors},
+		})
+	}
+	if ranges := models.SelectedRanges(models.PriceRanges, filters.PriceRanges); len(ranges) > 0 && skip != facetPrice {
+		clauses = append(clauses, rangeFilter("price", ranges))
+	}
+	if ranges := models.SelectedRanges(models.RatingRanges, filters.RatingRanges); len(ranges) > 0 && skip != facetRating {
+		clauses = append(clauses, rangeFilter("average_rating", ranges))
+	}
+	if filters.InStock && skip != facetInStock {
+		clauses = append(clauses, inStockFilter())
+	}
+	return clauses
+}
+
+// rangeFilter matches field in any of ranges
+func rangeFilter(field string, ranges []models.FacetRange) map[string]interface{} {
+	should := make([]map[string]interface{}, 0, len(ranges))
+	for _, r := range ranges {
+		bounds := map[string]interface{}{"gte": r.Min}
+		if r.Max > 0 {
+			bounds["lt"] = r.Max
+		}
+		should = append(should, map[string]interface{}{
+			"range": map[string]interface{}{field: bounds},
+		})
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{"should": should, "minimum_should_match": 1},
+	}
+}
+
+func inStockFilter() map[string]interface{} {
+	return map[string]interface{}{
+		"range": map[string]interface{}{"stock_quantity": map[string]interface{}{"gt": 0}},
+	}
+}
+
+// rangeAggregation counts documents per range, keyed by FacetRange.Key
+func rangeAggregation(field string, ranges []models.FacetRange) map[string]interface{} {
+	buckets := make([]map[string]interface{}, 0, len(ranges))
+	for _, r := range ranges {
+		bucket := map[string]interface{}{"key": r.Key, "from": r.Min}
+		if r.Max > 0 {
+			bucket["to"] = r.Max
+		}
+		buckets = append(buckets, bucket)
+	}
+	return map[string]interface{}{
+		"range": map[string]interface{}{"field": field, "keyed": true, "ranges": buckets},
+	}
+}
+
+// facetAggregation wraps agg in a filter of every selected facet but skip
+func facetAggregation(filters models.SearchFilters, skip string, agg map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"filter": map[string]interface{}{
+			"bool": map[string]interface{}{"filter": facetFilters(filters, skip)},
+		},
+		"aggs": map[string]interface{}{"values": agg},
+	}
+}
+
+type esKeyedBuckets struct {
+	Values struct {
+		Buckets map[string]struct {
+			DocCount int `json:"doc_count"`
+		} `json:"buckets"`
+	} `json:"values"`
+}
+
+type esSearchResponse struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Source struct {
+				ID int `json:"id"`
+			} `json:"_source"`
+			Highlight map[string][]string `json:"highlight"`
+		} `json:"hits"`
+	} `json:"hits"`
+	Aggregations struct {
+		Categories struct {
+			Values struct {
+				Buckets []struct {
+					Key      int `json:"key"`
+					DocCount int `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"values"`
+		} `json:"categories"`
+		Authors struct {
+			Values struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"values"`
+		} `json:"authors"`
+		Prices  esKeyedBuckets `json:"prices"`
+		Ratings esKeyedBuckets `json:"ratings"`
+		InStock struct {
+			DocCount int `json:"doc_count"`
+		} `json:"in_stock"`
+	} `json:"aggregations"`
+}
+
+// searchPage is one page of product IDs from searchProducts
+type searchPage struct {
+	ids        []int
+	total      int
+	highlights map[int]*models.Highlight // By product ID, when there was a query
+	counts     *facetCounts              // Nil unless facets were requested
+}
+
+// highlightRequest asks for the matched parts of name, author and
+// description. The html encoder escapes the text around the <mark> tags, so
+// the fragments are safe to render.
+var highlightRequest = map[string]interface{}{
+	"encoder":   "html",
+	"pre_tags":  []string{"<mark>"},
+	"post_tags": []string{"</mark>"},
+	"fields": map[string]interface{}{
+		"name":                map[string]interface{}{"number_of_fragments": 0},
+		"name.standard":       map[string]interface{}{"number_of_fragments": 0},
+		"name.synonym":        map[string]interface{}{"number_of_fragments": 0},
+		"author":              map[string]interface{}{"number_of_fragments": 0},
+		"description":         map[string]interface{}{"fragment_size": snippetSize, "number_of_fragments": 2},
+		"description.synonym": map[string]interface{}{"fragment_size": snippetSize, "number_of_fragments": 2},
+	},
+}
+
+// parseHighlight turns the highlight of a hit into a models.Highlight,
+// preferring the autocomplete name field's marks over the standard one's,
+// and falling back to synonym matches when the query's own words did not
+// match
+func parseHighlight(fields map[string][]string) *models.Highlight {
+	first := func(field string) string {
+		if fragments := fields[field]; len(fragments) > 0 {
+			return fragments[0]
+		}
+		return ""
+	}
+	h := &models.Highlight{
+		Name:        first("name"),
+		Author:      first("author"),
+		Description: fields["description"],
+	}
+	if h.Name == "" {
+		h.Name = first("name.standard")
+	}
+	if h.Name == "" {
+		h.Name = first("name.synonym")
+	}
+	if len(h.Description) == 0 {
+		h.Description = fields["description.synonym"]
+	}
+	return h
+}
+
+// searchProducts returns one page of the IDs of active products matching
+// the rules' query and filters, in sortBy order, with the exact total. With
+// withFacets it also counts facets; the facet filters are applied as a
+// post_filter so each aggregation can drop its own.
+func (r *ElasticsearchRepository) searchProducts(ctx context.Context, rules *searchRules, filters models.SearchFilters, from, size int, sortBy string, withFacets bool) (*searchPage, error) {
+	query := rules.query
+	must := []map[string]interface{}{}
+	if query != "" {
+		must = append(must, promoteQuery(textQuery(query, rules.synonyms), rules))
+	}
+	searchQuery := map[string]interface{}{
+		"from":             from,
+		"size":             size,
+		"sort":             searchSort(sortBy),
+		"track_total_hits": true,
+		"_source":          []string{"id"},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must":   must,
+				"filter": []map[string]interface{}{{"term": map[string]interface{}{"status": "active"}}},
+			},
+		},
+		"post_filter": map[string]interface{}{
+			"bool": map[string]interface{}{"filter": facetFilters(filters, "")},
+		},
+	}
+	if query != "" {
+		searchQuery["highlight"] = highlightRequest
+	}
+	if query != "" && filters.Mode == models.SearchHybrid {
+		if knn := r.semanticQuery(ctx, query); knn != nil {
+			searchQuery["knn"] = knn
+		}
+	}
+	if withFacets {
+		searchQuery["aggs"] = map[string]interface{}{
+			"categories": facetAggregation(filters, facetCategory, map[string]interface{}{
+				"terms": map[string]interface{}{"field": "category_id", "size": 100},
+			}),
+			"authors": facetAggregation(filters, facetAuthor, map[string]interface{}{
+				"terms": map[string]interface{}{"field": "author.keyword", "size": authorFacetSize},
+			}),
+			"prices":  facetAggregation(filters, facetPrice, rangeAggregation("price", models.PriceRanges)),
+			"ratings": facetAggregation(filters, facetRating, rangeAggregation("average_rating", models.RatingRanges)),
+			"in_stock": map[string]interface{}{
+				"filter": map[string]interface{}{
+					"bool": map[string]interface{}{
+						"filter": append(facetFilters(filters, facetInStock), inStockFilter()),
+					},
+				},
+			},
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(searchQuery); err != nil {
+		return nil, fmt.Errorf("error encoding query: %w", err)
+	}
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(ctx),
+		r.client.Search.WithIndex(productIndex),
+		r.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error performing search: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("error response from search: %s", res.String())
+	}
+
+	var result esSearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+
+	page := &searchPage{ids: make([]int, 0, len(result.Hits.Hits)), total: result.Hits.Total.Value}
+	if query != "" {
+		page.highlights = make(map[int]*models.Highlight, len(result.Hits.Hits))
+	}
+	for _, hit := range result.Hits.Hits {
+		page.ids = append(page.ids, hit.Source.ID)
+		if query != "" {
+			page.highlights[hit.Source.ID] = parseHighlight(hit.Highlight)
+		}
+	}
+	if !withFacets {
+		return page, nil
+	}
+
+	aggs := result.Aggregations
+	page.counts = &facetCounts{
+		categories: make(map[int]int),
+		prices:     make(map[string]int),
+		ratings:    make(map[string]int),
+		inStock:    aggs.InStock.DocCount,
+	}
+	for _, b := range aggs.Categories.Values.Buckets {
+		page.counts.categories[b.Key] = b.DocCount
+	}
+	for _, b := range aggs.Authors.Values.Buckets {
+		page.counts.authors = append(page.counts.authors, authorCount{name: b.Key, count: b.DocCount})
+	}
+	for key, b := range aggs.Prices.Values.Buckets {
+		page.counts.prices[key] = b.DocCount
+	}
+	for key, b := range aggs.Ratings.Values.Buckets {
+		page.counts.ratings[key] = b.DocCount
+	}
+	return page, nil
+}
+
+// semanticQuery finds the active products whose vectors are nearest the
+// query's, or returns nil, searching by keywords only, when there is no
+// embedder or it fails. The results join the keyword matches, so facets,
+// post_filter and sorting apply to both.
+func (r *ElasticsearchRepository) semanticQuery(ctx context.Context, query string) map[string]interface{} {
+	if r.embedder == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, queryEmbedTimeout)
+	defer cancel()
+	vectors, err := r.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		log.Printf("Error embedding query, searching by keywords only: %v", err)
+		return nil
+	}
+	if isZeroVector(vectors[0]) {
+		return nil
+	}
+	return map[string]interface{}{
+		"field":          vectorField,
+		"query_vector":   vectors[0],
+		"k":              semanticK,
+		"num_candidates": semanticCandidates,
+		"boost":          semanticBoost,
+		"filter":         map[string]interface{}{"term": map[string]interface{}{"status": "active"}},
+	}
+}
+
+// promoteQuery applies the admin rules for a query: boosted products'
+// scores are multiplied by their boost, and pinned products are put first
+// in order whether or not they match
+func promoteQuery(scoring map[string]interface{}, rules *searchRules) map[string]interface{} {
+	if len(rules.boosts) > 0 {
+		functions := make([]map[string]interface{}, 0, len(rules.boosts))
+		for id, boost := range rules.boosts {
+			functions = append(functions, map[string]interface{}{
+				"filter": map[string]interface{}{"ids": map[string]interface{}{"values": []string{strconv.Itoa(id)}}},
+				"weight": boost,
+			})
+		}
+		scoring = map[string]interface{}{
+			"function_score": map[string]interface{}{
+				"query":      scoring,
+				"functions":  functions,
+				"score_mode": "multiply",
+				"boost_mode": "multiply",
+			},
+		}
+	}
+	if len(rules.pinned) > 0 {
+		ids := make([]string, len(rules.pinned))
+		for i, id := range rules.pinned {
+			ids[i] = strconv.Itoa(id)
+		}
+		scoring = map[string]interface{}{
+			"pinned": map[string]interface{}{"ids": ids, "organic": scoring},
+		}
+	}
+	return scoring
+}
+
+// suggestFields are the fields spelling suggestions are drawn from
+var suggestFields = map[string]string{"name": "name.standard", "author": "author"}
+
+// SuggestQuery returns a respelling of query built from words in product
+// names and authors, or "" when no better spelling is found. Each field is
+// asked separately and the best scoring suggestion wins.
+func (r *ElasticsearchRepository) SuggestQuery(query string) (string, error) {
+	suggest := map[string]interface{}{"text": query}
+	for name, field := range suggestFields {
+		suggest[name] = map[string]interface{}{
+			"phrase": map[string]interface{}{
+				"field":      field,
+				"size":       1,
+				"gram_size":  1,
+				"confidence": 1,
+				"direct_generator": []map[string]interface{}{{
+					"field":           field,
+					"suggest_mode":    "always",
+					"min_word_length": 3,
+				}},
+			},
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"size": 0, "suggest": suggest}); err != nil {
+		return "", fmt.Errorf("error encoding suggest query: %w", err)
+	}
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(context.Background()),
+		r.client.Search.WithIndex(productIndex),
+		r.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return "", fmt.Errorf("error performing suggest: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return "", fmt.Errorf("error response from suggest: %s", res.String())
+	}
+
+	var result struct {
+		Suggest map[string][]struct {
+			Options []struct {
+				Text  string  `json:"text"`
+				Score float64 `json:"score"`
+			} `json:"options"`
+		} `json:"suggest"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("error parsing suggest response: %w", err)
+	}
+
+	best, bestScore := "", 0.0
+	for _, entries := range result.Suggest {
+		for _, entry := range entries {
+			for _, option := range entry.Options {
+				if option.Score > bestScore && !strings.EqualFold(option.Text, query) {
+					best, bestScore = option.Text, option.Score
+				}
+			}
+		}
+	}
+	return best, nil
+}
+
+// SuggestCompletions returns up to limit titles and limit authors that
+// complete prefix, from the completion suggester fields. Categories are not
+// indexed, so they are left for the caller.
+func (r *ElasticsearchRepository) SuggestCompletions(prefix string, limit int) (*models.Suggestions, error) {
+	completion := func(field string) map[string]interface{} {
+		c := map[string]interface{}{"field": field, "size": limit, "skip_duplicates": true}
+		// Tolerate a typo once there is enough typed to tell what was meant
+		if len([]rune(prefix)) >= 4 {
+			c["fuzzy"] = map[string]interface{}{"fuzziness": 1}
+		}
+		return map[string]interface{}{"prefix": prefix, "completion": c}
+	}
+	suggestQuery := map[string]interface{}{
+		"_source": []string{"id", "name", "author"},
+		"suggest": map[string]interface{}{
+			"titles":  completion("title_suggest"),
+			"authors": completion("author_suggest"),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(suggestQuery); err != nil {
+		return nil, fmt.Errorf("error encoding completion query: %w", err)
+	}
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(context.Background()),
+		r.client.Search.WithIndex(productIndex),
+		r.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error performing completion: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("error response from completion: %s", res.String())
+	}
+
+	type option struct {
+		Source struct {
+			ID     int    `json:"id"`
+			Name   string `json:"name"`
+			Author string `json:"author"`
+		} `json:"_source"`
+	}
+	var result struct {
+		Suggest struct {
+			Titles []struct {
+				Options []option `json:"options"`
+			} `json:"titles"`
+			Authors []struct {
+				Options []option `json:"options"`
+			} `json:"authors"`
+		} `json:"suggest"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing completion response: %w", err)
+	}
+
+	suggestions := &models.Suggestions{Titles: []models.TitleSuggestion{}, Authors: []string{}}
+	seenTitles := make(map[int]bool)
+	for _, entry := range result.Suggest.Titles {
+		for _, o := range entry.Options {
+			if !seenTitles[o.Source.ID] && len(suggestions.Titles) < limit {
+				seenTitles[o.Source.ID] = true
+				suggestions.Titles = append(suggestions.Titles, models.TitleSuggestion{
+					ProductID: o.Source.ID, Title: o.Source.Name, Author: o.Source.Author,
+				})
+			}
+		}
+	}
+	// Several inputs of one author can match, so dedupe by the author's name
+	seenAuthors := make(map[string]bool)
+	for _, entry := range result.Suggest.Authors {
+		for _, o := range entry.Options {
+			if !seenAuthors[o.Source.Author] && len(suggestions.Authors) < limit {
+				seenAuthors[o.Source.Author] = true
+				suggestions.Authors = append(suggestions.Authors, o.Source.Author)
+			}
+		}
+	}
+	return suggestions, nil
+}
+
+// textQuery matches query against name, author and description, favouring
+// name and author matches and tolerating a typo in longer queries. With
+// synonyms it also matches the admin-managed synonyms of its terms.
+func textQuery(query string, synonyms bool) map[string]interface{} {
+	should := []map[string]interface{}{}
+
+	// Use bool query with should clauses for better matching
+	// 1. Autocomplete match on name (best for prefix matching, no fuzzy needed)
+	should = append(should, map[string]interface{}{
+		"match": map[string]interface{}{
+			"name": map[string]interface{}{
+				"query": query,
+				"boost": 5,
+			},
+		},
+	})
+
+	// 2. Wildcard match on name for substring matching
+	// This handles cases like "ast" in "Fast"
+	should = append(should, map[string]interface{}{
+		"wildcard": map[string]interface{}{
+			"name.keyword": map[string]interface{}{
+				"value":            "*" + query + "*",
+				"boost":            4,
+				"case_insensitive": true,
+			},
+		},
+	})
+
+	// 3. Query string with wildcards for name, description, and author
+	// This handles partial word matching like "dan" in "Daniel"
+	should = append(should, map[string]interface{}{
+		"query_string": map[string]interface{}{
+			"query":            "*" + query + "*",
+			"fields":           []string{"name", "description", "author"},
+			"default_operator": "AND",
+			"boost":            3.5,
+		},
+	})
+
+	// 4. Standard match on name.standard with conservative fuzzy for typos
+	// Only apply fuzzy for queries 5+ chars to avoid false positives
+	nameMatch := map[string]interface{}{
+		"query": query,
+		"boost": 3,
+	}
+	if len(query) >= 5 {
+		nameMatch["fuzziness"] = "1" // Allow 1 typo for longer queries
+	}
+	should = append(should, map[string]interface{}{
+		"match": map[string]interface{}{
+			"name.standard": nameMatch,
+		},
+	})
+
+	// 5. Match on author with high boost (important for book searches)
+	authorMatch := map[string]interface{}{
+		"query": query,
+		"boost": 4, // High boost for author matches
+	}
+	if len(query) >= 5 {
+		authorMatch["fuzziness"] = "1"
+	}
+	should = append(should, map[string]interface{}{
+		"match": map[string]interface{}{
+			"author": authorMatch,
+		},
+	})
+
+	// 6. Match on description with conservative fuzzy
+	descMatch := map[string]interface{}{
+		"query": query,
+		"boost": 1,
+	}
+	if len(query) >= 5 {
+		descMatch["fuzziness"] = "1"
+	}
+	should = append(should, map[string]interface{}{
+		"match": map[string]interface{}{
+			"description": descMatch,
+		},
+	})
+
+	// 7. Admin-managed synonyms, e.g. "sci-fi" for "science fiction",
+	// expanded by the search analyzer of the synonym subfields
+	if synonyms {
+		should = append(should, map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":  query,
+				"fields": []string{"name.synonym^3", "description.synonym"},
+			},
+		})
+	}
+
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should":               should,
+			"minimum_should_match": 1,
+		},
+	}
+}
+
 // DeleteProduct removes a product from the index
 func (r *ElasticsearchRepository) DeleteProduct(productID int) error {
 	req := esapi.DeleteRequest{
@@ -2,9 +2,15 @@ package repository
 
 import (
 	"DemoApp/internal/models"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -51,11 +57,172 @@ func (r *PostgresRepository) Reviews() ReviewRepository {
 	return &postgresReviewRepo{DB: r.DB}
 }
 
+func (r *PostgresRepository) Webhooks() WebhookRepository {
+	return &postgresWebhookRepo{DB: r.DB}
+}
+
+func (r *PostgresRepository) Outbox() OutboxRepository {
+	return &postgresOutboxRepo{DB: r.DB}
+}
+
+func (r *PostgresRepository) Audit() AuditRepository {
+	return &postgresAuditRepo{DB: r.DB}
+}
+
+func (r *PostgresRepository) PasswordResets() PasswordResetRepository {
+	return &postgresPasswordResetRepo{DB: r.DB}
+}
+
+func (r *PostgresRepository) EmailVerifications() EmailVerificationRepository {
+	return &postgresEmailVerificationRepo{DB: r.DB}
+}
+
+func (r *PostgresRepository) TwoFactor() TwoFactorRepository {
+	return &postgresTwoFactorRepo{DB: r.DB}
+}
+
+func (r *PostgresRepository) Passkeys() PasskeyRepository {
+	return &postgresPasskeyRepo{DB: r.DB}
+}
+
+func (r *PostgresRepository) Sessions() SessionRepository {
+	return &postgresSessionRepo{DB: r.DB}
+}
+
+func (r *PostgresRepository) Identities() IdentityRepository {
+	return &postgresIdentityRepo{DB: r.DB}
+}
+
+func (r *PostgresRepository) SearchRules() SearchRulesRepository {
+	return &postgresSearchRulesRepo{DB: r.DB, ES: r.ES}
+}
+
+func (r *PostgresRepository) SearchAnalytics() SearchAnalyticsRepository {
+	return &postgresSearchAnalyticsRepo{DB: r.DB}
+}
+
+// RefreshProduct re-syncs derived copies of a product after it changes:
+// the Redis cache entry is dropped and the Elasticsearch document reindexed
+func (r *PostgresRepository) RefreshProduct(id int) error {
+	if cached, ok := r.CachedProducts.(*CachedProductRepository); ok {
+		cached.InvalidateProduct(id)
+	}
+	if r.ES == nil {
+		return nil
+	}
+	product, err := (&postgresProductRepo{DB: r.DB}).GetProductByID(id)
+	if err != nil {
+		return err
+	}
+	rating, err := (&postgresReviewRepo{DB: r.DB}).GetProductRating(id)
+	if err != nil {
+		return err
+	}
+	return r.ES.IndexProduct(*product, rating)
+}
+
+// ReindexProducts bulk indexes every active product with its rating into
+// Elasticsearch, returning how many were indexed
+func (r *PostgresRepository) ReindexProducts() (int, error) {
+	if r.ES == nil {
+		return 0, nil
+	}
+	products, ratings, err := r.indexableProducts()
+	if err != nil {
+		return 0, err
+	}
+	if err := r.ES.IndexProducts(products, ratings); err != nil {
+		return 0, err
+	}
+	return len(products), nil
+}
+
+// rebuildCatchUpMargin widens the window of changes re-indexed after a
+// rebuild to cover transactions that began before the snapshot was read but
+// committed after it
+const rebuildCatchUpMargin = time.Minute
+
+// RebuildSearchIndex builds a fresh Elasticsearch index from Postgres and
+// swaps it in behind the products alias, returning how many products it
+// holds. Changes made while the index was building went to the old index,
+// so once the new one is live every product with an outbox event since the
+// snapshot is indexed again through the alias.
+func (r *PostgresRepository) RebuildSearchIndex() (int, error) {
+	if r.ES == nil {
+		return 0, errors.New("elasticsearch is not configured")
+	}
+	var snapshotAt time.Time
+	if err := r.DB.QueryRow("SELECT NOW()").Scan(&snapshotAt); err != nil {
+		return 0, err
+	}
+	products, ratings, err := r.indexableProducts()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.ES.RebuildIndex(products, ratings); err != nil {
+		return 0, err
+	}
+
+	changed, err := r.productsChangedSince(snapshotAt.Add(-rebuildCatchUpMargin))
+	if err != nil {
+		return 0, fmt.Errorf("listing products changed during rebuild: %w", err)
+	}
+	for _, id := range changed {
+		if err := r.RefreshProduct(id); err != nil {
+			log.Printf("Error re-indexing product %d after rebuild: %v", id, err)
+		}
+	}
+	if len(changed) > 0 {
+		log.Printf("Re-indexed %d products changed during the rebuild", len(changed))
+	}
+	return len(products), nil
+}
+
+// productsChangedSince lists the products named in outbox events written
+// since since. Product and review events both carry the product ID.
+func (r *PostgresRepository) productsChangedSince(since time.Time) ([]int, error) {
+	rows, err := r.DB.Query(`
+		SELECT DISTINCT (payload->>'product_id')::int FROM outbox_events
+		WHERE created_at >= $1 AND payload ? 'product_id'`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// indexableProducts loads every active product and the ratings indexed with them
+func (r *PostgresRepository) indexableProducts() ([]models.Product, map[int]*models.ProductRating, error) {
+	products, err := (&postgresProductRepo{DB: r.DB}).ListProducts()
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing products: %w", err)
+	}
+	ids := make([]int, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+	ratings, err := (&postgresReviewRepo{DB: r.DB}).GetProductRatings(ids)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading ratings: %w", err)
+	}
+	return products, ratings, nil
+}
+
 // --- Product Implementation ---
 
 type postgresProductRepo struct {
-	DB *sql.DB
-	ES *ElasticsearchRepository
+	DB        *sql.DB
+	ES        *ElasticsearchRepository
+	skipRules bool // Search without the admin synonyms and promotions, for previews
 }
 
 func (r *postgresProductRepo) ListProducts() ([]models.Product, error) {
@@ -139,7 +306,9 @@ func (r *postgresProductRepo) ListProductsPaginatedSorted(page, pageSize int, so
 	}, nil
 }
 
-// getOrderClause returns a safe ORDER BY clause based on the sortBy parameter
+// getOrderClause returns a safe ORDER BY clause based on the sortBy parameter.
+// Searches rank by relevance first (see productSearchOrder), so "relevance"
+// sorts by name here.
 func getOrderClause(sortBy string) string {
 	switch sortBy {
 	case "price_asc":
@@ -190,24 +359,18 @@ func (r *postgresProductRepo) SearchProducts(query string, categoryID int) ([]mo
 		}
 	}
 
-	// Fallback to SQL-based search (original implementation)
-	q := `SELECT id, name, description, price, sku, stock_quantity, image_url, category_id, status, author, COALESCE(popularity_score, 0) 
-	      FROM products WHERE status = 'active'`
-	var args []interface{}
-	argID := 1
-
+	// Fallback to SQL-based search, best matches first
+	rules := &searchRules{query: query}
 	if query != "" {
-		q += fmt.Sprintf(" AND (name ILIKE $%d OR description ILIKE $%d OR author ILIKE $%d)", argID, argID, argID)
-		args = append(args, "%"+query+"%")
-		argID++
+		rules.terms = []string{query}
 	}
-
+	var filters models.SearchFilters
 	if categoryID > 0 {
-		q += fmt.Sprintf(" AND category_id = $%d", argID)
-		args = append(args, categoryID)
+		filters.CategoryIDs = []int{categoryID}
 	}
-
-	q += " ORDER BY name"
+	where, args := productSearchWhere(rules, filters, "")
+	q := fmt.Sprintf(`SELECT id, name, description, price, sku, stock_quantity, image_url, category_id, status, author, COALESCE(popularity_score, 0)
+	      FROM %s WHERE %s ORDER BY %s`, productSearchFrom, where, productSearchOrder(rules, "relevance"))
 
 	rows, err := r.DB.Query(q, args...)
 	if err != nil {
@@ -239,55 +402,28 @@ func (r *postgresProductRepo) SearchProductsPaginatedSorted(query string, catego
 		pageSize = 10 // Default
 	}
 
-	// Build count query
-	countQuery := `SELECT COUNT(*) FROM products WHERE status = 'active'`
-	var countArgs []interface{}
-	argID := 1
-
-	if query != "" {
-		countQuery += fmt.Sprintf(" AND (name ILIKE $%d OR description ILIKE $%d OR author ILIKE $%d)", argID, argID, argID)
-		countArgs = append(countArgs, "%"+query+"%")
-		argID++
-	}
-
+	var filters models.SearchFilters
 	if categoryID > 0 {
-		countQuery += fmt.Sprintf(" AND category_id = $%d", argID)
-		countArgs = append(countArgs, categoryID)
+		filters.CategoryIDs = []int{categoryID}
 	}
-
-	// Get total count
-	var totalItems int
-	err := r.DB.QueryRow(countQuery, countArgs...).Scan(&totalItems)
+	rules, err := r.searchRules(query, sortBy)
 	if err != nil {
 		return nil, err
 	}
-
-	// Calculate offset
-	offset := (page - 1) * pageSize
-
-	// Determine ORDER BY clause based on sortBy parameter
-	orderClause := getOrderClause(sortBy)
-
-	// Build products query
-	q := `SELECT id, name, description, price, sku, stock_quantity, image_url, category_id, status, author, COALESCE(popularity_score, 0) 
-	      FROM products WHERE status = 'active'`
-	var args []interface{}
-	argID = 1
-
-	if query != "" {
-		q += fmt.Sprintf(" AND (name ILIKE $%d OR description ILIKE $%d OR author ILIKE $%d)", argID, argID, argID)
-		args = append(args, "%"+query+"%")
-		argID++
+	if products, result, ok := r.searchElasticsearch(context.Background(), rules, filters, page, pageSize, sortBy, false); ok {
+		return &models.ProductsResult{Products: products, Pagination: newPagination(page, pageSize, result.total)}, nil
 	}
 
-	if categoryID > 0 {
-		q += fmt.Sprintf(" AND category_id = $%d", argID)
-		args = append(args, categoryID)
-		argID++
+	where, args := productSearchWhere(rules, filters, "")
+	var totalItems int
+	if err := r.DB.QueryRow("SELECT COUNT(*) FROM "+productSearchFrom+" WHERE "+where, args...).Scan(&totalItems); err != nil {
+		return nil, err
 	}
 
-	q += fmt.Sprintf(" ORDER BY %s LIMIT $%d OFFSET $%d", orderClause, argID, argID+1)
-	args = append(args, pageSize, offset)
+	q := fmt.Sprintf(`SELECT id, name, description, price, sku, stock_quantity, image_url, category_id, status, author, COALESCE(popularity_score, 0)
+	      FROM %s WHERE %s ORDER BY %s LIMIT $%d OFFSET $%d`,
+		productSearchFrom, where, productSearchOrder(rules, sortBy), len(args)+1, len(args)+2)
+	args = append(args, pageSize, (page-1)*pageSize)
 
 	rows, err := r.DB.Query(q, args...)
 	if err != nil {
@@ -318,148 +454,578 @@ func (r *postgresProductRepo) SearchProductsPaginatedSorted(query string, catego
 	}, nil
 }
 
-// getProductsByIDs fetches products by IDs and maintains the order
-func (r *postgresProductRepo) getProductsByIDs(ids []int) ([]models.Product, error) {
-	if len(ids) == 0 {
-		return []models.Product{}, nil
+// SearchProductsFaceted searches active products with facet filters and
+// returns one page of results with facet counts. Elasticsearch is used when
+// available, falling back to SQL. An empty sortBy keeps Elasticsearch's
+// relevance order.
+func (r *postgresProductRepo) SearchProductsFaceted(ctx context.Context, query string, filters models.SearchFilters, page, pageSize int, sortBy string) (*models.SearchResult, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10 // Default
 	}
 
-	// Create a map to store products by ID
-	productMap := make(map[int]models.Product)
+	categories, err := r.ListCategories()
+	if err != nil {
+		return nil, err
+	}
 
-	// Build query with IN clause
-	q := `SELECT id, name, description, price, sku, stock_quantity, image_url, category_id, status, author, COALESCE(popularity_score, 0) 
-	      FROM products WHERE id = ANY($1) AND status = 'active'`
+	rules, err := r.searchRules(query, sortBy)
+	if err != nil {
+		return nil, err
+	}
+	if products, result, ok := r.searchElasticsearch(ctx, rules, filters, page, pageSize, sortBy, true); ok {
+		return &models.SearchResult{
+			Hits:       searchHits(products, result.highlights),
+			Pagination: newPagination(page, pageSize, result.total),
+			Facets:     buildFacets(*result.counts, filters, categories),
+		}, nil
+	}
 
-	rows, err := r.DB.Query(q, pq.Array(ids))
+	where, args := productSearchWhere(rules, filters, "")
+	order := productSearchOrder(rules, sortBy)
+
+	var totalItems int
+	if err := r.DB.QueryRow("SELECT COUNT(*) FROM "+productSearchFrom+" WHERE "+where, args...).Scan(&totalItems); err != nil {
+		return nil, err
+	}
+
+	q := fmt.Sprintf(`SELECT id, name, description, price, sku, stock_quantity, image_url, category_id, status, author, COALESCE(popularity_score, 0)
+	      FROM %s WHERE %s ORDER BY %s LIMIT $%d OFFSET $%d`,
+		productSearchFrom, where, order, len(args)+1, len(args)+2)
+	rows, err := r.DB.Query(q, append(args, pageSize, (page-1)*pageSize)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	// Fetch all products into the map
+	products := []models.Product{}
 	for rows.Next() {
 		var p models.Product
 		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Price, &p.SKU, &p.StockQuantity, &p.ImageURL, &p.CategoryID, &p.Status, &p.Author, &p.PopularityScore); err != nil {
 			return nil, err
 		}
-		productMap[p.ID] = p
+		products = append(products, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	// Build result slice in the order of input IDs (Elasticsearch relevance order)
-	products := make([]models.Product, 0, len(ids))
-	for _, id := range ids {
-		if p, exists := productMap[id]; exists {
-			products = append(products, p)
-		}
+	counts, err := r.facetCountsSQL(rules, filters)
+	if err != nil {
+		return nil, err
 	}
 
-	return products, nil
+	var highlights map[int]*models.Highlight
+	if query != "" {
+		highlights = highlightProducts(products, highlightTerms(rules.terms))
+	}
+
+	return &models.SearchResult{
+		Hits:       searchHits(products, highlights),
+		Pagination: newPagination(page, pageSize, totalItems),
+		Facets:     buildFacets(*counts, filters, categories),
+	}, nil
 }
 
-func (r *postgresProductRepo) ListCategories() ([]models.Category, error) {
-	query := `SELECT id, name, description FROM categories ORDER BY name`
-	rows, err := r.DB.Query(query)
+// SuggestQuery returns a respelling of query from the words of product
+// names and authors, or "" when none is closer. Elasticsearch's suggesters
+// are used when available; otherwise the words are compared by edit distance.
+func (r *postgresProductRepo) SuggestQuery(query string) (string, error) {
+	if r.ES != nil {
+		suggestion, err := r.ES.SuggestQuery(query)
+		if err == nil {
+			return suggestion, nil
+		}
+		log.Printf("Elasticsearch suggest failed, falling back to SQL: %v", err)
+	}
+
+	rows, err := r.DB.Query(`SELECT name, COALESCE(author, '') FROM products WHERE status = 'active'`)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	defer rows.Close()
 
-	var categories []models.Category
+	words := make(map[string]int)
 	for rows.Next() {
-		var c models.Category
-		if err := rows.Scan(&c.ID, &c.Name, &c.Description); err != nil {
-			return nil, err
+		var name, author string
+		if err := rows.Scan(&name, &author); err != nil {
+			return "", err
+		}
+		for _, w := range append(splitWords(name), splitWords(author)...) {
+			words[w]++
 		}
-		categories = append(categories, c)
 	}
-	return categories, nil
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return suggestFromWords(query, words), nil
 }
 
-// --- Order Implementation ---
-
-type postgresOrderRepo struct {
-	DB *sql.DB
-}
+// SuggestCompletions returns up to limit each of titles, authors and
+// categories with a word starting with prefix, most popular first. Titles
+// and authors come from Elasticsearch's completion suggester when available.
+func (r *postgresProductRepo) SuggestCompletions(prefix string, limit int) (*models.Suggestions, error) {
+	var suggestions *models.Suggestions
+	if r.ES != nil {
+		var err error
+		if suggestions, err = r.ES.SuggestCompletions(prefix, limit); err != nil {
+			log.Printf("Elasticsearch completion failed, falling back to SQL: %v", err)
+			suggestions = nil
+		}
+	}
+	if suggestions == nil {
+		var err error
+		if suggestions, err = r.suggestCompletionsSQL(prefix, limit); err != nil {
+			return nil, err
+		}
+	}
 
-func (r *postgresOrderRepo) CreateOrder(sessionID string, userID int, items []models.CartItem) (int, error) {
-	tx, err := r.DB.Begin()
+	categories, err := r.ListCategories()
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	suggestions.Categories = []models.CategorySuggestion{}
+	for _, c := range categories {
+		if len(suggestions.Categories) < limit && hasWordPrefix(c.Name, prefix) {
+			suggestions.Categories = append(suggestions.Categories, models.CategorySuggestion{ID: c.ID, Name: c.Name})
+		}
 	}
+	return suggestions, nil
+}
 
-	var orderID int
-	var errCreate error
+// suggestCompletionsSQL finds titles and authors with a word starting with prefix
+func (r *postgresProductRepo) suggestCompletionsSQL(prefix string, limit int) (*models.Suggestions, error) {
+	// Match the start of the text or of any word in it
+	escaped := likeEscaper.Replace(prefix)
+	start, word := escaped+"%", "% "+escaped+"%"
 
-	// Calculate total amount first?
-	// For now, we insert order then items, then maybe update total?
-	// Or calculate total in SQL?
-	// Let's stick to basic insertion first, update total later or via trigger?
-	// The prompt asks to add `total_amount` column.
-	// Ideally we calculate it.
+	rows, err := r.DB.Query(`SELECT id, name, COALESCE(author, '') FROM products
+		WHERE status = 'active' AND (name ILIKE $1 OR name ILIKE $2)
+		ORDER BY popularity_score DESC NULLS LAST, name LIMIT $3`, start, word, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	// Let's just insert the order.
+	suggestions := &models.Suggestions{Titles: []models.TitleSuggestion{}, Authors: []string{}}
+	for rows.Next() {
+		var t models.TitleSuggestion
+		if err := rows.Scan(&t.ProductID, &t.Title, &t.Author); err != nil {
+			return nil, err
+		}
+		suggestions.Titles = append(suggestions.Titles, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	if userID > 0 {
-		errCreate = tx.QueryRow("INSERT INTO orders (session_id, user_id) VALUES ($1, $2) RETURNING id", sessionID, userID).Scan(&orderID)
-	} else {
-		errCreate = tx.QueryRow("INSERT INTO orders (session_id) VALUES ($1) RETURNING id", sessionID).Scan(&orderID)
+	authorRows, err := r.DB.Query(`SELECT author FROM products
+		WHERE status = 'active' AND (author ILIKE $1 OR author ILIKE $2)
+		GROUP BY author ORDER BY SUM(COALESCE(popularity_score, 0)) DESC, author LIMIT $3`, start, word, limit)
+	if err != nil {
+		return nil, err
 	}
+	defer authorRows.Close()
 
-	if errCreate != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			log.Printf("Error rolling back transaction: %v", rbErr)
+	for authorRows.Next() {
+		var author string
+		if err := authorRows.Scan(&author); err != nil {
+			return nil, err
 		}
-		return 0, errCreate
+		suggestions.Authors = append(suggestions.Authors, author)
 	}
+	return suggestions, authorRows.Err()
+}
 
-	// Insert items
-	if userID > 0 {
-		_, err = tx.Exec(`
-			INSERT INTO order_items (order_id, product_id, quantity, price)
-			SELECT $1, product_id, SUM(quantity), (SELECT price FROM products WHERE id = product_id)
-			FROM cart_items 
-			WHERE user_id = $2
-			GROUP BY product_id`, orderID, userID)
-	} else {
-		_, err = tx.Exec(`
-			INSERT INTO order_items (order_id, product_id, quantity, price)
-			SELECT $1, product_id, SUM(quantity), (SELECT price FROM products WHERE id = product_id)
-			FROM cart_items 
-			WHERE session_id = $2
-			GROUP BY product_id`, orderID, sessionID)
+// searchRules loads the synonym rewrites of query and, when results are
+// sorted by relevance, the products promoted for it
+func (r *postgresProductRepo) searchRules(query, sortBy string) (*searchRules, error) {
+	rules := &searchRules{query: query}
+	if query == "" {
+		return rules, nil
+	}
+	rules.terms = []string{query}
+	if r.skipRules {
+		return rules, nil
 	}
 
+	rulesRepo := &postgresSearchRulesRepo{DB: r.DB}
+	sets, err := rulesRepo.ListSynonymSets()
 	if err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			log.Printf("Error rolling back transaction: %v", rbErr)
-		}
-		return 0, err
+		return nil, fmt.Errorf("loading synonyms: %w", err)
+	}
+	rules.synonyms = true
+	rules.terms = expandSynonyms(query, sets)
+	if sortBy != "" && sortBy != "relevance" {
+		return rules, nil
 	}
 
-	// Update Order Total
-	_, err = tx.Exec(`
-		UPDATE orders 
-		SET total_amount = (SELECT SUM(price * quantity) FROM order_items WHERE order_id = $1)
-		WHERE id = $1`, orderID)
+	promotions, err := rulesRepo.promotionsFor(query)
 	if err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			log.Printf("Error rolling back transaction: %v", rbErr)
+		return nil, fmt.Errorf("loading promotions: %w", err)
+	}
+	for _, p := range promotions {
+		if p.Pinned {
+			rules.pinned = append(rules.pinned, p.ProductID)
+			continue
 		}
-		return 0, err
+		if rules.boosts == nil {
+			rules.boosts = make(map[int]float64)
+		}
+		rules.boosts[p.ProductID] = p.Boost
 	}
+	return rules, nil
+}
 
-	// Reduce Stock Quantities
-	// For each order item, reduce the corresponding product stock
-	_, err = tx.Exec(`
-		UPDATE products p
-		SET stock_quantity = stock_quantity - oi.quantity
-		FROM order_items oi
-		WHERE p.id = oi.product_id AND oi.order_id = $1`, orderID)
+// searchElasticsearch runs one page of a search in Elasticsearch and loads
+// the products from Postgres in result order. It reports false when the
+// caller should fall back to SQL: Elasticsearch is unavailable or failed,
+// or the page lies beyond the deepest result it will return.
+func (r *postgresProductRepo) searchElasticsearch(ctx context.Context, rules *searchRules, filters models.SearchFilters, page, pageSize int, sortBy string, withFacets bool) ([]models.Product, *searchPage, bool) {
+	if r.ES == nil || page*pageSize > MaxResultWindow {
+		return nil, nil, false
+	}
+	result, err := r.ES.searchProducts(ctx, rules, filters, (page-1)*pageSize, pageSize, sortBy, withFacets)
 	if err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			log.Printf("Error rolling back transaction: %v", rbErr)
-		}
+		log.Printf("Elasticsearch search failed, falling back to SQL: %v", err)
+		return nil, nil, false
+	}
+	products, err := r.getProductsByIDs(result.ids)
+	if err != nil {
+		log.Printf("Error fetching products by IDs, falling back to SQL: %v", err)
+		return nil, nil, false
+	}
+	return products, result, true
+}
+
+// productSearchFrom joins each product to its average review rating
+const productSearchFrom = `products LEFT JOIN (
+		SELECT product_id, AVG(rating)::float8 AS average_rating FROM reviews GROUP BY product_id
+	) pr ON pr.product_id = products.id`
+
+// productSearchWhere builds the WHERE clause for a faceted search, leaving
+// out the facet named skip. Products match if they match the query or any
+// of its synonym rewrites, or are pinned for it. A term matches the
+// full-text search_vector, a title or author word within a typo of one of
+// its words, or a substring of the title, author or description.
+//
+// Each term's arguments come first, the term then its LIKE pattern, so
+// productSearchRank can refer to the terms by position.
+func productSearchWhere(rules *searchRules, filters models.SearchFilters, skip string) (string, []interface{}) {
+	conds := []string{"status = 'active'"}
+	var args []interface{}
+
+	if len(rules.terms) > 0 {
+		var alts []string
+		for _, term := range rules.terms {
+			args = append(args, term, "%"+likeEscaper.Replace(term)+"%")
+			t, like := len(args)-1, len(args)
+			alts = append(alts, fmt.Sprintf("search_vector @@ websearch_to_tsquery('english', $%d) OR $%d <%% name OR $%d <%% author"+
+				" OR name ILIKE $%d OR description ILIKE $%d OR author ILIKE $%d", t, t, t, like, like, like))
+		}
+		if len(rules.pinned) > 0 {
+			args = append(args, pq.Array(rules.pinned))
+			alts = append(alts, fmt.Sprintf("id = ANY($%d)", len(args)))
+		}
+		conds = append(conds, "("+strings.Join(alts, " OR ")+")")
+	}
+	if len(filters.CategoryIDs) > 0 && skip != facetCategory {
+		args = append(args, pq.Array(filters.CategoryIDs))
+		conds = append(conds, fmt.Sprintf("category_id = ANY($%d)", len(args)))
+	}
+	if len(filters.Authors) > 0 && skip != facetAuthor {
+		args = append(args, pq.Array(filters.Authors))
+		conds = append(conds, fmt.Sprintf("author = ANY($%d)", len(args)))
+	}
+	if ranges := models.SelectedRanges(models.PriceRanges, filters.PriceRanges); len(ranges) > 0 && skip != facetPrice {
+		conds = append(conds, rangesCondition("price", ranges))
+	}
+	if ranges := models.SelectedRanges(models.RatingRanges, filters.RatingRanges); len(ranges) > 0 && skip != facetRating {
+		conds = append(conds, rangesCondition("average_rating", ranges))
+	}
+	if filters.InStock && skip != facetInStock {
+		conds = append(conds, "stock_quantity > 0")
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// productSearchRank is the relevance of a product to the best matching of
+// the rules' terms: its full-text rank, weighted title over author over
+// description and scaled to below 1, plus how closely its title and author
+// resemble the term so typo and substring matches rank too
+func productSearchRank(rules *searchRules) string {
+	ranks := make([]string, len(rules.terms))
+	for i := range rules.terms {
+		t := 2*i + 1
+		ranks[i] = fmt.Sprintf("ts_rank(search_vector, websearch_to_tsquery('english', $%d), 32)"+
+			" + word_similarity($%d, name) / 2 + word_similarity($%d, COALESCE(author, '')) / 4", t, t, t)
+	}
+	return "GREATEST(" + strings.Join(ranks, ", ") + ")"
+}
+
+// productSearchOrder returns the ORDER BY clause of a SQL search: promoted
+// products first, then the best matches when sorting by relevance, then
+// sortBy's order
+func productSearchOrder(rules *searchRules, sortBy string) string {
+	order := getOrderClause(sortBy)
+	if len(rules.terms) > 0 && (sortBy == "" || sortBy == "relevance") {
+		order = productSearchRank(rules) + " DESC, " + order
+	}
+	if rules.promotes() {
+		order = promotedOrder(rules) + ", " + order
+	}
+	return order
+}
+
+// rangesCondition matches column in any of ranges. The bounds are our own
+// constants, so they are inlined rather than passed as arguments.
+func rangesCondition(column string, ranges []models.FacetRange) string {
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		parts = append(parts, rangeCondition(column, r))
+	}
+	return "(" + strings.Join(parts, " OR ") + ")"
+}
+
+func rangeCondition(column string, r models.FacetRange) string {
+	cond := fmt.Sprintf("%s >= %g", column, r.Min)
+	if r.Max > 0 {
+		cond += fmt.Sprintf(" AND %s < %g", column, r.Max)
+	}
+	return "(" + cond + ")"
+}
+
+// facetCountsSQL counts the matches for each facet option, applying every
+// filter but the facet's own
+func (r *postgresProductRepo) facetCountsSQL(rules *searchRules, filters models.SearchFilters) (*facetCounts, error) {
+	counts := &facetCounts{
+		categories: make(map[int]int),
+		prices:     make(map[string]int),
+		ratings:    make(map[string]int),
+	}
+
+	where, args := productSearchWhere(rules, filters, facetCategory)
+	rows, err := r.DB.Query("SELECT category_id, COUNT(*) FROM "+productSearchFrom+" WHERE "+where+
+		" AND category_id IS NOT NULL GROUP BY category_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, n int
+		if err := rows.Scan(&id, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		counts.categories[id] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	where, args = productSearchWhere(rules, filters, facetAuthor)
+	rows, err = r.DB.Query(fmt.Sprintf("SELECT author, COUNT(*) FROM %s WHERE %s AND author IS NOT NULL AND author <> ''"+
+		" GROUP BY author ORDER BY COUNT(*) DESC, author LIMIT %d", productSearchFrom, where, authorFacetSize), args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var a authorCount
+		if err := rows.Scan(&a.name, &a.count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		counts.authors = append(counts.authors, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.rangeCountsSQL(rules, filters, facetPrice, "price", models.PriceRanges, counts.prices); err != nil {
+		return nil, err
+	}
+	if err := r.rangeCountsSQL(rules, filters, facetRating, "average_rating", models.RatingRanges, counts.ratings); err != nil {
+		return nil, err
+	}
+
+	where, args = productSearchWhere(rules, filters, facetInStock)
+	if err := r.DB.QueryRow("SELECT COUNT(*) FROM "+productSearchFrom+" WHERE "+where+" AND stock_quantity > 0", args...).Scan(&counts.inStock); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// rangeCountsSQL counts the matches in each of ranges in a single query
+func (r *postgresProductRepo) rangeCountsSQL(rules *searchRules, filters models.SearchFilters, facet, column string, ranges []models.FacetRange, into map[string]int) error {
+	where, args := productSearchWhere(rules, filters, facet)
+	selects := make([]string, len(ranges))
+	for i, rg := range ranges {
+		selects[i] = fmt.Sprintf("COUNT(*) FILTER (WHERE %s)", rangeCondition(column, rg))
+	}
+	values := make([]int, len(ranges))
+	dest := make([]interface{}, len(ranges))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := r.DB.QueryRow("SELECT "+strings.Join(selects, ", ")+" FROM "+productSearchFrom+" WHERE "+where, args...).Scan(dest...); err != nil {
+		return err
+	}
+	for i, rg := range ranges {
+		into[rg.Key] = values[i]
+	}
+	return nil
+}
+
+// GetProductsByIDs fetches active products by IDs in the order given
+func (r *postgresProductRepo) GetProductsByIDs(ids []int) ([]models.Product, error) {
+	return r.getProductsByIDs(ids)
+}
+
+// getProductsByIDs fetches products by IDs and maintains the order
+func (r *postgresProductRepo) getProductsByIDs(ids []int) ([]models.Product, error) {
+	if len(ids) == 0 {
+		return []models.Product{}, nil
+	}
+
+	// Create a map to store products by ID
+	productMap := make(map[int]models.Product)
+
+	// Build query with IN clause
+	q := `SELECT id, name, description, price, sku, stock_quantity, image_url, category_id, status, author, COALESCE(popularity_score, 0) 
+	      FROM products WHERE id = ANY($1) AND status = 'active'`
+
+	rows, err := r.DB.Query(q, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Fetch all products into the map
+	for rows.Next() {
+		var p models.Product
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Price, &p.SKU, &p.StockQuantity, &p.ImageURL, &p.CategoryID, &p.Status, &p.Author, &p.PopularityScore); err != nil {
+			return nil, err
+		}
+		productMap[p.ID] = p
+	}
+
+	// Build result slice in the order of input IDs (Elasticsearch relevance order)
+	products := make([]models.Product, 0, len(ids))
+	for _, id := range ids {
+		if p, exists := productMap[id]; exists {
+			products = append(products, p)
+		}
+	}
+
+	return products, nil
+}
+
+func (r *postgresProductRepo) ListCategories() ([]models.Category, error) {
+	query := `SELECT id, name, description FROM categories ORDER BY name`
+	rows, err := r.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		var c models.Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, nil
+}
+
+// --- Order Implementation ---
+
+type postgresOrderRepo struct {
+	DB *sql.DB
+}
+
+func (r *postgresOrderRepo) CreateOrder(sessionID string, userID int, items []models.CartItem) (int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var orderID int
+	var errCreate error
+
+	// Calculate total amount first?
+	// For now, we insert order then items, then maybe update total?
+	// Or calculate total in SQL?
+	// Let's stick to basic insertion first, update total later or via trigger?
+	// The prompt asks to add `total_amount` column.
+	// Ideally we calculate it.
+
+	// Let's just insert the order.
+
+	if userID > 0 {
+		errCreate = tx.QueryRow("INSERT INTO orders (session_id, user_id) VALUES ($1, $2) RETURNING id", sessionID, userID).Scan(&orderID)
+	} else {
+		errCreate = tx.QueryRow("INSERT INTO orders (session_id) VALUES ($1) RETURNING id", sessionID).Scan(&orderID)
+	}
+
+	if errCreate != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Printf("Error rolling back transaction: %v", rbErr)
+		}
+		return 0, errCreate
+	}
+
+	// Insert items
+	if userID > 0 {
+		_, err = tx.Exec(`
+			INSERT INTO order_items (order_id, product_id, quantity, price)
+			SELECT $1, product_id, SUM(quantity), (SELECT price FROM products WHERE id = product_id)
+			FROM cart_items 
+			WHERE user_id = $2
+			GROUP BY product_id`, orderID, userID)
+	} else {
+		_, err = tx.Exec(`
+			INSERT INTO order_items (order_id, product_id, quantity, price)
+			SELECT $1, product_id, SUM(quantity), (SELECT price FROM products WHERE id = product_id)
+			FROM cart_items 
+			WHERE session_id = $2
+			GROUP BY product_id`, orderID, sessionID)
+	}
+
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Printf("Error rolling back transaction: %v", rbErr)
+		}
+		return 0, err
+	}
+
+	// Update Order Total
+	_, err = tx.Exec(`
+		UPDATE orders 
+		SET total_amount = (SELECT SUM(price * quantity) FROM order_items WHERE order_id = $1)
+		WHERE id = $1`, orderID)
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Printf("Error rolling back transaction: %v", rbErr)
+		}
+		return 0, err
+	}
+
+	// Reduce Stock Quantities
+	// For each order item, reduce the corresponding product stock
+	_, err = tx.Exec(`
+		UPDATE products p
+		SET stock_quantity = stock_quantity - oi.quantity
+		FROM order_items oi
+		WHERE p.id = oi.product_id AND oi.order_id = $1`, orderID)
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Printf("Error rolling back transaction: %v", rbErr)
+		}
 		return 0, err
 	}
 
@@ -476,6 +1042,21 @@ func (r *postgresOrderRepo) CreateOrder(sessionID string, userID int, items []mo
 		return 0, err
 	}
 
+	// Record domain events in the same transaction so they are published
+	// if and only if the order commits
+	if err := writeOutboxEvent(tx, "order", orderID, models.EventOrderCreated, models.OrderEvent{OrderID: orderID, UserID: userID}); err != nil {
+		rollback(tx)
+		return 0, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO outbox_events (aggregate_type, aggregate_id, event_type, payload)
+		SELECT 'product', product_id, $2, json_build_object('product_id', product_id, 'order_id', $1::int)
+		FROM order_items WHERE order_id = $1`, orderID, models.EventProductStockChanged)
+	if err != nil {
+		rollback(tx)
+		return 0, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return 0, err
 	}
@@ -484,12 +1065,42 @@ func (r *postgresOrderRepo) CreateOrder(sessionID string, userID int, items []mo
 }
 
 func (r *postgresOrderRepo) GetOrderByID(id int) (*models.Order, error) {
-	// Placeholder
-	return nil, nil
+	var o models.Order
+	err := r.DB.QueryRow("SELECT id, session_id, user_id, total_amount, status, created_at FROM orders WHERE id = $1", id).
+		Scan(&o.ID, &o.SessionID, &o.UserID, &o.TotalAmount, &o.Status, &o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.Query(`
+		SELECT oi.id, oi.order_id, oi.product_id, oi.quantity, oi.price,
+		       p.id, p.name, p.description, p.price, p.sku, p.image_url
+		FROM order_items oi
+		JOIN products p ON oi.product_id = p.id
+		WHERE oi.order_id = $1
+		ORDER BY p.name`, o.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.OrderItem
+		var prod models.Product
+		if err := rows.Scan(
+			&item.ID, &item.OrderID, &item.ProductID, &item.Quantity, &item.Price,
+			&prod.ID, &prod.Name, &prod.Description, &prod.Price, &prod.SKU, &prod.ImageURL,
+		); err != nil {
+			return nil, err
+		}
+		item.Product = prod
+		o.Items = append(o.Items, item)
+	}
+	return &o, rows.Err()
 }
 
 func (r *postgresOrderRepo) GetOrdersByUserID(userID int) ([]models.Order, error) {
-	rows, err := r.DB.Query("SELECT id, session_id, user_id, total_amount, status, created_at FROM orders WHERE user_id = $1 ORDER BY created_at DESC", userID)
+	rows, err := r.DB.Query("SELECT id, session_id, user_id, total_amount, status, shipping_info, created_at FROM orders WHERE user_id = $1 ORDER BY created_at DESC", userID)
 	if err != nil {
 		return nil, err
 	}
@@ -499,7 +1110,7 @@ func (r *postgresOrderRepo) GetOrdersByUserID(userID int) ([]models.Order, error
 	for rows.Next() {
 		var o models.Order
 		// handle nullable fields
-		if err := rows.Scan(&o.ID, &o.SessionID, &o.UserID, &o.TotalAmount, &o.Status, &o.CreatedAt); err != nil {
+		if err := rows.Scan(&o.ID, &o.SessionID, &o.UserID, &o.TotalAmount, &o.Status, &o.ShippingInfo, &o.CreatedAt); err != nil {
 			return nil, err
 		}
 
@@ -537,6 +1148,37 @@ func (r *postgresOrderRepo) GetOrdersByUserID(userID int) ([]models.Order, error
 	return orders, nil
 }
 
+// CancelOrder marks a pending order as cancelled. Cancelled orders no longer
+// count towards a user's purchases.
+func (r *postgresOrderRepo) CancelOrder(orderID, userID int) (bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	result, err := tx.Exec("UPDATE orders SET status = 'cancelled' WHERE id = $1 AND user_id = $2 AND status = 'pending'", orderID, userID)
+	if err != nil {
+		rollback(tx)
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		rollback(tx)
+		return false, err
+	}
+	if n == 0 {
+		rollback(tx)
+		return false, nil
+	}
+
+	if err := writeOutboxEvent(tx, "order", orderID, models.EventOrderCancelled, models.OrderEvent{OrderID: orderID, UserID: userID}); err != nil {
+		rollback(tx)
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
 // GetUserPurchases returns all unique books a user has purchased (for Reader app integration)
 func (r *postgresOrderRepo) GetUserPurchases(userID int) ([]models.PurchasedBook, error) {
 	// Get distinct products purchased by user, with earliest purchase date
@@ -547,7 +1189,7 @@ func (r *postgresOrderRepo) GetUserPurchases(userID int) ([]models.PurchasedBook
 		FROM orders o
 		JOIN order_items oi ON o.id = oi.order_id
 		JOIN products p ON oi.product_id = p.id
-		WHERE o.user_id = $1 AND p.sku IS NOT NULL
+		WHERE o.user_id = $1 AND p.sku IS NOT NULL AND o.status != 'cancelled'
 		GROUP BY p.sku, p.name, p.author, p.image_url
 		ORDER BY p.sku, purchased_at ASC`
 
@@ -594,7 +1236,7 @@ func (r *postgresOrderRepo) VerifyPurchase(userID int, sku string) (bool, error)
 			SELECT 1 FROM orders o
 			JOIN order_items oi ON o.id = oi.order_id
 			JOIN products p ON oi.product_id = p.id
-			WHERE o.user_id = $1 AND p.sku = $2
+			WHERE o.user_id = $1 AND p.sku = $2 AND o.status != 'cancelled'
 		)`
 
 	err := r.DB.QueryRow(query, userID, sku).Scan(&exists)
@@ -879,8 +1521,8 @@ func (r *postgresUserRepo) CreateUser(email, passwordHash, fullName string) (int
 
 func (r *postgresUserRepo) GetUserByEmail(email string) (*models.User, error) {
 	var u models.User
-	err := r.DB.QueryRow("SELECT id, email, password_hash, full_name, role FROM users WHERE email = $1", email).
-		Scan(&u.ID, &u.Email, &u.PasswordHash, &u.FullName, &u.Role)
+	err := r.DB.QueryRow("SELECT id, email, password_hash, full_name, role, email_verified_at, totp_enabled_at IS NOT NULL FROM users WHERE email = $1", email).
+		Scan(&u.ID, &u.Email, &u.PasswordHash, &u.FullName, &u.Role, &u.EmailVerifiedAt, &u.TwoFactorEnabled)
 	if err != nil {
 		return nil, err
 	}
@@ -889,8 +1531,8 @@ func (r *postgresUserRepo) GetUserByEmail(email string) (*models.User, error) {
 
 func (r *postgresUserRepo) GetUserByID(id int) (*models.User, error) {
 	var u models.User
-	err := r.DB.QueryRow("SELECT id, email, password_hash, full_name, role, created_at FROM users WHERE id = $1", id).
-		Scan(&u.ID, &u.Email, &u.PasswordHash, &u.FullName, &u.Role, &u.CreatedAt)
+	err := r.DB.QueryRow("SELECT id, email, password_hash, full_name, role, email_verified_at, totp_enabled_at IS NOT NULL, created_at FROM users WHERE id = $1", id).
+		Scan(&u.ID, &u.Email, &u.PasswordHash, &u.FullName, &u.Role, &u.EmailVerifiedAt, &u.TwoFactorEnabled, &u.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -909,21 +1551,113 @@ func (r *postgresUserRepo) UpdateUserPassword(userID int, passwordHash string) e
 	return err
 }
 
-// --- Review Implementation ---
+// DeleteAccount removes the user in one transaction. Their reviews are
+// announced as deleted before the cascade removes them, so ratings and
+// search stay in step, and email addresses are scrubbed from their audit
+// entries, which are kept without the user.
+func (r *postgresUserRepo) DeleteAccount(userID int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id, product_id FROM reviews WHERE user_id = $1", userID)
+	if err != nil {
+		rollback(tx)
+		return err
+	}
+	var reviews []models.ReviewEvent
+	for rows.Next() {
+		event := models.ReviewEvent{UserID: userID}
+		if err := rows.Scan(&event.ReviewID, &event.ProductID); err != nil {
+			rows.Close()
+			rollback(tx)
+			return err
+		}
+		reviews = append(reviews, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		rollback(tx)
+		return err
+	}
+	for _, event := range reviews {
+		if err := writeOutboxEvent(tx, "review", event.ReviewID, models.EventReviewDeleted, event); err != nil {
+			rollback(tx)
+			return err
+		}
+	}
+
+	// Orders stay for the accounts, detached from the user and without
+	// shipping details
+	if _, err := tx.Exec(`
+		UPDATE orders SET user_id = NULL, shipping_info = NULL, anonymized_at = NOW()
+		WHERE user_id = $1`, userID); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE audit_log SET details = details - 'email' - 'old_email' - 'new_email'
+		WHERE user_id = $1`, userID); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	// Reviews, cart, tokens, credentials, linked identities and sessions
+	// are removed by ON DELETE CASCADE
+	res, err := tx.Exec("DELETE FROM users WHERE id = $1", userID)
+	if err != nil {
+		rollback(tx)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		rollback(tx)
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// --- Review Implementation ---
 
 type postgresReviewRepo struct {
 	DB *sql.DB
 }
 
 func (r *postgresReviewRepo) CreateReview(productID, userID, rating int, title, comment string) error {
+	// xmax = 0 only for freshly inserted rows, which tells a new review apart
+	// from an upsert of an existing one
 	query := `
 		INSERT INTO reviews (product_id, user_id, rating, title, comment, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
 		ON CONFLICT (product_id, user_id) 
-		DO UPDATE SET rating = $3, title = $4, comment = $5, updated_at = NOW()`
+		DO UPDATE SET rating = $3, title = $4, comment = $5, updated_at = NOW()
+		RETURNING id, (xmax = 0)`
 
-	_, err := r.DB.Exec(query, productID, userID, rating, title, comment)
-	return err
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	var reviewID int
+	var inserted bool
+	if err := tx.QueryRow(query, productID, userID, rating, title, comment).Scan(&reviewID, &inserted); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	eventType := models.EventReviewUpdated
+	if inserted {
+		eventType = models.EventReviewCreated
+	}
+	event := models.ReviewEvent{ReviewID: reviewID, ProductID: productID, UserID: userID}
+	if err := writeOutboxEvent(tx, "review", reviewID, eventType, event); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *postgresReviewRepo) GetReviewsByProductID(productID int) ([]models.ReviewWithUser, error) {
@@ -989,34 +1723,88 @@ func (r *postgresReviewRepo) GetReviewByUserAndProduct(userID, productID int) (*
 	return &review, nil
 }
 
+func (r *postgresReviewRepo) GetReviewsByUserID(userID int) ([]models.Review, error) {
+	rows, err := r.DB.Query(`
+		SELECT id, product_id, user_id, rating, COALESCE(title, ''), COALESCE(comment, ''), created_at, updated_at
+		FROM reviews
+		WHERE user_id = $1
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []models.Review
+	for rows.Next() {
+		var review models.Review
+		if err := rows.Scan(
+			&review.ID, &review.ProductID, &review.UserID, &review.Rating,
+			&review.Title, &review.Comment, &review.CreatedAt, &review.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
+
 func (r *postgresReviewRepo) UpdateReview(reviewID, rating int, title, comment string) error {
 	query := `
 		UPDATE reviews 
 		SET rating = $1, title = $2, comment = $3, updated_at = NOW()
-		WHERE id = $4`
+		WHERE id = $4
+		RETURNING product_id, user_id`
 
-	_, err := r.DB.Exec(query, rating, title, comment, reviewID)
-	return err
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	event := models.ReviewEvent{ReviewID: reviewID}
+	err = tx.QueryRow(query, rating, title, comment, reviewID).Scan(&event.ProductID, &event.UserID)
+	if err == sql.ErrNoRows {
+		rollback(tx)
+		return nil
+	}
+	if err != nil {
+		rollback(tx)
+		return err
+	}
+
+	if err := writeOutboxEvent(tx, "review", reviewID, models.EventReviewUpdated, event); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *postgresReviewRepo) DeleteReview(reviewID, userID int) error {
 	// Ensure user can only delete their own review
-	query := `DELETE FROM reviews WHERE id = $1 AND user_id = $2`
-	result, err := r.DB.Exec(query, reviewID, userID)
+	query := `DELETE FROM reviews WHERE id = $1 AND user_id = $2 RETURNING product_id`
+
+	tx, err := r.DB.Begin()
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	event := models.ReviewEvent{ReviewID: reviewID, UserID: userID}
+	err = tx.QueryRow(query, reviewID, userID).Scan(&event.ProductID)
+	if err == sql.ErrNoRows {
+		rollback(tx)
+		return fmt.Errorf("review not found or unauthorized")
+	}
 	if err != nil {
+		rollback(tx)
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("review not found or unauthorized")
+	if err := writeOutboxEvent(tx, "review", reviewID, models.EventReviewDeleted, event); err != nil {
+		rollback(tx)
+		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 func (r *postgresReviewRepo) GetProductRating(productID int) (*models.ProductRating, error) {
@@ -1060,3 +1848,1007 @@ func (r *postgresReviewRepo) GetProductRating(productID int) (*models.ProductRat
 
 	return rating, nil
 }
+
+// GetReviewsByProductIDs returns reviews for several products in one query,
+// keyed by product ID and newest first within each product
+func (r *postgresReviewRepo) GetReviewsByProductIDs(productIDs []int) (map[int][]models.ReviewWithUser, error) {
+	reviews := make(map[int][]models.ReviewWithUser, len(productIDs))
+	if len(productIDs) == 0 {
+		return reviews, nil
+	}
+
+	query := `
+		SELECT r.id, r.product_id, r.user_id, r.rating, r.title, r.comment,
+		       r.created_at, r.updated_at, u.full_name, u.email
+		FROM reviews r
+		JOIN users u ON r.user_id = u.id
+		WHERE r.product_id = ANY($1)
+		ORDER BY r.product_id, r.created_at DESC`
+
+	rows, err := r.DB.Query(query, pq.Array(productIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rw models.ReviewWithUser
+		var fullName sql.NullString
+		var email string
+		err := rows.Scan(
+			&rw.ID, &rw.ProductID, &rw.UserID, &rw.Rating, &rw.Title, &rw.Comment,
+			&rw.CreatedAt, &rw.UpdatedAt, &fullName, &email,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rw.UserName = models.FormatDisplayName(fullName.String, email)
+		reviews[rw.ProductID] = append(reviews[rw.ProductID], rw)
+	}
+
+	return reviews, rows.Err()
+}
+
+// GetProductRatings returns rating statistics for several products in one query.
+// Every requested product gets an entry, with zero counts if it has no reviews.
+func (r *postgresReviewRepo) GetProductRatings(productIDs []int) (map[int]*models.ProductRating, error) {
+	ratings := make(map[int]*models.ProductRating, len(productIDs))
+	for _, id := range productIDs {
+		ratings[id] = &models.ProductRating{ProductID: id, RatingCounts: make(map[int]int)}
+	}
+	if len(productIDs) == 0 {
+		return ratings, nil
+	}
+
+	query := `
+		SELECT product_id, rating, COUNT(*)
+		FROM reviews
+		WHERE product_id = ANY($1)
+		GROUP BY product_id, rating`
+
+	rows, err := r.DB.Query(query, pq.Array(productIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sums := make(map[int]int)
+	for rows.Next() {
+		var productID, star, count int
+		if err := rows.Scan(&productID, &star, &count); err != nil {
+			return nil, err
+		}
+		rating := ratings[productID]
+		rating.RatingCounts[star] = count
+		rating.TotalReviews += count
+		sums[productID] += star * count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for id, rating := range ratings {
+		if rating.TotalReviews > 0 {
+			rating.AverageRating = float64(sums[id]) / float64(rating.TotalReviews)
+		}
+	}
+
+	return ratings, nil
+}
+
+// --- Webhook Implementation ---
+
+type postgresWebhookRepo struct {
+	DB *sql.DB
+}
+
+func (r *postgresWebhookRepo) ListSubscribers() ([]models.WebhookSubscriber, error) {
+	rows, err := r.DB.Query("SELECT id, url, secret, events, active, created_at FROM webhook_subscribers ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscribers []models.WebhookSubscriber
+	for rows.Next() {
+		var s models.WebhookSubscriber
+		if err := rows.Scan(&s.ID, &s.URL, &s.Secret, pq.Array(&s.Events), &s.Active, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, s)
+	}
+	return subscribers, rows.Err()
+}
+
+func (r *postgresWebhookRepo) CreateSubscriber(url, secret string, events []string) (int, error) {
+	if events == nil {
+		events = []string{}
+	}
+	var id int
+	err := r.DB.QueryRow("INSERT INTO webhook_subscribers (url, secret, events) VALUES ($1, $2, $3) RETURNING id",
+		url, secret, pq.Array(events)).Scan(&id)
+	return id, err
+}
+
+func (r *postgresWebhookRepo) SetSubscriberActive(id int, active bool) error {
+	_, err := r.DB.Exec("UPDATE webhook_subscribers SET active = $1 WHERE id = $2", active, id)
+	return err
+}
+
+func (r *postgresWebhookRepo) DeleteSubscriber(id int) error {
+	_, err := r.DB.Exec("DELETE FROM webhook_subscribers WHERE id = $1", id)
+	return err
+}
+
+func (r *postgresWebhookRepo) EnqueueEvent(eventID, eventType string, payload []byte) (int, error) {
+	result, err := r.DB.Exec(`
+		INSERT INTO webhook_deliveries (subscriber_id, event_id, event_type, payload)
+		SELECT id, $1, $2, $3 FROM webhook_subscribers
+		WHERE active AND (cardinality(events) = 0 OR $2 = ANY(events))
+		ON CONFLICT (subscriber_id, event_id) DO NOTHING`,
+		eventID, eventType, string(payload))
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (r *postgresWebhookRepo) ClaimDueDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	// Push next_attempt_at past the lease so a replica that crashes mid-delivery
+	// leaves the row to be retried, and concurrent replicas skip locked rows
+	rows, err := r.DB.Query(`
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		FROM webhook_subscribers s
+		WHERE s.id = d.subscriber_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.subscriber_id, s.url, s.secret, d.event_id, d.event_type, d.payload,
+		          d.status, d.attempts, d.next_attempt_at, d.created_at`,
+		limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.SubscriberID, &d.URL, &d.Secret, &d.EventID, &d.EventType, &d.Payload,
+			&d.Status, &d.Attempts, &d.NextAttemptAt, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *postgresWebhookRepo) RecordDeliveryAttempt(d *models.WebhookDelivery) error {
+	_, err := r.DB.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, response_status = $3, last_error = $4,
+		    next_attempt_at = $5, delivered_at = $6
+		WHERE id = $7`,
+		d.Status, d.Attempts, d.ResponseStatus, d.LastError, d.NextAttemptAt, d.DeliveredAt, d.ID)
+	return err
+}
+
+func (r *postgresWebhookRepo) ListDeliveries(limit int) ([]models.WebhookDelivery, error) {
+	rows, err := r.DB.Query(`
+		SELECT d.id, d.subscriber_id, s.url, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+		       d.response_status, d.last_error, d.next_attempt_at, d.created_at, d.delivered_at
+		FROM webhook_deliveries d
+		JOIN webhook_subscribers s ON s.id = d.subscriber_id
+		ORDER BY d.created_at DESC, d.id DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.SubscriberID, &d.URL, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.ResponseStatus, &d.LastError, &d.NextAttemptAt, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *postgresWebhookRepo) RetryDelivery(id int) error {
+	_, err := r.DB.Exec("UPDATE webhook_deliveries SET status = 'pending', next_attempt_at = NOW() WHERE id = $1", id)
+	return err
+}
+
+// --- Outbox Implementation ---
+
+// rollback aborts tx, logging any failure to do so
+func rollback(tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil {
+		log.Printf("Error rolling back transaction: %v", err)
+	}
+}
+
+// writeOutboxEvent records a domain event inside tx
+func writeOutboxEvent(tx *sql.Tx, aggregateType string, aggregateID int, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding %s event: %w", eventType, err)
+	}
+	_, err = tx.Exec("INSERT INTO outbox_events (aggregate_type, aggregate_id, event_type, payload) VALUES ($1, $2, $3, $4)",
+		aggregateType, aggregateID, eventType, string(data))
+	return err
+}
+
+type postgresOutboxRepo struct {
+	DB *sql.DB
+}
+
+func (r *postgresOutboxRepo) ClaimOutboxEvents(limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	// Leasing via next_attempt_at lets replicas share the outbox; an event
+	// whose dispatcher dies mid-publish becomes due again when the lease ends
+	rows, err := r.DB.Query(`
+		UPDATE outbox_events
+		SET next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE published_at IS NULL AND next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, aggregate_type, aggregate_id, event_type, payload, attempts, published_sinks, created_at`,
+		limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		var e models.OutboxEvent
+		if err := rows.Scan(&e.ID, &e.AggregateType, &e.AggregateID, &e.EventType, &e.Payload, &e.Attempts, pq.Array(&e.SinksDone), &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING order is unspecified; publish oldest first
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (r *postgresOutboxRepo) MarkOutboxSinkPublished(id int64, sink string) error {
+	_, err := r.DB.Exec(`
+		UPDATE outbox_events SET published_sinks = array_append(published_sinks, $1)
+		WHERE id = $2 AND NOT $1 = ANY(published_sinks)`, sink, id)
+	return err
+}
+
+func (r *postgresOutboxRepo) MarkOutboxPublished(id int64) error {
+	_, err := r.DB.Exec("UPDATE outbox_events SET published_at = NOW(), attempts = attempts + 1, last_error = NULL WHERE id = $1", id)
+	return err
+}
+
+func (r *postgresOutboxRepo) MarkOutboxFailed(id int64, errMsg string, retryAt time.Time) error {
+	_, err := r.DB.Exec("UPDATE outbox_events SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2 WHERE id = $3", errMsg, retryAt, id)
+	return err
+}
+
+// --- Audit Implementation ---
+
+type postgresAuditRepo struct {
+	DB *sql.DB
+}
+
+func (r *postgresAuditRepo) Record(entry models.AuditEntry) error {
+	details := entry.Details
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Exec("INSERT INTO audit_log (user_id, event, ip, details) VALUES ($1, $2, NULLIF($3, ''), $4)",
+		entry.UserID, entry.Event, entry.IP, string(data))
+	return err
+}
+
+// --- Password Reset Implementation ---
+
+type postgresPasswordResetRepo struct {
+	DB *sql.DB
+}
+
+func (r *postgresPasswordResetRepo) CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := r.DB.Exec("INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		userID, tokenHash, expiresAt)
+	return err
+}
+
+func (r *postgresPasswordResetRepo) GetPasswordResetUser(tokenHash string) (int, bool, error) {
+	var userID int
+	err := r.DB.QueryRow(`
+		SELECT user_id FROM password_reset_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()`, tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return userID, true, nil
+}
+
+func (r *postgresPasswordResetRepo) ResetPassword(tokenHash, passwordHash string) (int, bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+
+	// Marking the token used in the same statement that checks it makes
+	// concurrent redemptions of one token race safely
+	var userID int
+	err = tx.QueryRow(`
+		UPDATE password_reset_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id`, tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		rollback(tx)
+		return 0, false, nil
+	}
+	if err != nil {
+		rollback(tx)
+		return 0, false, err
+	}
+
+	if _, err := tx.Exec("UPDATE users SET password_hash = $1 WHERE id = $2", passwordHash, userID); err != nil {
+		rollback(tx)
+		return 0, false, err
+	}
+	if _, err := tx.Exec("UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL", userID); err != nil {
+		rollback(tx)
+		return 0, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, err
+	}
+	return userID, true, nil
+}
+
+// --- Email Verification Implementation ---
+
+type postgresEmailVerificationRepo struct {
+	DB *sql.DB
+}
+
+func (r *postgresEmailVerificationRepo) CreateEmailVerification(userID int, email, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Only the most recent link works, so a superseded email change cannot
+	// be confirmed later
+	if _, err := tx.Exec("UPDATE email_verification_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL", userID); err != nil {
+		rollback(tx)
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO email_verification_tokens (user_id, email, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		userID, email, tokenHash, expiresAt); err != nil {
+		rollback(tx)
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *postgresEmailVerificationRepo) VerifyEmail(tokenHash string) (int, string, string, bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, "", "", false, err
+	}
+
+	var userID int
+	var email string
+	err = tx.QueryRow(`
+		UPDATE email_verification_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id, email`, tokenHash).Scan(&userID, &email)
+	if err == sql.ErrNoRows {
+		rollback(tx)
+		return 0, "", "", false, nil
+	}
+	if err != nil {
+		rollback(tx)
+		return 0, "", "", false, err
+	}
+
+	// Read the address being replaced in the same transaction so the
+	// change can be reported to it
+	var oldEmail string
+	if err := tx.QueryRow("SELECT email FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&oldEmail); err != nil {
+		rollback(tx)
+		return 0, "", "", false, err
+	}
+
+	if _, err := tx.Exec("UPDATE users SET email = $1, email_verified_at = NOW() WHERE id = $2", email, userID); err != nil {
+		rollback(tx)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return 0, "", "", false, ErrEmailTaken
+		}
+		return 0, "", "", false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", "", false, err
+	}
+	return userID, oldEmail, email, true, nil
+}
+
+func (r *postgresEmailVerificationRepo) PendingEmail(userID int) (string, error) {
+	var email string
+	err := r.DB.QueryRow(`
+		SELECT t.email FROM email_verification_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.user_id = $1 AND t.used_at IS NULL AND t.expires_at > NOW() AND t.email <> u.email
+		ORDER BY t.created_at DESC
+		LIMIT 1`, userID).Scan(&email)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return email, err
+}
+
+// --- Two-Factor Implementation ---
+
+type postgresTwoFactorRepo struct {
+	DB *sql.DB
+}
+
+func (r *postgresTwoFactorRepo) GetTwoFactor(userID int) (*models.TwoFactor, error) {
+	tf := models.TwoFactor{UserID: userID}
+	var lastStep sql.NullInt64
+	err := r.DB.QueryRow(`
+		SELECT u.totp_secret, u.totp_enabled_at, u.totp_last_step,
+		       (SELECT COUNT(*) FROM recovery_codes c WHERE c.user_id = u.id AND c.used_at IS NULL)
+		FROM users u
+		WHERE u.id = $1 AND u.totp_enabled_at IS NOT NULL`, userID).
+		Scan(&tf.Secret, &tf.EnabledAt, &lastStep, &tf.RecoveryCodesLeft)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	tf.LastStep = lastStep.Int64
+	return &tf, nil
+}
+
+func (r *postgresTwoFactorRepo) EnableTwoFactor(userID int, secret string, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE users SET totp_secret = $1, totp_enabled_at = NOW(), totp_last_step = $2 WHERE id = $3",
+		secret, step, userID); err != nil {
+		rollback(tx)
+		return err
+	}
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		rollback(tx)
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *postgresTwoFactorRepo) DisableTwoFactor(userID int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = $1", userID); err != nil {
+		rollback(tx)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		rollback(tx)
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *postgresTwoFactorRepo) AcceptTOTPStep(userID int, step int64) (bool, error) {
+	res, err := r.DB.Exec(`
+		UPDATE users SET totp_last_step = $2
+		WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)`, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresTwoFactorRepo) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	res, err := r.DB.Exec("UPDATE recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresTwoFactorRepo) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		rollback(tx)
+		return err
+	}
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes discards the user's recovery codes and stores codeHashes
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) SELECT $1, unnest($2::text[])", userID, pq.Array(codeHashes))
+	return err
+}
+
+// --- Passkey Implementation ---
+
+type postgresPasskeyRepo struct {
+	DB *sql.DB
+}
+
+func (r *postgresPasskeyRepo) EnsureWebAuthnHandle(userID int, candidate []byte) ([]byte, error) {
+	var handle []byte
+	err := r.DB.QueryRow("UPDATE users SET webauthn_handle = COALESCE(webauthn_handle, $2) WHERE id = $1 RETURNING webauthn_handle",
+		userID, candidate).Scan(&handle)
+	return handle, err
+}
+
+func (r *postgresPasskeyRepo) GetUserIDByWebAuthnHandle(handle []byte) (int, error) {
+	var userID int
+	err := r.DB.QueryRow("SELECT id FROM users WHERE webauthn_handle = $1", handle).Scan(&userID)
+	return userID, err
+}
+
+func (r *postgresPasskeyRepo) ListPasskeys(userID int) ([]models.Passkey, error) {
+	rows, err := r.DB.Query(`
+		SELECT id, user_id, name, credential_id, credential, created_at, last_used_at
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passkeys []models.Passkey
+	for rows.Next() {
+		var p models.Passkey
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Name, &p.CredentialID, &p.Credential, &p.CreatedAt, &p.LastUsedAt); err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, p)
+	}
+	return passkeys, rows.Err()
+}
+
+func (r *postgresPasskeyRepo) CreatePasskey(userID int, name string, credentialID, credential []byte) error {
+	_, err := r.DB.Exec("INSERT INTO webauthn_credentials (user_id, name, credential_id, credential) VALUES ($1, $2, $3, $4)",
+		userID, name, credentialID, string(credential))
+	return err
+}
+
+func (r *postgresPasskeyRepo) UpdatePasskeyUsage(credentialID, credential []byte) error {
+	_, err := r.DB.Exec("UPDATE webauthn_credentials SET credential = $2, last_used_at = NOW() WHERE credential_id = $1",
+		credentialID, string(credential))
+	return err
+}
+
+func (r *postgresPasskeyRepo) DeletePasskey(id, userID int) (bool, error) {
+	res, err := r.DB.Exec("DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+type postgresSessionRepo struct {
+	DB *sql.DB
+}
+
+// sessionLifetime matches the session cookie's MaxAge; older sessions can no
+// longer be presented and are not listed
+const sessionLifetime = "30 days"
+
+func (r *postgresSessionRepo) CreateSession(userID int, tokenHash, userAgent, ip string) error {
+	if _, err := r.DB.Exec(`
+		DELETE FROM user_sessions
+		WHERE user_id = $1 AND (revoked_at IS NOT NULL OR last_seen_at < NOW() - INTERVAL '`+sessionLifetime+`')`,
+		userID); err != nil {
+		return err
+	}
+	_, err := r.DB.Exec("INSERT INTO user_sessions (user_id, token_hash, user_agent, ip_address) VALUES ($1, $2, $3, $4)",
+		userID, tokenHash, userAgent, ip)
+	return err
+}
+
+func (r *postgresSessionRepo) TouchSession(userID int, tokenHash, ip string) (bool, error) {
+	var live bool
+	err := r.DB.QueryRow(`
+		WITH s AS (
+			SELECT id, last_seen_at FROM user_sessions
+			WHERE token_hash = $1 AND user_id = $2 AND revoked_at IS NULL
+			  AND last_seen_at > NOW() - INTERVAL '`+sessionLifetime+`'
+		), touched AS (
+			UPDATE user_sessions SET last_seen_at = NOW(), ip_address = $3
+			WHERE id IN (SELECT id FROM s WHERE last_seen_at < NOW() - INTERVAL '1 minute')
+		)
+		SELECT EXISTS (SELECT 1 FROM s)`,
+		tokenHash, userID, ip).Scan(&live)
+	return live, err
+}
+
+func (r *postgresSessionRepo) ListSessions(userID int) ([]models.UserSession, error) {
+	rows, err := r.DB.Query(`
+		SELECT id, user_id, token_hash, user_agent, ip_address, created_at, last_seen_at
+		FROM user_sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND last_seen_at > NOW() - INTERVAL '`+sessionLifetime+`'
+		ORDER BY last_seen_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.UserSession
+	for rows.Next() {
+		var s models.UserSession
+		if err := rows.Scan(&s.ID, &s.UserID, &s.TokenHash, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+func (r *postgresSessionRepo) RevokeSession(id, userID int) (bool, error) {
+	res, err := r.DB.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL", id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresSessionRepo) RevokeSessionByToken(tokenHash string) error {
+	_, err := r.DB.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE token_hash = $1 AND revoked_at IS NULL", tokenHash)
+	return err
+}
+
+func (r *postgresSessionRepo) RevokeUserSessions(userID int, exceptTokenHash string) (int, error) {
+	res, err := r.DB.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = $1 AND token_hash <> $2 AND revoked_at IS NULL",
+		userID, exceptTokenHash)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+type postgresIdentityRepo struct {
+	DB *sql.DB
+}
+
+func (r *postgresIdentityRepo) FindIdentityUser(provider, subject string) (int, error) {
+	var userID int
+	err := r.DB.QueryRow("UPDATE user_identities SET last_login_at = NOW() WHERE provider = $1 AND subject = $2 RETURNING user_id",
+		provider, subject).Scan(&userID)
+	return userID, err
+}
+
+func (r *postgresIdentityRepo) LinkIdentity(userID int, provider, subject, email string) error {
+	_, err := r.DB.Exec("INSERT INTO user_identities (user_id, provider, subject, email, last_login_at) VALUES ($1, $2, $3, NULLIF($4, ''), NOW())",
+		userID, provider, subject, email)
+	return err
+}
+
+func (r *postgresIdentityRepo) CreateUserWithIdentity(email, fullName, provider, subject string, emailVerified bool) (int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var userID int
+	err = tx.QueryRow(`
+		INSERT INTO users (email, password_hash, full_name, email_verified_at)
+		VALUES ($1, '', NULLIF($2, ''), CASE WHEN $3 THEN NOW() END)
+		RETURNING id`, email, fullName, emailVerified).Scan(&userID)
+	if err != nil {
+		rollback(tx)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return 0, ErrEmailTaken
+		}
+		return 0, err
+	}
+
+	if _, err := tx.Exec("INSERT INTO user_identities (user_id, provider, subject, email, last_login_at) VALUES ($1, $2, $3, $4, NOW())",
+		userID, provider, subject, email); err != nil {
+		rollback(tx)
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+func (r *postgresIdentityRepo) ListIdentities(userID int) ([]models.UserIdentity, error) {
+	rows, err := r.DB.Query(`
+		SELECT id, user_id, provider, subject, email, created_at, last_login_at
+		FROM user_identities WHERE user_id = $1 ORDER BY provider`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.UserIdentity
+	for rows.Next() {
+		var i models.UserIdentity
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt, &i.LastLoginAt); err != nil {
+			return nil, err
+		}
+		list = append(list, i)
+	}
+	return list, rows.Err()
+}
+
+// --- Search Analytics Implementation ---
+
+type postgresSearchAnalyticsRepo struct {
+	DB *sql.DB
+}
+
+func (r *postgresSearchAnalyticsRepo) RecordSearch(event models.SearchEvent) (int64, error) {
+	filters, err := json.Marshal(event.Filters)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = r.DB.QueryRow(`
+		INSERT INTO search_events (query, corrected_query, filters, result_count, latency_ms, session_id, user_id)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, NULLIF($6, ''), $7)
+		RETURNING id`,
+		event.Query, event.CorrectedQuery, filters, event.ResultCount,
+		float64(event.Latency.Microseconds())/1000, event.SessionID, event.UserID).Scan(&id)
+	return id, err
+}
+
+func (r *postgresSearchAnalyticsRepo) RecordClick(searchID int64, sessionID string, productID, position int) error {
+	_, err := r.DB.Exec(`
+		INSERT INTO search_clicks (search_id, product_id, position)
+		SELECT id, $3, $4 FROM search_events WHERE id = $1 AND session_id = $2
+		ON CONFLICT (search_id, product_id) DO NOTHING`,
+		searchID, sessionID, productID, position)
+	return err
+}
+
+func (r *postgresSearchAnalyticsRepo) ListUserSearches(userID int) ([]models.SearchEvent, error) {
+	rows, err := r.DB.Query(`
+		SELECT id, query, COALESCE(corrected_query, ''), filters, result_count, created_at
+		FROM search_events WHERE user_id = $1
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var searches []models.SearchEvent
+	for rows.Next() {
+		e := models.SearchEvent{UserID: &userID}
+		var filters []byte
+		if err := rows.Scan(&e.ID, &e.Query, &e.CorrectedQuery, &filters, &e.ResultCount, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(filters, &e.Filters); err != nil {
+			return nil, err
+		}
+		searches = append(searches, e)
+	}
+	return searches, rows.Err()
+}
+
+// searchEventsSince selects the searches since $1 with the query lowercased
+// for grouping and whether any of their results were clicked
+const searchEventsSince = `
+	WITH s AS (
+		SELECT e.result_count, e.latency_ms, LOWER(e.query) AS query,
+		       EXISTS (SELECT 1 FROM search_clicks c WHERE c.search_id = e.id) AS clicked
+		FROM search_events e
+		WHERE e.created_at >= $1
+	)`
+
+func (r *postgresSearchAnalyticsRepo) SearchReport(since time.Time, limit int) (*models.SearchReport, error) {
+	report := &models.SearchReport{Since: since}
+	err := r.DB.QueryRow(searchEventsSince+`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE result_count = 0), COUNT(*) FILTER (WHERE clicked),
+		       COALESCE(AVG(latency_ms), 0)
+		FROM s`, since).Scan(&report.Searches, &report.ZeroResultSearches, &report.ClickedSearches, &report.AvgLatencyMs)
+	if err != nil {
+		return nil, err
+	}
+
+	if report.TopQueries, err = r.queryStats(since, "query <> ''", limit); err != nil {
+		return nil, err
+	}
+	if report.ZeroResultQueries, err = r.queryStats(since, "query <> '' AND result_count = 0", limit); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// queryStats groups the searches since since matching where by query,
+// most searched first
+func (r *postgresSearchAnalyticsRepo) queryStats(since time.Time, where string, limit int) ([]models.QueryStats, error) {
+	rows, err := r.DB.Query(searchEventsSince+`
+		SELECT query, COUNT(*), AVG(result_count), COUNT(*) FILTER (WHERE clicked)
+		FROM s
+		WHERE `+where+`
+		GROUP BY query
+		ORDER BY COUNT(*) DESC, query
+		LIMIT $2`, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []models.QueryStats{}
+	for rows.Next() {
+		var q models.QueryStats
+		if err := rows.Scan(&q.Query, &q.Searches, &q.AvgResults, &q.ClickedSearches); err != nil {
+			return nil, err
+		}
+		stats = append(stats, q)
+	}
+	return stats, rows.Err()
+}
+
+// --- Search Rules Implementation ---
+
+type postgresSearchRulesRepo struct {
+	DB *sql.DB
+	ES *ElasticsearchRepository
+}
+
+func (r *postgresSearchRulesRepo) ListSynonymSets() ([]models.SynonymSet, error) {
+	rows, err := r.DB.Query("SELECT id, terms, created_at FROM search_synonyms ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sets := []models.SynonymSet{}
+	for rows.Next() {
+		var set models.SynonymSet
+		if err := rows.Scan(&set.ID, pq.Array(&set.Terms), &set.CreatedAt); err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	return sets, rows.Err()
+}
+
+func (r *postgresSearchRulesRepo) CreateSynonymSet(terms []string) (int, error) {
+	var id int
+	err := r.DB.QueryRow("INSERT INTO search_synonyms (terms) VALUES ($1) RETURNING id", pq.Array(terms)).Scan(&id)
+	return id, err
+}
+
+func (r *postgresSearchRulesRepo) DeleteSynonymSet(id int) error {
+	_, err := r.DB.Exec("DELETE FROM search_synonyms WHERE id = $1", id)
+	return err
+}
+
+func (r *postgresSearchRulesRepo) SyncSynonyms() error {
+	if r.ES == nil {
+		return nil
+	}
+	sets, err := r.ListSynonymSets()
+	if err != nil {
+		return err
+	}
+	return r.ES.PutSynonyms(sets)
+}
+
+const promotionColumns = `sp.id, sp.query, sp.product_id, p.name, sp.pinned, sp.boost, sp.created_at
+	FROM search_promotions sp JOIN products p ON p.id = sp.product_id`
+
+func (r *postgresSearchRulesRepo) ListPromotions() ([]models.SearchPromotion, error) {
+	return r.queryPromotions("SELECT " + promotionColumns + " ORDER BY sp.query, sp.pinned DESC, sp.id")
+}
+
+// promotionsFor returns the promotions of query, pinned products first in
+// the order they were pinned
+func (r *postgresSearchRulesRepo) promotionsFor(query string) ([]models.SearchPromotion, error) {
+	return r.queryPromotions("SELECT "+promotionColumns+" WHERE sp.query = $1 ORDER BY sp.pinned DESC, sp.id", normalizeQuery(query))
+}
+
+func (r *postgresSearchRulesRepo) queryPromotions(query string, args ...interface{}) ([]models.SearchPromotion, error) {
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	promotions := []models.SearchPromotion{}
+	for rows.Next() {
+		var p models.SearchPromotion
+		if err := rows.Scan(&p.ID, &p.Query, &p.ProductID, &p.ProductName, &p.Pinned, &p.Boost, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, p)
+	}
+	return promotions, rows.Err()
+}
+
+func (r *postgresSearchRulesRepo) CreatePromotion(p models.SearchPromotion) (int, error) {
+	var id int
+	err := r.DB.QueryRow(`
+		INSERT INTO search_promotions (query, product_id, pinned, boost) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (query, product_id) DO UPDATE SET pinned = EXCLUDED.pinned, boost = EXCLUDED.boost
+		RETURNING id`,
+		normalizeQuery(p.Query), p.ProductID, p.Pinned, p.Boost).Scan(&id)
+	return id, err
+}
+
+func (r *postgresSearchRulesRepo) DeletePromotion(id int) error {
+	_, err := r.DB.Exec("DELETE FROM search_promotions WHERE id = $1", id)
+	return err
+}
+
+func (r *postgresSearchRulesRepo) PreviewSearch(ctx context.Context, query string, limit int) (*models.SearchPreview, error) {
+	with := &postgresProductRepo{DB: r.DB, ES: r.ES}
+	rules, err := with.searchRules(query, "relevance")
+	if err != nil {
+		return nil, err
+	}
+	promotions, err := r.promotionsFor(query)
+	if err != nil {
+		return nil, err
+	}
+
+	withRules, err := with.SearchProductsFaceted(ctx, query, models.SearchFilters{}, 1, limit, "relevance")
+	if err != nil {
+		return nil, err
+	}
+	without := &postgresProductRepo{DB: r.DB, ES: r.ES, skipRules: true}
+	withoutRules, err := without.SearchProductsFaceted(ctx, query, models.SearchFilters{}, 1, limit, "relevance")
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SearchPreview{
+		Query:        query,
+		Expansions:   rules.terms[1:],
+		Promotions:   promotions,
+		WithRules:    withRules.Hits,
+		WithoutRules: withoutRules.Hits,
+	}, nil
+}
@@ -1,9 +1,13 @@
 package repository
 
 import (
+	"DemoApp/internal/models"
+	"context"
 	"database/sql"
 	"os"
+	"strconv"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 )
@@ -417,3 +421,111 @@ func TestSearchProducts(t *testing.T) {
 		t.Logf("Search for 'pride' returned %d results", len(products))
 	}
 }
+
+// TestSearchProductsRanked checks the SQL search matches other forms of a
+// word and typos, ranking title matches first
+func TestSearchProductsRanked(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	tests := map[string]string{
+		"prejudices":   "Pride and Prejudice",
+		"frankenstien": "Frankenstein; Or, The Modern Prometheus",
+	}
+	for query, want := range tests {
+		products, err := repo.Products().SearchProducts(query, 0)
+		if err != nil {
+			t.Fatalf("SearchProducts(%q) failed: %v", query, err)
+		}
+		if len(products) == 0 || products[0].Name != want {
+			t.Errorf("SearchProducts(%q) should find %q first, got %d results", query, want, len(products))
+		}
+	}
+}
+
+// TestSearchProductsFaceted checks the SQL facet counts agree with the
+// filtered results: each facet ignores its own filter but applies the others
+func TestSearchProductsFaceted(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+
+	all, err := repo.Products().SearchProductsFaceted(context.Background(), "", models.SearchFilters{}, 1, 10, "name")
+	if err != nil {
+		t.Fatalf("SearchProductsFaceted failed: %v", err)
+	}
+	if len(all.Facets.Categories) == 0 {
+		t.Fatal("Expected category facet values")
+	}
+
+	category := all.Facets.Categories[0]
+	id, _ := strconv.Atoi(category.Key)
+	filters := models.SearchFilters{CategoryIDs: []int{id}}
+	filtered, err := repo.Products().SearchProductsFaceted(context.Background(), "", filters, 1, 10, "name")
+	if err != nil {
+		t.Fatalf("SearchProductsFaceted with filter failed: %v", err)
+	}
+	if filtered.Pagination.TotalItems != category.Count {
+		t.Errorf("Category %s has count %d but the filter matched %d products", category.Label, category.Count, filtered.Pagination.TotalItems)
+	}
+	if len(filtered.Facets.Categories) != len(all.Facets.Categories) {
+		t.Errorf("Selecting a category changed the category facet: %d values, want %d", len(filtered.Facets.Categories), len(all.Facets.Categories))
+	}
+	for _, p := range filtered.Products() {
+		if p.CategoryID == nil || *p.CategoryID != id {
+			t.Errorf("Product %d is not in category %d", p.ID, id)
+		}
+	}
+}
+
+// TestSearchAnalytics checks clicks count once per product and only from
+// the session that searched
+func TestSearchAnalytics(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	repo := NewPostgresRepository(db)
+	analytics := repo.SearchAnalytics()
+
+	query := "analytics test " + strconv.FormatInt(time.Now().UnixNano(), 36)
+	id, err := analytics.RecordSearch(models.SearchEvent{Query: query, ResultCount: 0, Latency: 5 * time.Millisecond, SessionID: "session-a"})
+	if err != nil {
+		t.Fatalf("RecordSearch failed: %v", err)
+	}
+	defer db.Exec("DELETE FROM search_events WHERE id = $1", id)
+
+	var productID int
+	if err := db.QueryRow("SELECT id FROM products LIMIT 1").Scan(&productID); err != nil {
+		t.Fatalf("Failed to get a product: %v", err)
+	}
+	for _, sessionID := range []string{"session-a", "session-a", "session-b"} {
+		if err := analytics.RecordClick(id, sessionID, productID, 1); err != nil {
+			t.Fatalf("RecordClick failed: %v", err)
+		}
+	}
+	var clicks int
+	db.QueryRow("SELECT COUNT(*) FROM search_clicks WHERE search_id = $1", id).Scan(&clicks)
+	if clicks != 1 {
+		t.Errorf("Expected 1 click, got %d", clicks)
+	}
+
+	report, err := analytics.SearchReport(time.Now().Add(-time.Minute), 1000)
+	if err != nil {
+		t.Fatalf("SearchReport failed: %v", err)
+	}
+	found := false
+	for _, q := range report.ZeroResultQueries {
+		if q.Query == query {
+			found = true
+			if q.Searches != 1 || q.ClickedSearches != 1 {
+				t.Errorf("Expected 1 search with a click, got %+v", q)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Query %q missing from the zero-result queries", query)
+	}
+}
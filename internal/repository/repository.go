@@ -2,16 +2,32 @@ package repository
 
 import (
 	"DemoApp/internal/models"
+	"context"
+	"errors"
+	"time"
 )
 
+// ErrEmailTaken is returned when an email address belongs to another account
+var ErrEmailTaken = errors.New("email address already in use")
+
 type ProductRepository interface {
 	ListProducts() ([]models.Product, error)
 	ListProductsPaginated(page, pageSize int) (*models.ProductsResult, error)
 	ListProductsPaginatedSorted(page, pageSize int, sortBy string) (*models.ProductsResult, error)
 	GetProductByID(id int) (*models.Product, error)
+	GetProductsByIDs(ids []int) ([]models.Product, error)
 	SearchProducts(query string, categoryID int) ([]models.Product, error)
 	SearchProductsPaginated(query string, categoryID, page, pageSize int) (*models.ProductsResult, error)
 	SearchProductsPaginatedSorted(query string, categoryID, page, pageSize int, sortBy string) (*models.ProductsResult, error)
+	// SearchProductsFaceted returns a page of products matching query and
+	// filters, with the facet counts to narrow it further. An empty sortBy
+	// keeps relevance order where the search engine provides one.
+	SearchProductsFaceted(ctx context.Context, query string, filters models.SearchFilters, page, pageSize int, sortBy string) (*models.SearchResult, error)
+	// SuggestQuery returns a corrected spelling of query, or "" if there is none
+	SuggestQuery(query string) (string, error)
+	// SuggestCompletions returns titles, authors and categories completing
+	// what has been typed in the search box, up to limit of each
+	SuggestCompletions(prefix string, limit int) (*models.Suggestions, error)
 	ListCategories() ([]models.Category, error)
 }
 
@@ -19,6 +35,8 @@ type OrderRepository interface {
 	CreateOrder(sessionID string, userID int, items []models.CartItem) (int, error)
 	GetOrderByID(id int) (*models.Order, error)
 	GetOrdersByUserID(userID int) ([]models.Order, error)
+	// CancelOrder cancels a pending order owned by userID, reporting whether it changed
+	CancelOrder(orderID, userID int) (bool, error)
 	// Purchase verification for Reader app integration
 	GetUserPurchases(userID int) ([]models.PurchasedBook, error)
 	VerifyPurchase(userID int, sku string) (bool, error)
@@ -40,15 +58,159 @@ type UserRepository interface {
 	GetUserByID(id int) (*models.User, error)
 	UpdateUserProfile(userID int, email, fullName string) error
 	UpdateUserPassword(userID int, passwordHash string) error
+	// DeleteAccount erases the user and everything that cascades from them,
+	// keeping their orders anonymized for financial records
+	DeleteAccount(userID int) error
 }
 
 type ReviewRepository interface {
 	CreateReview(productID, userID, rating int, title, comment string) error
 	GetReviewsByProductID(productID int) ([]models.ReviewWithUser, error)
 	GetReviewByUserAndProduct(userID, productID int) (*models.Review, error)
+	GetReviewsByUserID(userID int) ([]models.Review, error)
 	UpdateReview(reviewID, rating int, title, comment string) error
 	DeleteReview(reviewID, userID int) error
 	GetProductRating(productID int) (*models.ProductRating, error)
+	// Batch lookups keyed by product ID (used by the GraphQL loaders)
+	GetReviewsByProductIDs(productIDs []int) (map[int][]models.ReviewWithUser, error)
+	GetProductRatings(productIDs []int) (map[int]*models.ProductRating, error)
+}
+
+type WebhookRepository interface {
+	ListSubscribers() ([]models.WebhookSubscriber, error)
+	CreateSubscriber(url, secret string, events []string) (int, error)
+	SetSubscriberActive(id int, active bool) error
+	DeleteSubscriber(id int) error
+	// EnqueueEvent queues a delivery for every active subscriber that wants
+	// eventType, skipping subscribers that already have eventID queued
+	EnqueueEvent(eventID, eventType string, payload []byte) (int, error)
+	// ClaimDueDeliveries leases up to limit due deliveries so other replicas skip them
+	ClaimDueDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	RecordDeliveryAttempt(d *models.WebhookDelivery) error
+	ListDeliveries(limit int) ([]models.WebhookDelivery, error)
+	// RetryDelivery requeues a delivery for immediate redelivery
+	RetryDelivery(id int) error
+}
+
+type OutboxRepository interface {
+	// ClaimOutboxEvents leases up to limit unpublished events that are due, oldest first
+	ClaimOutboxEvents(limit int, lease time.Duration) ([]models.OutboxEvent, error)
+	// MarkOutboxSinkPublished records that sink accepted the event so a retry skips it
+	MarkOutboxSinkPublished(id int64, sink string) error
+	MarkOutboxPublished(id int64) error
+	MarkOutboxFailed(id int64, errMsg string, retryAt time.Time) error
+}
+
+type PasswordResetRepository interface {
+	CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error
+	// GetPasswordResetUser returns the user a live (unused, unexpired) token belongs to
+	GetPasswordResetUser(tokenHash string) (userID int, ok bool, err error)
+	// ResetPassword consumes a live token and sets the user's password in one
+	// transaction, invalidating the user's other outstanding tokens
+	ResetPassword(tokenHash, passwordHash string) (userID int, ok bool, err error)
+}
+
+type EmailVerificationRepository interface {
+	// CreateEmailVerification stores a token confirming email for the user,
+	// replacing any earlier unused tokens
+	CreateEmailVerification(userID int, email, tokenHash string, expiresAt time.Time) error
+	// VerifyEmail consumes a live token, making its address the user's
+	// verified email, and returns the address it replaced. Returns
+	// ErrEmailTaken if another account has claimed the address since the
+	// token was issued.
+	VerifyEmail(tokenHash string) (userID int, oldEmail, email string, ok bool, err error)
+	// PendingEmail returns the address of a live email-change token, or ""
+	PendingEmail(userID int) (string, error)
+}
+
+type TwoFactorRepository interface {
+	// GetTwoFactor returns the user's enrollment, or nil if 2FA is off
+	GetTwoFactor(userID int) (*models.TwoFactor, error)
+	// EnableTwoFactor stores the secret, the step of the code that confirmed
+	// it, and a fresh set of recovery codes
+	EnableTwoFactor(userID int, secret string, step int64, recoveryCodeHashes []string) error
+	DisableTwoFactor(userID int) error
+	// AcceptTOTPStep records step as used, returning false if it is not
+	// later than the last accepted step (a replayed code)
+	AcceptTOTPStep(userID int, step int64) (bool, error)
+	// UseRecoveryCode consumes an unused recovery code
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+}
+
+type PasskeyRepository interface {
+	// EnsureWebAuthnHandle returns the user's WebAuthn handle, storing
+	// candidate first if they do not have one yet
+	EnsureWebAuthnHandle(userID int, candidate []byte) ([]byte, error)
+	// GetUserIDByWebAuthnHandle returns sql.ErrNoRows for unknown handles
+	GetUserIDByWebAuthnHandle(handle []byte) (int, error)
+	ListPasskeys(userID int) ([]models.Passkey, error)
+	CreatePasskey(userID int, name string, credentialID, credential []byte) error
+	// UpdatePasskeyUsage stores the credential's new sign count and flags after a login
+	UpdatePasskeyUsage(credentialID, credential []byte) error
+	DeletePasskey(id, userID int) (bool, error)
+}
+
+type IdentityRepository interface {
+	// FindIdentityUser returns the user linked to a provider account,
+	// recording the login, or sql.ErrNoRows if it is not linked
+	FindIdentityUser(provider, subject string) (int, error)
+	LinkIdentity(userID int, provider, subject, email string) error
+	// CreateUserWithIdentity creates a password-less user linked to a
+	// provider account. Returns ErrEmailTaken if the email is in use.
+	CreateUserWithIdentity(email, fullName, provider, subject string, emailVerified bool) (int, error)
+	ListIdentities(userID int) ([]models.UserIdentity, error)
+}
+
+type SessionRepository interface {
+	// CreateSession records a new signed-in session, pruning the user's
+	// revoked and expired ones
+	CreateSession(userID int, tokenHash, userAgent, ip string) error
+	// TouchSession reports whether the session is still live, refreshing
+	// its last-seen time and IP at most once a minute
+	TouchSession(userID int, tokenHash, ip string) (bool, error)
+	// ListSessions returns the user's live sessions, most recently seen first
+	ListSessions(userID int) ([]models.UserSession, error)
+	RevokeSession(id, userID int) (bool, error)
+	RevokeSessionByToken(tokenHash string) error
+	// RevokeUserSessions revokes every live session of the user except the
+	// one with exceptTokenHash (pass "" to revoke all), returning how many
+	RevokeUserSessions(userID int, exceptTokenHash string) (int, error)
+}
+
+type AuditRepository interface {
+	Record(entry models.AuditEntry) error
+}
+
+type SearchRulesRepository interface {
+	ListSynonymSets() ([]models.SynonymSet, error)
+	CreateSynonymSet(terms []string) (int, error)
+	DeleteSynonymSet(id int) error
+	// SyncSynonyms pushes every synonym set to Elasticsearch's search
+	// analyzer. Call it after changing the sets.
+	SyncSynonyms() error
+	ListPromotions() ([]models.SearchPromotion, error)
+	// CreatePromotion promotes a product for a query, replacing any earlier
+	// promotion of the product for the same query
+	CreatePromotion(p models.SearchPromotion) (int, error)
+	DeletePromotion(id int) error
+	// PreviewSearch runs query sorted by relevance with and without the
+	// synonyms and promotions, returning up to limit results of each
+	PreviewSearch(ctx context.Context, query string, limit int) (*models.SearchPreview, error)
+}
+
+type SearchAnalyticsRepository interface {
+	// RecordSearch stores a search and returns its ID, which clicks on its
+	// results refer to
+	RecordSearch(event models.SearchEvent) (int64, error)
+	// RecordClick stores a click on a search result, once per product. It
+	// is ignored unless the search was made in the same session.
+	RecordClick(searchID int64, sessionID string, productID, position int) error
+	// SearchReport sums up the searches since since, listing up to limit
+	// queries of each kind
+	SearchReport(since time.Time, limit int) (*models.SearchReport, error)
+	// ListUserSearches returns the searches made while signed in as userID, newest first
+	ListUserSearches(userID int) ([]models.SearchEvent, error)
 }
 
 type Repository interface {
@@ -57,4 +219,15 @@ type Repository interface {
 	Cart() CartRepository
 	Users() UserRepository
 	Reviews() ReviewRepository
+	Webhooks() WebhookRepository
+	Outbox() OutboxRepository
+	Audit() AuditRepository
+	PasswordResets() PasswordResetRepository
+	EmailVerifications() EmailVerificationRepository
+	TwoFactor() TwoFactorRepository
+	Passkeys() PasskeyRepository
+	Sessions() SessionRepository
+	Identities() IdentityRepository
+	SearchRules() SearchRulesRepository
+	SearchAnalytics() SearchAnalyticsRepository
 }
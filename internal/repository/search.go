@@ -0,0 +1,383 @@
+package repository
+
+import (
+	"DemoApp/internal/models"
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// authorFacetSize is how many of the most common authors the facet lists
+const authorFacetSize = 20
+
+// snippetSize is the approximate length of a description snippet
+const snippetSize = 150
+
+// Facet names, used to leave a facet's own filter out of its counts
+const (
+	facetCategory = "category"
+	facetAuthor   = "author"
+	facetPrice    = "price"
+	facetRating   = "rating"
+	facetInStock  = "in_stock"
+)
+
+// facetCounts are the raw counts from Elasticsearch or SQL, turned into
+// models.Facets by buildFacets
+type facetCounts struct {
+	categories map[int]int
+	authors    []authorCount // Most common first
+	prices     map[string]int
+	ratings    map[string]int
+	inStock    int
+}
+
+type authorCount struct {
+	name  string
+	count int
+}
+
+// buildFacets labels the counts for display. Options with no matches are
+// left out unless selected, so a selection can always be undone.
+func buildFacets(counts facetCounts, filters models.SearchFilters, categories []models.Category) models.Facets {
+	facets := models.Facets{
+		Categories: []models.FacetValue{},
+		Authors:    []models.FacetValue{},
+		Prices:     []models.FacetValue{},
+		Ratings:    []models.FacetValue{},
+		InStock:    models.FacetValue{Key: "1", Label: "In stock", Count: counts.inStock, Selected: filters.InStock},
+	}
+
+	for _, c := range categories {
+		selected := containsInt(filters.CategoryIDs, c.ID)
+		if n := counts.categories[c.ID]; n > 0 || selected {
+			facets.Categories = append(facets.Categories, models.FacetValue{
+				Key: strconv.Itoa(c.ID), Label: c.Name, Count: n, Selected: selected,
+			})
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, a := range counts.authors {
+		seen[a.name] = true
+		facets.Authors = append(facets.Authors, models.FacetValue{
+			Key: a.name, Label: a.name, Count: a.count, Selected: containsString(filters.Authors, a.name),
+		})
+	}
+	for _, name := range filters.Authors {
+		if !seen[name] {
+			facets.Authors = append(facets.Authors, models.FacetValue{Key: name, Label: name, Selected: true})
+		}
+	}
+
+	facets.Prices = rangeFacet(models.PriceRanges, counts.prices, filters.PriceRanges)
+	facets.Ratings = rangeFacet(models.RatingRanges, counts.ratings, filters.RatingRanges)
+	return facets
+}
+
+func rangeFacet(ranges []models.FacetRange, counts map[string]int, selected []string) []models.FacetValue {
+	values := []models.FacetValue{}
+	for _, r := range ranges {
+		isSelected := containsString(selected, r.Key)
+		if n := counts[r.Key]; n > 0 || isSelected {
+			values = append(values, models.FacetValue{Key: r.Key, Label: r.Label, Count: n, Selected: isSelected})
+		}
+	}
+	return values
+}
+
+// maxSynonymExpansions caps how many rewrites of a query the SQL search
+// tries, so a query touching many synonym sets stays cheap
+const maxSynonymExpansions = 10
+
+// searchRules is a search's query with the admin rules that apply to it
+type searchRules struct {
+	query    string
+	synonyms bool            // Whether Elasticsearch expands the query's synonyms
+	terms    []string        // The query then its synonym rewrites, matched by the SQL search
+	pinned   []int           // Products put first, in order
+	boosts   map[int]float64 // Score multipliers by product ID
+}
+
+// promotes reports whether the rules change the order of results
+func (r *searchRules) promotes() bool {
+	return len(r.pinned) > 0 || len(r.boosts) > 0
+}
+
+// normalizeQuery lowercases query and collapses its whitespace, so rules
+// for a query apply however it is typed
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// expandSynonyms returns query followed by its rewrites with a synonym in
+// place of each term of sets it contains. Terms match whole words,
+// ignoring case and punctuation, so "Sci-Fi classics" contains "sci fi".
+func expandSynonyms(query string, sets []models.SynonymSet) []string {
+	expansions := []string{query}
+	words := " " + strings.Join(splitWords(query), " ") + " "
+	seen := map[string]bool{normalizeQuery(query): true, strings.TrimSpace(words): true}
+	for _, set := range sets {
+		for _, term := range set.Terms {
+			key := " " + strings.Join(splitWords(term), " ") + " "
+			if key == "  " || !strings.Contains(words, key) {
+				continue
+			}
+			for _, other := range set.Terms {
+				rewrite := strings.TrimSpace(strings.Replace(words, key, " "+other+" ", 1))
+				if n := normalizeQuery(rewrite); !seen[n] && len(expansions) <= maxSynonymExpansions {
+					seen[n] = true
+					expansions = append(expansions, rewrite)
+				}
+			}
+		}
+	}
+	return expansions
+}
+
+// promotedOrder returns the ORDER BY terms putting pinned products first
+// and boosted ones next. The IDs and boosts are numbers from our own
+// tables, so they are inlined rather than passed as arguments.
+func promotedOrder(rules *searchRules) string {
+	var terms []string
+	if len(rules.pinned) > 0 {
+		var b strings.Builder
+		b.WriteString("CASE id")
+		for i, id := range rules.pinned {
+			fmt.Fprintf(&b, " WHEN %d THEN %d", id, i)
+		}
+		b.WriteString(" END ASC NULLS LAST")
+		terms = append(terms, b.String())
+	}
+	if len(rules.boosts) > 0 {
+		var b strings.Builder
+		b.WriteString("CASE id")
+		for id, boost := range rules.boosts {
+			fmt.Fprintf(&b, " WHEN %d THEN %g", id, boost)
+		}
+		b.WriteString(" ELSE 1 END DESC")
+		terms = append(terms, b.String())
+	}
+	return strings.Join(terms, ", ")
+}
+
+// newPagination returns the pagination metadata for one page of total items
+func newPagination(page, pageSize, total int) models.Pagination {
+	return models.Pagination{
+		Page:       page,
+		PageSize:   pageSize,
+		TotalItems: total,
+		TotalPages: (total + pageSize - 1) / pageSize,
+	}
+}
+
+// searchHits pairs products with their highlights, keyed by product ID
+func searchHits(products []models.Product, highlights map[int]*models.Highlight) []models.SearchHit {
+	hits := make([]models.SearchHit, len(products))
+	for i, p := range products {
+		hits[i] = models.SearchHit{Product: p, Highlight: highlights[p.ID]}
+	}
+	return hits
+}
+
+// highlightStopWords are words too common to be worth highlighting alone
+var highlightStopWords = map[string]bool{
+	"and": true, "the": true, "for": true, "with": true, "from": true, "about": true, "into": true, "that": true, "this": true,
+}
+
+// highlightTerms returns terms followed by their words of three or more
+// letters, since the full-text search matches the words of a term anywhere
+// in a product, not only the whole term
+func highlightTerms(terms []string) []string {
+	highlight := slices.Clone(terms)
+	for _, term := range terms {
+		for _, w := range splitWords(term) {
+			if utf8.RuneCountInString(w) >= 3 && !highlightStopWords[w] && !slices.Contains(highlight, w) {
+				highlight = append(highlight, w)
+			}
+		}
+	}
+	return highlight
+}
+
+// highlightProducts marks where any of terms appears in each product, in
+// the same form as Elasticsearch highlights
+func highlightProducts(products []models.Product, terms []string) map[int]*models.Highlight {
+	// Longer terms first, so a term is not cut short by one it starts with
+	terms = slices.Clone(terms)
+	sort.SliceStable(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = regexp.QuoteMeta(t)
+	}
+	re := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+	highlights := make(map[int]*models.Highlight, len(products))
+	for _, p := range products {
+		h := &models.Highlight{Name: markMatches(p.Name, re)}
+		if p.Author != nil {
+			h.Author = markMatches(*p.Author, re)
+		}
+		if loc := re.FindStringIndex(p.Description); loc != nil {
+			h.Description = []string{markMatches(snippet(p.Description, loc), re)}
+		}
+		highlights[p.ID] = h
+	}
+	return highlights
+}
+
+// markMatches HTML-escapes text and wraps each match of re in <mark>. It
+// returns "" when nothing matches.
+func markMatches(text string, re *regexp.Regexp) string {
+	locs := re.FindAllStringIndex(text, -1)
+	if locs == nil {
+		return ""
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range locs {
+		b.WriteString(html.EscapeString(text[last:loc[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[loc[0]:loc[1]]))
+		b.WriteString("</mark>")
+		last = loc[1]
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
+
+// snippet cuts about snippetSize bytes of text centred on the match at loc,
+// at word boundaries where possible, marking cuts with an ellipsis
+func snippet(text string, loc []int) string {
+	if len(text) <= snippetSize {
+		return text
+	}
+	// A match longer than snippetSize is kept whole, with no context
+	start := min(loc[0], max(0, loc[0]-(snippetSize-(loc[1]-loc[0]))/2))
+	end := max(start+snippetSize, loc[1])
+	if end > len(text) {
+		end = len(text)
+		start = min(loc[0], max(0, end-snippetSize))
+	}
+	if start > 0 {
+		if i := strings.IndexByte(text[start:loc[0]], ' '); i >= 0 {
+			start += i + 1
+		}
+		for start < loc[0] && !utf8.RuneStart(text[start]) {
+			start++
+		}
+	}
+	if end < len(text) && end > loc[1] {
+		if i := strings.LastIndexByte(text[loc[1]:end], ' '); i >= 0 {
+			end = loc[1] + i
+		}
+		for end > loc[1] && !utf8.RuneStart(text[end]) {
+			end--
+		}
+	}
+
+	cut := text[start:end]
+	if start > 0 {
+		cut = "…" + cut
+	}
+	if end < len(text) {
+		cut += "…"
+	}
+	return cut
+}
+
+// splitWords lowercases text and splits it into words of letters and digits
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// suggestFromWords respells each word of query that is not in words, a
+// count of how often each word occurs, as the closest word within two
+// edits (one for words under five letters). Ties go to the more common
+// word. It returns "" when no word changes.
+func suggestFromWords(query string, words map[string]int) string {
+	queryWords := splitWords(query)
+	changed := false
+	for i, qw := range queryWords {
+		if _, known := words[qw]; known || utf8.RuneCountInString(qw) < 3 {
+			continue
+		}
+		maxEdits := 2
+		if utf8.RuneCountInString(qw) < 5 {
+			maxEdits = 1
+		}
+		best, bestEdits, bestCount := "", maxEdits+1, 0
+		for w, count := range words {
+			d := editDistance(qw, w)
+			if d < bestEdits || (d == bestEdits && (count > bestCount || (count == bestCount && w < best))) {
+				best, bestEdits, bestCount = w, d, count
+			}
+		}
+		if best != "" {
+			queryWords[i] = best
+			changed = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return strings.Join(queryWords, " ")
+}
+
+// editDistance is the Levenshtein distance between a and b in runes
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// likeEscaper escapes the LIKE wildcards in user input
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// hasWordPrefix reports whether any word of text starts with prefix,
+// ignoring case
+func hasWordPrefix(text, prefix string) bool {
+	prefix = strings.ToLower(prefix)
+	lower := strings.ToLower(text)
+	return strings.HasPrefix(lower, prefix) || strings.Contains(lower, " "+prefix)
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"DemoApp/internal/embeddings"
+	"DemoApp/internal/models"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestBuildFacets checks empty options are hidden unless selected, so a
+// selection that now matches nothing can still be cleared
+func TestBuildFacets(t *testing.T) {
+	counts := facetCounts{
+		categories: map[int]int{1: 3},
+		authors:    []authorCount{{name: "Jane Austen", count: 2}},
+		prices:     map[string]int{"10-20": 3},
+		ratings:    map[string]int{},
+	}
+	filters := models.SearchFilters{CategoryIDs: []int{2}, Authors: []string{"Mary Shelley"}, RatingRanges: []string{"4-up"}}
+	categories := []models.Category{{ID: 1, Name: "Fiction"}, {ID: 2, Name: "Poetry"}, {ID: 3, Name: "Drama"}}
+
+	facets := buildFacets(counts, filters, categories)
+
+	if len(facets.Categories) != 2 || facets.Categories[0].Label != "Fiction" || !facets.Categories[1].Selected {
+		t.Errorf("unexpected category facet: %+v", facets.Categories)
+	}
+	if len(facets.Authors) != 2 || facets.Authors[1].Key != "Mary Shelley" || facets.Authors[1].Count != 0 {
+		t.Errorf("unexpected author facet: %+v", facets.Authors)
+	}
+	if len(facets.Prices) != 1 || facets.Prices[0].Key != "10-20" {
+		t.Errorf("unexpected price facet: %+v", facets.Prices)
+	}
+	if len(facets.Ratings) != 1 || !facets.Ratings[0].Selected {
+		t.Errorf("unexpected rating facet: %+v", facets.Ratings)
+	}
+}
+
+// TestSearchSort checks every SQL sort has an Elasticsearch equivalent that
+// breaks ties by name, as getOrderClause does
+func TestSearchSort(t *testing.T) {
+	tests := map[string]string{
+		"name":       "name.keyword",
+		"price_asc":  "price",
+		"price_desc": "price",
+		"popularity": "popularity_score",
+		"newest":     "id",
+		"relevance":  "_score",
+		"":           "_score",
+	}
+	for sortBy, field := range tests {
+		sort := searchSort(sortBy)
+		first := sort[0]
+		if m, ok := first.(map[string]interface{}); ok {
+			for k := range m {
+				first = k
+			}
+		}
+		if first != field {
+			t.Errorf("searchSort(%q) sorts first by %v, want %s", sortBy, first, field)
+		}
+		last, _ := sort[len(sort)-1].(map[string]interface{})
+		if _, ok := last["name.keyword"]; !ok {
+			t.Errorf("searchSort(%q) does not end with name: %v", sortBy, sort)
+		}
+	}
+}
+
+// TestHighlightProducts checks the SQL fallback escapes the text, marks
+// every match case-insensitively and cuts long descriptions around the match
+func TestHighlightProducts(t *testing.T) {
+	author := "Mary <Shelley>"
+	description := strings.Repeat("filler words ", 30) + "the creature of Frankenstein awakes " + strings.Repeat("more filler ", 30)
+	products := []models.Product{{ID: 1, Name: "Frankenstein & frankenstein", Author: &author, Description: description}}
+
+	h := highlightProducts(products, []string{"FRANKENSTEIN"})[1]
+
+	if h.Name != "<mark>Frankenstein</mark> &amp; <mark>frankenstein</mark>" {
+		t.Errorf("unexpected name highlight %q", h.Name)
+	}
+	if h.Author != "" {
+		t.Errorf("author did not match but was highlighted: %q", h.Author)
+	}
+	if len(h.Description) != 1 {
+		t.Fatalf("expected one description snippet, got %v", h.Description)
+	}
+	snip := h.Description[0]
+	if !strings.HasPrefix(snip, "…") || !strings.HasSuffix(snip, "…") || !strings.Contains(snip, "<mark>Frankenstein</mark>") {
+		t.Errorf("unexpected snippet %q", snip)
+	}
+	if len(snip) > snippetSize+len("<mark></mark>")+2*len("…") {
+		t.Errorf("snippet is %d bytes, longer than expected", len(snip))
+	}
+}
+
+// TestSnippetLongMatch checks a match longer than snippetSize is returned
+// whole rather than cut
+func TestSnippetLongMatch(t *testing.T) {
+	match := strings.Repeat("nevermore ", 20)
+	text := strings.Repeat("filler words ", 20) + match + strings.Repeat("more filler ", 20)
+	start := strings.Index(text, match)
+
+	snip := snippet(text, []int{start, start + len(match)})
+	if !strings.Contains(snip, match) {
+		t.Errorf("snippet %q does not hold the whole match", snip)
+	}
+}
+
+// TestSuggestFromWords checks misspelt words are replaced by the closest
+// known word, preferring the more common on a tie, and known words are kept
+func TestSuggestFromWords(t *testing.T) {
+	words := map[string]int{"pride": 1, "and": 3, "prejudice": 1, "frankenstein": 1, "austen": 2, "austin": 1}
+
+	tests := map[string]string{
+		"pride and prejudise": "pride and prejudice",
+		"Frankenstien":        "frankenstein",
+		"austan":              "austen",
+		"pride":               "",
+		"xyzzy":               "",
+	}
+	for query, want := range tests {
+		if got := suggestFromWords(query, words); got != want {
+			t.Errorf("suggestFromWords(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+// TestCompletionInputs checks a title can be completed from the start of
+// any of its words
+func TestCompletionInputs(t *testing.T) {
+	got := completionInputs("The Great  Gatsby")
+	want := []string{"The Great Gatsby", "Great Gatsby", "Gatsby"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("completionInputs = %q, want %q", got, want)
+	}
+	if !hasWordPrefix("Science Fiction", "fic") || hasWordPrefix("Science Fiction", "ction") {
+		t.Error("hasWordPrefix should match the start of a word only")
+	}
+}
+
+func TestExpandSynonyms(t *testing.T) {
+	sets := []models.SynonymSet{
+		{Terms: []string{"sci fi", "science fiction"}},
+		{Terms: []string{"novel", "book"}},
+	}
+
+	got := expandSynonyms("Sci-Fi novel", sets)
+	want := []string{"Sci-Fi novel", "science fiction novel", "sci fi book"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expandSynonyms = %q, want %q", got, want)
+	}
+	if got := expandSynonyms("fiction", sets); len(got) != 1 {
+		t.Errorf("expandSynonyms should only match whole terms, got %q", got)
+	}
+}
+
+// TestIndexBodyVectorField checks the vector field is mapped, sized to the
+// embedder, only when there is one
+func TestIndexBodyVectorField(t *testing.T) {
+	for _, embedder := range []embeddings.Embedder{nil, &embeddings.HashEmbedder{Dims: 8}} {
+		r := &ElasticsearchRepository{embedder: embedder}
+		body, err := r.indexBody()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var mappings struct {
+			Properties map[string]struct {
+				Type string `json:"type"`
+				Dims int    `json:"dims"`
+			} `json:"properties"`
+		}
+		if err := json.Unmarshal(body["mappings"], &mappings); err != nil {
+			t.Fatal(err)
+		}
+		field, ok := mappings.Properties[vectorField]
+		if embedder == nil && ok {
+			t.Error("vector field mapped without an embedder")
+		}
+		if embedder != nil && (field.Type != "dense_vector" || field.Dims != 8) {
+			t.Errorf("vector field mapped as %+v, want an 8 dimension dense_vector", field)
+		}
+		if _, ok := mappings.Properties["title_suggest"]; !ok {
+			t.Error("other fields should stay mapped")
+		}
+	}
+}
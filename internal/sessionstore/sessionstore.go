@@ -0,0 +1,168 @@
+// Package sessionstore builds the browser session store from configuration:
+// signing and encryption keys with rotation, cookie security attributes, and
+// session-ID regeneration for stores that keep data server side.
+package sessionstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/rbcervilla/redisstore/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+// MaxAge is how long a session cookie lives, in seconds
+const MaxAge = 86400 * 30
+
+// minAuthKeyLength is the shortest accepted HMAC signing key
+const minAuthKeyLength = 32
+
+// ParseKeys turns comma-separated base64 signing and encryption keys into the
+// hash/block key pairs gorilla expects, newest first. Cookies are written
+// with the first pair and read with any of them, so a key is rotated by
+// prepending a new one and dropping the old one once its cookies expire.
+// encryptionKeys may be empty to sign without encrypting; otherwise it must
+// list one key per signing key.
+func ParseKeys(authKeys, encryptionKeys string) ([][]byte, error) {
+	auth, err := decodeKeys(authKeys)
+	if err != nil {
+		return nil, fmt.Errorf("signing keys: %w", err)
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("no signing keys")
+	}
+	enc, err := decodeKeys(encryptionKeys)
+	if err != nil {
+		return nil, fmt.Errorf("encryption keys: %w", err)
+	}
+	if len(enc) != 0 && len(enc) != len(auth) {
+		return nil, fmt.Errorf("got %d signing keys but %d encryption keys; list one of each per rotation", len(auth), len(enc))
+	}
+
+	pairs := make([][]byte, 0, 2*len(auth))
+	for i, key := range auth {
+		if len(key) < minAuthKeyLength {
+			return nil, fmt.Errorf("signing key %d is %d bytes, need at least %d", i+1, len(key), minAuthKeyLength)
+		}
+		var block []byte
+		if len(enc) != 0 {
+			block = enc[i]
+			if n := len(block); n != 16 && n != 24 && n != 32 {
+				return nil, fmt.Errorf("encryption key %d is %d bytes, need 16, 24 or 32", i+1, n)
+			}
+		}
+		pairs = append(pairs, key, block)
+	}
+	return pairs, nil
+}
+
+func decodeKeys(list string) ([][]byte, error) {
+	var keys [][]byte
+	for i, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(field)
+		if err != nil {
+			return nil, fmt.Errorf("key %d is not valid base64: %w", i+1, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// RandomKeys returns a single signing and encryption key pair for when none
+// are configured. Sessions signed with them do not survive a restart and are
+// not valid on other replicas.
+func RandomKeys() ([][]byte, error) {
+	auth := make([]byte, 64)
+	block := make([]byte, 32)
+	if _, err := rand.Read(auth); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(block); err != nil {
+		return nil, err
+	}
+	return [][]byte{auth, block}, nil
+}
+
+// ParseSameSite maps "lax", "strict" or "none" to the cookie attribute
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("invalid SameSite value %q (want lax, strict or none)", value)
+}
+
+// Options returns the session cookie attributes. Browsers reject
+// SameSite=None cookies that are not Secure, so that combination is an error.
+func Options(secure bool, sameSite http.SameSite) (sessions.Options, error) {
+	if sameSite == http.SameSiteNoneMode && !secure {
+		return sessions.Options{}, fmt.Errorf("SameSite=None requires Secure cookies")
+	}
+	return sessions.Options{
+		Path:     "/",
+		MaxAge:   MaxAge,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+	}, nil
+}
+
+// NewCookieStore keeps the whole session in a signed (and, with encryption
+// keys, encrypted) cookie
+func NewCookieStore(keyPairs [][]byte, opts sessions.Options) *sessions.CookieStore {
+	store := sessions.NewCookieStore(keyPairs...)
+	store.Options = &opts
+	store.MaxAge(opts.MaxAge)
+	return store
+}
+
+// Regenerator is implemented by stores that keep session data server side
+// under an ID carried in the cookie. The ID must change when a session signs
+// in, so an ID planted in the browser beforehand is never authenticated.
+type Regenerator interface {
+	// RegenerateID discards the session's current ID; the next Save stores
+	// its values under a fresh one
+	RegenerateID(r *http.Request, session *sessions.Session) error
+}
+
+// redisKeyPrefix is where session data lives in Redis
+const redisKeyPrefix = "session:"
+
+// RedisStore keeps session data in Redis, with only a random ID in the cookie
+type RedisStore struct {
+	*redisstore.RedisStore
+	client redis.UniversalClient
+}
+
+func NewRedisStore(ctx context.Context, client redis.UniversalClient, opts sessions.Options) (*RedisStore, error) {
+	store, err := redisstore.NewRedisStore(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	store.KeyPrefix(redisKeyPrefix)
+	store.Options(opts)
+	return &RedisStore{RedisStore: store, client: client}, nil
+}
+
+func (s *RedisStore) RegenerateID(r *http.Request, session *sessions.Session) error {
+	if session.ID != "" {
+		if err := s.client.Del(r.Context(), redisKeyPrefix+session.ID).Err(); err != nil {
+			return err
+		}
+	}
+	session.ID = ""
+	return nil
+}
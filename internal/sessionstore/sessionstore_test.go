@@ -0,0 +1,88 @@
+package sessionstore
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func key(fill byte, n int) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(fill), n)))
+}
+
+func TestParseKeys(t *testing.T) {
+	pairs, err := ParseKeys(key('a', 32)+", "+key('b', 64), key('c', 32)+","+key('d', 16))
+	if err != nil {
+		t.Fatalf("ParseKeys failed: %v", err)
+	}
+	if len(pairs) != 4 || pairs[0][0] != 'a' || pairs[1][0] != 'c' || pairs[2][0] != 'b' || pairs[3][0] != 'd' {
+		t.Errorf("keys were not paired newest first")
+	}
+
+	pairs, err = ParseKeys(key('a', 32), "")
+	if err != nil || len(pairs) != 2 || pairs[1] != nil {
+		t.Errorf("expected a signing-only pair, got %v, %v", pairs, err)
+	}
+
+	bad := []struct{ name, auth, enc string }{
+		{"no keys", "", ""},
+		{"short signing key", key('a', 16), ""},
+		{"bad encryption length", key('a', 32), key('c', 20)},
+		{"mismatched counts", key('a', 32) + "," + key('b', 32), key('c', 32)},
+		{"not base64", "not-base64!", ""},
+	}
+	for _, tt := range bad {
+		if _, err := ParseKeys(tt.auth, tt.enc); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+// TestCookieKeyRotation checks that cookies written with a retired key are
+// still read after a new key is prepended, and rejected once it is dropped
+func TestCookieKeyRotation(t *testing.T) {
+	opts, err := Options(false, http.SameSiteLaxMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKeys, _ := ParseKeys(key('a', 32), key('c', 32))
+	rotated, _ := ParseKeys(key('b', 32)+","+key('a', 32), key('d', 32)+","+key('c', 32))
+	retired, _ := ParseKeys(key('b', 32), key('d', 32))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	session, _ := NewCookieStore(oldKeys, opts).Get(req, "cart-session")
+	session.Values["user_id"] = 7
+	if err := session.Save(req, rec); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	cookie := rec.Result().Cookies()[0]
+
+	read := httptest.NewRequest(http.MethodGet, "/", nil)
+	read.AddCookie(cookie)
+	session, err = NewCookieStore(rotated, opts).Get(read, "cart-session")
+	if err != nil || session.Values["user_id"] != 7 {
+		t.Errorf("rotated keys should read old cookies, got %v, %v", session.Values, err)
+	}
+
+	read = httptest.NewRequest(http.MethodGet, "/", nil)
+	read.AddCookie(cookie)
+	if _, err := NewCookieStore(retired, opts).Get(read, "cart-session"); err == nil {
+		t.Error("expected cookies signed with a dropped key to be rejected")
+	}
+}
+
+func TestOptions(t *testing.T) {
+	if _, err := Options(false, http.SameSiteNoneMode); err == nil {
+		t.Error("expected SameSite=None without Secure to be rejected")
+	}
+	opts, err := Options(true, http.SameSiteStrictMode)
+	if err != nil || !opts.Secure || !opts.HttpOnly || opts.SameSite != http.SameSiteStrictMode {
+		t.Errorf("unexpected options %+v, %v", opts, err)
+	}
+	if _, err := ParseSameSite("sideways"); err == nil {
+		t.Error("expected an invalid SameSite value to be rejected")
+	}
+}
@@ -0,0 +1,90 @@
+package twofactor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func TestVerifyAcceptsAdjacentStepsOnly(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri := URI(secret, "reader@example.com"); !strings.HasPrefix(uri, "otpauth://totp/Bookstore:reader@example.com?") {
+		t.Fatalf("unexpected provisioning URI %s", uri)
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	for _, tc := range []struct {
+		offset time.Duration
+		ok     bool
+	}{
+		{0, true},
+		{-30 * time.Second, true},
+		{30 * time.Second, true},
+		{-90 * time.Second, false},
+		{90 * time.Second, false},
+	} {
+		code, err := totp.GenerateCodeCustom(secret, now.Add(tc.offset), validateOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := Verify(secret, code, now)
+		if ok != tc.ok {
+			t.Errorf("offset %v: ok = %v, want %v", tc.offset, ok, tc.ok)
+		}
+		if ok && step != now.Add(tc.offset).Unix()/period {
+			t.Errorf("offset %v: step = %d", tc.offset, step)
+		}
+	}
+
+	if _, ok := Verify(secret, "abcdef", now); ok {
+		t.Error("non-numeric code accepted")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes, %d hashes", len(codes), len(hashes))
+	}
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("badly formatted code %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+
+		typed := strings.ToUpper(strings.ReplaceAll(code, "-", " "))
+		if HashRecoveryCode(typed) != hashes[i] {
+			t.Errorf("code %q typed as %q does not match its hash", code, typed)
+		}
+		if LooksLikeTOTP(code) {
+			t.Errorf("recovery code %q mistaken for a TOTP code", code)
+		}
+	}
+}
+
+func TestQRCodeDataURI(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := QRCodeDataURI(URI(secret, "reader@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(img, "data:image/png;base64,") {
+		t.Fatalf("unexpected data URI prefix: %.40s", img)
+	}
+}
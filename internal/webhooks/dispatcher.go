@@ -0,0 +1,200 @@
+package webhooks
+
+import (
+	"DemoApp/internal/models"
+	"DemoApp/internal/repository"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Dispatcher queues events for subscribers and delivers them in the background.
+// Deliveries are stored in Postgres first, so events survive restarts and any
+// replica can deliver them.
+type Dispatcher struct {
+	repo   repository.WebhookRepository
+	client *http.Client
+
+	MaxAttempts  int           // Attempts before a delivery is marked failed
+	BaseDelay    time.Duration // Delay before the first retry, doubled on each attempt
+	MaxDelay     time.Duration // Upper bound on the retry delay
+	PollInterval time.Duration // How often Run looks for due deliveries
+	BatchSize    int           // Deliveries claimed per poll
+}
+
+// deliveryLease must outlast the HTTP timeout so a delivery in flight is not
+// claimed again by another replica. DeliverDue posts a batch concurrently, so
+// the whole batch is bounded by one client timeout rather than BatchSize of them
+const deliveryLease = time.Minute
+
+func NewDispatcher(repo repository.WebhookRepository) *Dispatcher {
+	return &Dispatcher{
+		repo:         repo,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts:  8,
+		BaseDelay:    30 * time.Second,
+		MaxDelay:     time.Hour,
+		PollInterval: 5 * time.Second,
+		BatchSize:    20,
+	}
+}
+
+// Publish queues an event for every subscriber that wants eventType. eventID
+// must be the same each time the event is published (derive it with EventID),
+// so a redelivered outbox event does not reach subscribers twice
+func (d *Dispatcher) Publish(eventID, eventType string, data interface{}) error {
+	envelope := Envelope{
+		ID:        eventID,
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("error encoding %s event: %w", eventType, err)
+	}
+	if _, err := d.repo.EnqueueEvent(envelope.ID, eventType, body); err != nil {
+		return fmt.Errorf("error queueing %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+// PublishOrder queues an order event (order.created or order.cancelled)
+func (d *Dispatcher) PublishOrder(eventID, eventType string, order *models.Order) error {
+	if order == nil {
+		return nil
+	}
+	data := OrderData{
+		OrderID:     order.ID,
+		Status:      order.Status,
+		TotalAmount: order.TotalAmount,
+		Items:       make([]OrderItem, 0, len(order.Items)),
+	}
+	if order.UserID != nil {
+		data.UserID = *order.UserID
+	}
+	for _, item := range order.Items {
+		oi := OrderItem{ProductID: item.ProductID, Quantity: item.Quantity, Price: item.Price}
+		if item.Product.SKU != nil {
+			oi.SKU = *item.Product.SKU
+		}
+		data.Items = append(data.Items, oi)
+	}
+	return d.Publish(eventID, eventType, data)
+}
+
+// PublishEntitlement queues an entitlement event (entitlement.granted or entitlement.revoked)
+func (d *Dispatcher) PublishEntitlement(eventID, eventType string, userID int, sku string, orderID int) error {
+	return d.Publish(eventID, eventType, EntitlementData{UserID: userID, SKU: sku, OrderID: orderID})
+}
+
+// Run delivers due webhooks until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.DeliverDue(ctx); err != nil {
+			log.Printf("Webhooks: error delivering: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue attempts one batch of due deliveries and returns how many were attempted
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := d.repo.ClaimDueDeliveries(d.BatchSize, deliveryLease)
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer wg.Done()
+			d.attempt(ctx, delivery)
+			if err := d.repo.RecordDeliveryAttempt(delivery); err != nil {
+				log.Printf("Webhooks: error recording delivery %d: %v", delivery.ID, err)
+			}
+		}(&deliveries[i])
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// attempt POSTs the delivery and updates its status, attempts and next retry
+func (d *Dispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	delivery.Attempts++
+	delivery.ResponseStatus = nil
+	delivery.LastError = nil
+
+	statusCode, err := d.post(ctx, delivery)
+	if statusCode != 0 {
+		delivery.ResponseStatus = &statusCode
+	}
+	if err == nil {
+		now := time.Now()
+		delivery.Status = models.WebhookDelivered
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	msg := err.Error()
+	delivery.LastError = &msg
+	if delivery.Attempts >= d.MaxAttempts {
+		delivery.Status = models.WebhookFailed
+		log.Printf("Webhooks: giving up on delivery %d to %s after %d attempts: %v", delivery.ID, delivery.URL, delivery.Attempts, err)
+		return
+	}
+	delivery.Status = models.WebhookPending
+	delivery.NextAttemptAt = time.Now().Add(d.backoff(delivery.Attempts))
+}
+
+// backoff returns the delay after the given number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Bookstore-Webhooks/1.0")
+	req.Header.Set(HeaderEventID, delivery.EventID)
+	req.Header.Set(HeaderEventType, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,222 @@
+package webhooks
+
+import (
+	"DemoApp/internal/models"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryRepo is an in-memory WebhookRepository
+type memoryRepo struct {
+	mu          sync.Mutex
+	subscribers []models.WebhookSubscriber
+	deliveries  []models.WebhookDelivery
+}
+
+func (m *memoryRepo) ListSubscribers() ([]models.WebhookSubscriber, error) {
+	return m.subscribers, nil
+}
+
+func (m *memoryRepo) CreateSubscriber(url, secret string, events []string) (int, error) {
+	id := len(m.subscribers) + 1
+	m.subscribers = append(m.subscribers, models.WebhookSubscriber{ID: id, URL: url, Secret: secret, Events: events, Active: true})
+	return id, nil
+}
+
+func (m *memoryRepo) SetSubscriberActive(id int, active bool) error {
+	m.subscribers[id-1].Active = active
+	return nil
+}
+
+func (m *memoryRepo) DeleteSubscriber(id int) error { return nil }
+
+func (m *memoryRepo) EnqueueEvent(eventID, eventType string, payload []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, s := range m.subscribers {
+		if !s.Wants(eventType) || m.queued(s.ID, eventID) {
+			continue
+		}
+		m.deliveries = append(m.deliveries, models.WebhookDelivery{
+			ID: len(m.deliveries) + 1, SubscriberID: s.ID, URL: s.URL, Secret: s.Secret,
+			EventID: eventID, EventType: eventType, Payload: payload, Status: models.WebhookPending,
+		})
+		n++
+	}
+	return n, nil
+}
+
+func (m *memoryRepo) queued(subscriberID int, eventID string) bool {
+	for _, d := range m.deliveries {
+		if d.SubscriberID == subscriberID && d.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimDueDeliveries returns every pending delivery regardless of its retry
+// time, so tests can step through retries without waiting
+func (m *memoryRepo) ClaimDueDeliveries(limit int, _ time.Duration) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []models.WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.Status == models.WebhookPending && len(due) < limit {
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+
+func (m *memoryRepo) RecordDeliveryAttempt(d *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries[d.ID-1] = *d
+	return nil
+}
+
+func (m *memoryRepo) ListDeliveries(limit int) ([]models.WebhookDelivery, error) {
+	return m.deliveries, nil
+}
+
+func (m *memoryRepo) RetryDelivery(id int) error { return nil }
+
+// standIn is a local subscriber that verifies signatures and fails the first
+// failures requests
+type standIn struct {
+	t        *testing.T
+	secret   string
+	failures int
+
+	mu       sync.Mutex
+	received []Envelope
+	calls    int
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+
+	body, _ := io.ReadAll(r.Body)
+	ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil || !Verify(s.secret, ts, body, r.Header.Get(HeaderSignature)) {
+		s.t.Errorf("invalid signature %q", r.Header.Get(HeaderSignature))
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+		return
+	}
+	if s.calls <= s.failures {
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+		return
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		s.t.Errorf("invalid body: %v", err)
+	}
+	if env.Type != r.Header.Get(HeaderEventType) {
+		s.t.Errorf("event header %q does not match body type %q", r.Header.Get(HeaderEventType), env.Type)
+	}
+	s.received = append(s.received, env)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestDeliverySignedAndRetried(t *testing.T) {
+	receiver := &standIn{t: t, secret: "whsec_test", failures: 2}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	repo := &memoryRepo{}
+	repo.CreateSubscriber(srv.URL, receiver.secret, []string{EventEntitlementGranted})
+	d := NewDispatcher(repo)
+
+	d.PublishEntitlement(EventID(1, EventEntitlementGranted, "BOOK-1342"), EventEntitlementGranted, 7, "BOOK-1342", 3)
+	d.PublishOrder(EventID(1, EventOrderCreated), EventOrderCreated, &models.Order{ID: 3}) // not subscribed
+	// A redelivered outbox event keeps its ID and is not queued again
+	d.PublishEntitlement(EventID(1, EventEntitlementGranted, "BOOK-1342"), EventEntitlementGranted, 7, "BOOK-1342", 3)
+
+	if len(repo.deliveries) != 1 {
+		t.Fatalf("expected 1 queued delivery, got %d", len(repo.deliveries))
+	}
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		before := time.Now()
+		if _, err := d.DeliverDue(context.Background()); err != nil {
+			t.Fatalf("DeliverDue failed: %v", err)
+		}
+		got := repo.deliveries[0]
+		if got.Attempts != attempt {
+			t.Fatalf("expected %d attempts, got %d", attempt, got.Attempts)
+		}
+		if attempt < 3 {
+			if got.Status != models.WebhookPending || got.ResponseStatus == nil || *got.ResponseStatus != http.StatusServiceUnavailable {
+				t.Fatalf("attempt %d: expected pending after 503, got %+v", attempt, got)
+			}
+			// 30s, then 60s
+			want := d.BaseDelay << (attempt - 1)
+			if delay := got.NextAttemptAt.Sub(before); delay < want || delay > want+time.Second {
+				t.Errorf("attempt %d: expected retry in %v, got %v", attempt, want, delay)
+			}
+		}
+	}
+
+	got := repo.deliveries[0]
+	if got.Status != models.WebhookDelivered || got.DeliveredAt == nil {
+		t.Fatalf("expected delivered, got %+v", got)
+	}
+	if len(receiver.received) != 1 {
+		t.Fatalf("expected 1 accepted event, got %d", len(receiver.received))
+	}
+	if id := receiver.received[0].ID; id != "1:entitlement.granted:BOOK-1342" {
+		t.Errorf("unexpected event ID %q", id)
+	}
+	data := receiver.received[0].Data.(map[string]interface{})
+	if data["sku"] != "BOOK-1342" || data["user_id"] != float64(7) {
+		t.Errorf("unexpected payload: %v", data)
+	}
+}
+
+func TestDeliveryFailsAfterMaxAttempts(t *testing.T) {
+	receiver := &standIn{t: t, secret: "s", failures: 100}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	repo := &memoryRepo{}
+	repo.CreateSubscriber(srv.URL, receiver.secret, nil)
+	d := NewDispatcher(repo)
+	d.MaxAttempts = 3
+
+	d.PublishOrder(EventID(2, EventOrderCancelled), EventOrderCancelled, &models.Order{ID: 1, Status: "cancelled"})
+	for i := 0; i < 5; i++ {
+		if _, err := d.DeliverDue(context.Background()); err != nil {
+			t.Fatalf("DeliverDue failed: %v", err)
+		}
+	}
+
+	got := repo.deliveries[0]
+	if got.Status != models.WebhookFailed || got.Attempts != 3 || got.LastError == nil {
+		t.Fatalf("expected failed after 3 attempts, got %+v", got)
+	}
+	if receiver.calls != 3 {
+		t.Errorf("expected 3 requests, got %d", receiver.calls)
+	}
+}
+
+func TestBackoffCapped(t *testing.T) {
+	d := NewDispatcher(&memoryRepo{})
+	if got := d.backoff(1); got != 30*time.Second {
+		t.Errorf("expected 30s, got %v", got)
+	}
+	if got := d.backoff(20); got != time.Hour {
+		t.Errorf("expected cap of 1h, got %v", got)
+	}
+}
@@ -2,6 +2,9 @@
 -- Consolidated migration with complete table definitions
 -- All tables created with final schema from day 1
 
+-- Trigram matching for the SQL search's typo tolerance and substring matches
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
 -- Categories
 CREATE TABLE categories (
     id SERIAL PRIMARY KEY,
@@ -21,13 +24,25 @@ CREATE TABLE products (
     category_id INTEGER REFERENCES categories(id),
     status VARCHAR(20) DEFAULT 'active',
     author VARCHAR(255),
-    popularity_score INTEGER DEFAULT 0  -- Gutenberg download count, used for sorting
+    popularity_score INTEGER DEFAULT 0,  -- Gutenberg download count, used for sorting
+    -- Full-text search document for the SQL search, weighting title over author over description
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(author, '')), 'B') ||
+        setweight(to_tsvector('english', COALESCE(description, '')), 'C')
+    ) STORED
 );
 
 -- Index for popularity sorting
 CREATE INDEX idx_products_popularity ON products(popularity_score DESC);
 CREATE INDEX idx_products_category_popularity ON products(category_id, popularity_score DESC);
 
+-- Indexes for the SQL search: full-text matches, and trigram typo and substring matches
+CREATE INDEX idx_products_search_vector ON products USING GIN (search_vector);
+CREATE INDEX idx_products_name_trgm ON products USING GIN (name gin_trgm_ops);
+CREATE INDEX idx_products_author_trgm ON products USING GIN (author gin_trgm_ops);
+CREATE INDEX idx_products_description_trgm ON products USING GIN (description gin_trgm_ops);
+
 -- Users (complete schema)
 CREATE TABLE users (
     id SERIAL PRIMARY KEY,
@@ -35,6 +50,11 @@ CREATE TABLE users (
     password_hash VARCHAR(255) NOT NULL,
     full_name VARCHAR(255),
     role VARCHAR(20) DEFAULT 'customer',
+    email_verified_at TIMESTAMP WITH TIME ZONE,  -- NULL until the address is confirmed
+    totp_secret VARCHAR(64),                     -- Base32 TOTP secret, NULL when 2FA is off
+    totp_enabled_at TIMESTAMP WITH TIME ZONE,
+    totp_last_step BIGINT,                       -- Last accepted TOTP time step, to reject replays
+    webauthn_handle BYTEA UNIQUE,                -- Opaque WebAuthn user handle, set on first passkey
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -42,7 +62,7 @@ CREATE TABLE users (
 CREATE TABLE cart_items (
     id SERIAL PRIMARY KEY,
     session_id VARCHAR(255),
-    user_id INTEGER REFERENCES users(id),
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
     product_id INTEGER REFERENCES products(id),
     quantity INTEGER NOT NULL DEFAULT 1,
     CONSTRAINT session_or_user CHECK (
@@ -63,11 +83,12 @@ CREATE UNIQUE INDEX idx_cart_items_user_product
 CREATE TABLE orders (
     id SERIAL PRIMARY KEY,
     session_id VARCHAR(255),
-    user_id INTEGER REFERENCES users(id),
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
     total_amount DECIMAL(10, 2),
     status VARCHAR(20) DEFAULT 'pending',
     shipping_info JSONB,
-    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    anonymized_at TIMESTAMP WITH TIME ZONE
 );
 
 CREATE TABLE order_items (
@@ -97,13 +118,214 @@ CREATE INDEX idx_reviews_user ON reviews(user_id);
 CREATE INDEX idx_reviews_rating ON reviews(rating);
 CREATE INDEX idx_reviews_created_at ON reviews(created_at DESC);
 
+-- Security audit log (lockouts, unlocks and other account events)
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    event VARCHAR(100) NOT NULL,
+    ip VARCHAR(64),
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_log_user ON audit_log(user_id, created_at DESC);
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at DESC);
+
+-- Password reset tokens (only the SHA-256 of the emailed token is stored)
+CREATE TABLE password_reset_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_password_reset_tokens_user ON password_reset_tokens(user_id);
+
+-- Email verification tokens. email is the address being confirmed, which
+-- differs from users.email for a pending email change
+CREATE TABLE email_verification_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_email_verification_tokens_user ON email_verification_tokens(user_id);
+
+-- Two-factor recovery codes (SHA-256 of each single-use code)
+CREATE TABLE recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, code_hash)
+);
+
+-- Passkeys (WebAuthn credentials). credential holds the library's JSON
+-- record: public key, sign count, flags and transports
+CREATE TABLE webauthn_credentials (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id BYTEA UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    credential JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_webauthn_credentials_user ON webauthn_credentials(user_id);
+
+-- Accounts at external identity providers (OAuth2 / OpenID Connect) linked
+-- to a user. subject is the provider's stable user ID.
+CREATE TABLE user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider)
+);
+
+-- Signed-in browser sessions. The session cookie carries a random ID whose
+-- hash is stored here so other devices can be listed and signed out
+CREATE TABLE user_sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_user_sessions_user ON user_sessions(user_id);
+
+-- Outbound webhooks (subscribers and their delivery log)
+CREATE TABLE webhook_subscribers (
+    id SERIAL PRIMARY KEY,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{}',  -- empty = all events
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE webhook_deliveries (
+    id SERIAL PRIMARY KEY,
+    subscriber_id INTEGER NOT NULL REFERENCES webhook_subscribers(id) ON DELETE CASCADE,
+    event_id VARCHAR(150) NOT NULL,  -- Derived from the outbox event, stable across redeliveries
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',  -- pending, delivered, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_status INTEGER,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (subscriber_id, event_id)
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_webhook_deliveries_created_at ON webhook_deliveries(created_at DESC);
+
+-- Transactional outbox: domain events written in the same transaction as the
+-- change, then published to sinks by a background dispatcher
+CREATE TABLE outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    aggregate_type VARCHAR(50) NOT NULL,  -- order, review, product
+    aggregate_id INTEGER NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    published_sinks TEXT[] NOT NULL DEFAULT '{}',  -- Sinks that accepted the event, skipped on retry
+    next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_outbox_events_unpublished ON outbox_events(next_attempt_at, id) WHERE published_at IS NULL;
+-- Products changed while the search index was rebuilt are found by event time
+CREATE INDEX idx_outbox_events_created_at ON outbox_events(created_at);
+
+-- Search rules managed by admins: groups of equivalent terms, pushed to the
+-- Elasticsearch synonyms set and expanded by the SQL search, and products
+-- pinned or boosted for a query
+CREATE TABLE search_synonyms (
+    id SERIAL PRIMARY KEY,
+    terms TEXT[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE search_promotions (
+    id SERIAL PRIMARY KEY,
+    query TEXT NOT NULL,              -- Lowercased with single spaces
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    pinned BOOLEAN NOT NULL DEFAULT FALSE,
+    boost REAL NOT NULL DEFAULT 1,    -- Relevance multiplier when not pinned
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (query, product_id)
+);
+
+-- Search analytics: searches run from the product list and the results
+-- clicked from them, reported on the admin search page
+CREATE TABLE search_events (
+    id BIGSERIAL PRIMARY KEY,
+    query TEXT NOT NULL,              -- As typed; empty when only filters were chosen
+    corrected_query TEXT,             -- Respelling shown when the query found nothing
+    filters JSONB NOT NULL DEFAULT '{}',
+    result_count INTEGER NOT NULL,
+    latency_ms REAL NOT NULL,
+    session_id VARCHAR(255),
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_search_events_created_at ON search_events(created_at DESC);
+
+CREATE TABLE search_clicks (
+    search_id BIGINT NOT NULL REFERENCES search_events(id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,        -- 1-based rank in the results
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (search_id, product_id)
+);
+
 -- Comments for documentation
 COMMENT ON TABLE categories IS 'Product categories for organizing books';
 COMMENT ON TABLE products IS 'Book products with metadata from Project Gutenberg';
 COMMENT ON COLUMN products.popularity_score IS 'Gutenberg 30-day download count for sorting';
+COMMENT ON COLUMN products.search_vector IS 'Weighted full-text document ranked by the SQL search when Elasticsearch is unavailable';
 COMMENT ON TABLE users IS 'User accounts for authentication and orders';
+COMMENT ON COLUMN users.password_hash IS 'bcrypt hash, or empty for accounts created through social login';
 COMMENT ON TABLE cart_items IS 'Shopping cart items - supports both anonymous (session) and authenticated users';
 COMMENT ON TABLE orders IS 'Customer orders';
+COMMENT ON COLUMN orders.anonymized_at IS 'Set when the customer deleted their account; the order is kept for financial records without personal data';
 COMMENT ON TABLE order_items IS 'Individual items within an order';
 COMMENT ON TABLE reviews IS 'Product reviews and ratings from users';
+COMMENT ON TABLE webhook_subscribers IS 'External endpoints notified of order and entitlement events';
+COMMENT ON TABLE audit_log IS 'Security-relevant account events such as lockouts and unlocks';
+COMMENT ON TABLE password_reset_tokens IS 'Hashed single-use password reset tokens sent by email';
+COMMENT ON TABLE email_verification_tokens IS 'Hashed single-use tokens confirming a signup or changed email address';
+COMMENT ON TABLE recovery_codes IS 'Hashed single-use codes that stand in for a TOTP code when the authenticator is lost';
+COMMENT ON TABLE webauthn_credentials IS 'Passkeys registered for passwordless sign-in';
+COMMENT ON TABLE user_identities IS 'External OAuth2/OIDC accounts used for social login';
+COMMENT ON TABLE user_sessions IS 'Signed-in browser sessions, listed on the profile page and revocable from any of them';
+COMMENT ON TABLE outbox_events IS 'Domain events awaiting at-least-once publication to in-process handlers and Redis streams';
+COMMENT ON TABLE webhook_deliveries IS 'Webhook delivery attempts, retried with backoff until delivered or failed';
+COMMENT ON TABLE search_synonyms IS 'Admin-managed groups of search terms that match each other';
+COMMENT ON TABLE search_promotions IS 'Products pinned to the top of, or boosted in, the results of a query';
+COMMENT ON TABLE search_events IS 'Product searches with their filters, result count and latency, for search analytics';
+COMMENT ON TABLE search_clicks IS 'Search results clicked, once per product per search';
 
@@ -0,0 +1,17 @@
+#!/bin/bash
+# Regenerate Go code for the gRPC services defined under proto/.
+#
+# Requires protoc plus the Go plugins:
+#   go install google.golang.org/protobuf/cmd/protoc-gen-go@v1.36.6
+#   go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.5.1
+set -e
+
+cd "$(dirname "$0")/.."
+
+protoc \
+  --proto_path=proto \
+  --go_out=. --go_opt=module=DemoApp \
+  --go-grpc_out=. --go-grpc_opt=module=DemoApp \
+  entitlements/v1/entitlements.proto
+
+echo "✅ Generated internal/entitlements/entitlementsv1"
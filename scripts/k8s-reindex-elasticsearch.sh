@@ -1,39 +1,31 @@
 #!/bin/bash
 set -e
 
+NAMESPACE="${1:-bookstore}"
+
 echo "╔════════════════════════════════════════════════════════════════════════════╗"
 echo "║          Re-index Elasticsearch                                            ║"
 echo "╚════════════════════════════════════════════════════════════════════════════╝"
 echo ""
 
 echo "📊 Current Elasticsearch index count:"
-kubectl exec -n bookstore statefulset/elasticsearch -- curl -s http://localhost:9200/products/_count | grep -o '"count":[0-9]*'
-echo ""
-
-echo "🗑️  Deleting old index..."
-kubectl exec -n bookstore statefulset/elasticsearch -- curl -X DELETE http://localhost:9200/products
-echo ""
-
-echo "⏳ Waiting 2 seconds..."
-sleep 2
-
-echo "🔄 Restarting app pods to trigger re-indexing..."
-kubectl rollout restart deployment/app-deployment -n bookstore
-
+kubectl exec -n "$NAMESPACE" statefulset/elasticsearch -- curl -s http://localhost:9200/products/_count | grep -o '"count":[0-9]*'
 echo ""
-echo "⏳ Waiting for pods to restart..."
-kubectl rollout status deployment/app-deployment -n bookstore
 
-echo ""
-echo "⏳ Waiting 10 seconds for indexing to complete..."
-sleep 10
+# Builds a new versioned index from Postgres, checks the document count,
+# swaps the products alias over to it and deletes old versions. Search
+# keeps serving from the old index until the swap, so no restart is needed.
+echo "🔄 Building new index and swapping alias..."
+kubectl exec -n "$NAMESPACE" deployment/app-deployment -- /app/reindex
 
 echo ""
 echo "📊 New Elasticsearch index count:"
-kubectl exec -n bookstore statefulset/elasticsearch -- curl -s http://localhost:9200/products/_count | grep -o '"count":[0-9]*'
+kubectl exec -n "$NAMESPACE" statefulset/elasticsearch -- curl -s http://localhost:9200/products/_count | grep -o '"count":[0-9]*'
+echo ""
+echo "🔗 Alias:"
+kubectl exec -n "$NAMESPACE" statefulset/elasticsearch -- curl -s http://localhost:9200/_cat/aliases/products
 
 echo ""
 echo "╔════════════════════════════════════════════════════════════════════════════╗"
 echo "║          ✅ RE-INDEXING COMPLETE                                           ║"
 echo "╚════════════════════════════════════════════════════════════════════════════╝"
-
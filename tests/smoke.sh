@@ -42,6 +42,12 @@ function cleanup() {
 
 trap cleanup EXIT
 
+# csrf_token prints the CSRF token for the session in cookie jar $1, which
+# every POST must send back
+csrf_token() {
+    curl -s -b "$1" -c "$1" "$BASE_URL/cart" | grep -o 'name="csrf-token" content="[^"]*"' | cut -d'"' -f4
+}
+
 echo "========================================="
 echo "E-commerce Application Smoke Tests"
 echo "========================================="
@@ -90,7 +96,7 @@ fi
 
 # Test 4: Add item to cart (anonymous)
 log_test "Adding item to cart as anonymous user..."
-RESPONSE=$(curl -s -X POST \
+RESPONSE=$(curl -s -X POST -H "X-CSRF-Token: $(csrf_token "$COOKIE_JAR")" \
     -b "$COOKIE_JAR" -c "$COOKIE_JAR" \
     -d "product_id=1&quantity=2" \
     -w "%{http_code}" \
@@ -121,7 +127,7 @@ fi
 
 # Test 7: User registration
 log_test "Registering new user..."
-RESPONSE=$(curl -s -X POST \
+RESPONSE=$(curl -s -X POST -H "X-CSRF-Token: $(csrf_token "$COOKIE_JAR")" \
     -b "$COOKIE_JAR" -c "$COOKIE_JAR" \
     -d "email=$TEST_EMAIL&password=$TEST_PASSWORD" \
     -w "%{http_code}" \
@@ -135,7 +141,7 @@ fi
 
 # Test 8: User login
 log_test "Logging in..."
-RESPONSE=$(curl -s -X POST \
+RESPONSE=$(curl -s -X POST -H "X-CSRF-Token: $(csrf_token "$COOKIE_JAR")" \
     -b "$COOKIE_JAR" -c "$COOKIE_JAR" \
     -d "email=$TEST_EMAIL&password=$TEST_PASSWORD" \
     -w "%{http_code}" \
@@ -149,7 +155,7 @@ fi
 
 # Test 9: Add item to cart (authenticated)
 log_test "Adding item to cart as authenticated user..."
-RESPONSE=$(curl -s -X POST \
+RESPONSE=$(curl -s -X POST -H "X-CSRF-Token: $(csrf_token "$COOKIE_JAR")" \
     -b "$COOKIE_JAR" -c "$COOKIE_JAR" \
     -d "product_id=2&quantity=3" \
     -w "%{http_code}" \
@@ -161,6 +167,10 @@ else
 fi
 
 # Test 10: Checkout page accessible
+# Checkout requires a verified email; confirm the test account directly
+# rather than following the emailed link
+docker compose exec -T db psql -U user -d bookstore -c \
+    "UPDATE users SET email_verified_at = NOW() WHERE email = '$TEST_EMAIL';" > /dev/null 2>&1
 log_test "Loading checkout page..."
 RESPONSE=$(curl -s -b "$COOKIE_JAR" -w "%{http_code}" "$BASE_URL/checkout")
 if echo "$RESPONSE" | grep -q "Order Summary"; then
@@ -213,11 +223,11 @@ MERGE_COOKIE=$(mktemp)
 MERGE_EMAIL="merge_test_$(date +%s)@example.com"
 
 # Add items as anonymous user
-curl -s -X POST -b "$MERGE_COOKIE" -c "$MERGE_COOKIE" \
+curl -s -X POST -H "X-CSRF-Token: $(csrf_token "$MERGE_COOKIE")" -b "$MERGE_COOKIE" -c "$MERGE_COOKIE" \
     -d "product_id=1&quantity=3" "$BASE_URL/cart/add" > /dev/null
 
 # Register and auto-login (this should merge the cart)
-curl -s -X POST -b "$MERGE_COOKIE" -c "$MERGE_COOKIE" \
+curl -s -X POST -H "X-CSRF-Token: $(csrf_token "$MERGE_COOKIE")" -b "$MERGE_COOKIE" -c "$MERGE_COOKIE" \
     -d "email=$MERGE_EMAIL&password=$TEST_PASSWORD" \
     "$BASE_URL/signup/process" > /dev/null
 
@@ -238,23 +248,23 @@ MERGE2_COOKIE=$(mktemp)
 MERGE2_EMAIL="merge2_test_$(date +%s)@example.com"
 
 # Register user
-curl -s -X POST -b "$MERGE2_COOKIE" -c "$MERGE2_COOKIE" \
+curl -s -X POST -H "X-CSRF-Token: $(csrf_token "$MERGE2_COOKIE")" -b "$MERGE2_COOKIE" -c "$MERGE2_COOKIE" \
     -d "email=$MERGE2_EMAIL&password=$TEST_PASSWORD" \
     "$BASE_URL/signup/process" > /dev/null
 
 # Add item to authenticated cart
-curl -s -X POST -b "$MERGE2_COOKIE" -c "$MERGE2_COOKIE" \
+curl -s -X POST -H "X-CSRF-Token: $(csrf_token "$MERGE2_COOKIE")" -b "$MERGE2_COOKIE" -c "$MERGE2_COOKIE" \
     -d "product_id=1&quantity=2" "$BASE_URL/cart/add" > /dev/null
 
 # Logout
 curl -s -b "$MERGE2_COOKIE" -c "$MERGE2_COOKIE" "$BASE_URL/logout" > /dev/null
 
 # Add different quantity as anonymous
-curl -s -X POST -b "$MERGE2_COOKIE" -c "$MERGE2_COOKIE" \
+curl -s -X POST -H "X-CSRF-Token: $(csrf_token "$MERGE2_COOKIE")" -b "$MERGE2_COOKIE" -c "$MERGE2_COOKIE" \
     -d "product_id=1&quantity=3" "$BASE_URL/cart/add" > /dev/null
 
 # Login (should merge: 2 + 3 = 5)
-curl -s -X POST -b "$MERGE2_COOKIE" -c "$MERGE2_COOKIE" \
+curl -s -X POST -H "X-CSRF-Token: $(csrf_token "$MERGE2_COOKIE")" -b "$MERGE2_COOKIE" -c "$MERGE2_COOKIE" \
     -d "email=$MERGE2_EMAIL&password=$TEST_PASSWORD" \
     "$BASE_URL/login/process" > /dev/null
 